@@ -4,10 +4,7 @@ go 1.21
 
 require (
 	github.com/creack/pty v1.1.21
+	golang.org/x/sys v0.28.0
 	golang.org/x/term v0.27.0
-)
-
-require (
-	golang.org/x/sys v0.28.0 // indirect
-	gopkg.in/yaml.v3 v3.0.1 // indirect
+	gopkg.in/yaml.v3 v3.0.1
 )
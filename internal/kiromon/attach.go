@@ -0,0 +1,421 @@
+package kiromon
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"golang.org/x/term"
+)
+
+// Requests a client can make on the PTY socket
+const (
+	AttachRead  = "read"  // mirror output only
+	AttachWrite = "write" // mirror output and forward keystrokes
+	AttachSend  = "send"  // write the request's input once and disconnect (kiromon send)
+	AttachQueue = "queue" // manage the prompt queue (kiromon queue)
+)
+
+// attachClientBuffer is how many output chunks may queue for a slow viewer before it is dropped
+const attachClientBuffer = 256
+
+// attachHandshakeTimeout bounds how long a client may take to send its request
+const attachHandshakeTimeout = 5 * time.Second
+
+// sendPieceDelay separates the pieces of a send request
+const sendPieceDelay = 100 * time.Millisecond
+
+// attachDetachKey ends an attach session (Ctrl-])
+const attachDetachKey = 0x1d
+
+// attachRequest is the first line a client sends on the PTY socket
+type attachRequest struct {
+	Mode    string   `json:"mode"`
+	Input   []string `json:"input,omitempty"`    // for send: pieces written one after another
+	IfState string   `json:"if_state,omitempty"` // for send: refuse unless the command is in this state
+	Op      string   `json:"op,omitempty"`       // for queue: add, list, clear or resume
+}
+
+// attachReply answers an attachRequest. For read and write, raw terminal
+// output follows an accepted request, starting with a repaint of the
+// current screen.
+type attachReply struct {
+	OK     bool     `json:"ok"`
+	Error  string   `json:"error,omitempty"`
+	Rows   int      `json:"rows,omitempty"`
+	Cols   int      `json:"cols,omitempty"`
+	State  string   `json:"state,omitempty"`  // for send: the state when the request arrived
+	Queue  []string `json:"queue,omitempty"`  // for queue: the pending prompts
+	Paused string   `json:"paused,omitempty"` // for queue: the screen line that paused it
+}
+
+// getAttachSocketPath returns the PTY socket path next to a status file
+func getAttachSocketPath(statusPath string) string {
+	return strings.TrimSuffix(statusPath, ".json") + ".pty.sock"
+}
+
+// ptyServer shares the wrapped command's terminal over a Unix socket.
+// Only connections from the same uid are accepted.
+type ptyServer struct {
+	path     string
+	listener *net.UnixListener
+	screen   *vtScreen
+	input    func([]byte) error
+	state    func() string
+	queue    *promptQueue
+	sendMu   sync.Mutex // keeps the pieces of concurrent sends together
+
+	mu      sync.Mutex
+	clients map[*ptyClient]struct{}
+	closed  bool
+}
+
+// ptyClient is one attached viewer
+type ptyClient struct {
+	conn *net.UnixConn
+	ch   chan []byte
+}
+
+// newPTYServer listens on path. screen provides the initial repaint, input
+// receives keystrokes from clients, state reports the command's state and
+// queue, which may be nil, serves kiromon queue.
+func newPTYServer(path string, screen *vtScreen, input func([]byte) error, state func() string, queue *promptQueue) (*ptyServer, error) {
+	os.Remove(path)
+	listener, err := net.ListenUnix("unix", &net.UnixAddr{Name: path, Net: "unix"})
+	if err != nil {
+		return nil, err
+	}
+	os.Chmod(path, 0600)
+
+	s := &ptyServer{
+		path:     path,
+		listener: listener,
+		screen:   screen,
+		input:    input,
+		state:    state,
+		queue:    queue,
+		clients:  make(map[*ptyClient]struct{}),
+	}
+	go s.acceptLoop()
+	return s, nil
+}
+
+// acceptLoop serves connections until the listener is closed
+func (s *ptyServer) acceptLoop() {
+	for {
+		conn, err := s.listener.AcceptUnix()
+		if err != nil {
+			return
+		}
+		go s.serve(conn)
+	}
+}
+
+// serve checks the peer, answers its request and streams output to it
+func (s *ptyServer) serve(conn *net.UnixConn) {
+	if uid, err := peerUID(conn); err != nil || uid != os.Getuid() {
+		conn.Close()
+		return
+	}
+
+	conn.SetReadDeadline(time.Now().Add(attachHandshakeTimeout))
+	reader := bufio.NewReader(conn)
+	line, err := reader.ReadBytes('\n')
+	if err != nil {
+		conn.Close()
+		return
+	}
+	conn.SetReadDeadline(time.Time{})
+
+	var req attachRequest
+	if err := json.Unmarshal(line, &req); err != nil {
+		req = attachRequest{}
+	}
+	switch req.Mode {
+	case AttachRead, AttachWrite:
+	case AttachSend:
+		writeAttachReply(conn, s.send(req))
+		conn.Close()
+		return
+	case AttachQueue:
+		writeAttachReply(conn, s.handleQueue(req))
+		conn.Close()
+		return
+	default:
+		writeAttachReply(conn, attachReply{Error: fmt.Sprintf("unknown request %q", strings.TrimSpace(string(line)))})
+		conn.Close()
+		return
+	}
+
+	c := &ptyClient{conn: conn, ch: make(chan []byte, attachClientBuffer)}
+	rows, cols := s.screen.Size()
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		conn.Close()
+		return
+	}
+	// Queue the repaint under the lock Publish holds while writing to the
+	// screen, so no output is lost or repeated
+	c.ch <- s.screen.Redraw()
+	s.clients[c] = struct{}{}
+	s.mu.Unlock()
+
+	if err := writeAttachReply(conn, attachReply{OK: true, Rows: rows, Cols: cols}); err != nil {
+		s.drop(c)
+	}
+	if req.Mode == AttachWrite {
+		go s.readInput(reader)
+	} else {
+		// Drain anything a read-only client sends
+		go io.Copy(io.Discard, reader)
+	}
+	s.writeLoop(c)
+}
+
+// send writes the input of a send request, unless its state guard fails
+func (s *ptyServer) send(req attachRequest) attachReply {
+	s.sendMu.Lock()
+	defer s.sendMu.Unlock()
+	state := s.state()
+	if req.IfState != "" && state != req.IfState {
+		return attachReply{Error: fmt.Sprintf("state is %s, not %s", state, req.IfState), State: state}
+	}
+	for i, piece := range req.Input {
+		// Pause between pieces so a key after text is not taken as part of a paste
+		if i > 0 {
+			time.Sleep(sendPieceDelay)
+		}
+		if err := s.input([]byte(piece)); err != nil {
+			return attachReply{Error: err.Error(), State: state}
+		}
+	}
+	return attachReply{OK: true, State: state}
+}
+
+// writeAttachReply sends the handshake answer
+func writeAttachReply(conn net.Conn, reply attachReply) error {
+	data, err := json.Marshal(reply)
+	if err != nil {
+		return err
+	}
+	conn.SetWriteDeadline(time.Now().Add(eventWriteTimeout))
+	_, err = conn.Write(append(data, '\n'))
+	return err
+}
+
+// readInput forwards a read-write client's keystrokes to the command
+func (s *ptyServer) readInput(r io.Reader) {
+	buf := make([]byte, 1024)
+	for {
+		n, err := r.Read(buf)
+		if n > 0 {
+			if s.input(buf[:n]) != nil {
+				return
+			}
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// writeLoop sends queued output to one client
+func (s *ptyServer) writeLoop(c *ptyClient) {
+	defer c.conn.Close()
+	for chunk := range c.ch {
+		c.conn.SetWriteDeadline(time.Now().Add(eventWriteTimeout))
+		if _, err := c.conn.Write(chunk); err != nil {
+			s.drop(c)
+			return
+		}
+	}
+}
+
+// drop disconnects a client
+func (s *ptyServer) drop(c *ptyClient) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.clients[c]; ok {
+		delete(s.clients, c)
+		close(c.ch)
+	}
+}
+
+// Publish writes output to the virtual terminal and sends it to every
+// client; slow clients are dropped. Both happen under the lock that
+// registers clients, so a new client's repaint and its live output line up.
+func (s *ptyServer) Publish(p []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.screen.Write(p)
+	if s.closed || len(s.clients) == 0 {
+		return
+	}
+	chunk := append([]byte(nil), p...)
+	for c := range s.clients {
+		select {
+		case c.ch <- chunk:
+		default:
+			delete(s.clients, c)
+			close(c.ch)
+		}
+	}
+}
+
+// Close disconnects all clients and removes the socket
+func (s *ptyServer) Close() {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return
+	}
+	s.closed = true
+	for c := range s.clients {
+		delete(s.clients, c)
+		close(c.ch)
+	}
+	s.mu.Unlock()
+
+	s.listener.Close()
+	os.Remove(s.path)
+}
+
+// dialAttach connects to a wrapper's PTY socket and performs the handshake
+func dialAttach(path string, req attachRequest) (net.Conn, *bufio.Reader, *attachReply, error) {
+	conn, err := net.Dial("unix", path)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	data, _ := json.Marshal(req)
+	if _, err := conn.Write(append(data, '\n')); err != nil {
+		conn.Close()
+		return nil, nil, nil, err
+	}
+
+	conn.SetReadDeadline(time.Now().Add(attachHandshakeTimeout))
+	reader := bufio.NewReader(conn)
+	line, err := reader.ReadBytes('\n')
+	if err != nil {
+		conn.Close()
+		if errors.Is(err, io.EOF) {
+			return nil, nil, nil, errors.New("connection refused by the wrapper")
+		}
+		return nil, nil, nil, err
+	}
+	conn.SetReadDeadline(time.Time{})
+
+	var reply attachReply
+	if err := json.Unmarshal(line, &reply); err != nil {
+		conn.Close()
+		return nil, nil, nil, err
+	}
+	if !reply.OK {
+		conn.Close()
+		return nil, nil, &reply, errors.New(reply.Error)
+	}
+	return conn, reader, &reply, nil
+}
+
+// runAttach handles kiromon attach <pid> [--rw]
+func runAttach(args []string) {
+	pid := 0
+	mode := AttachRead
+	for _, arg := range args {
+		switch arg {
+		case "--rw", "-rw":
+			mode = AttachWrite
+		default:
+			n, err := strconv.Atoi(arg)
+			if err != nil || n <= 0 {
+				fmt.Fprintf(os.Stderr, "Invalid PID: %s\n", arg)
+				printWrapHint("attach")
+				os.Exit(1)
+			}
+			pid = n
+		}
+	}
+	if pid == 0 {
+		fmt.Fprintln(os.Stderr, "Error: attach requires a PID (see kiromon -l)")
+		os.Exit(1)
+	}
+
+	filePath, err := findStatusFileByPID(pid)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "No status found for PID %d\n", pid)
+		os.Exit(1)
+	}
+	conn, reader, reply, err := dialAttach(getAttachSocketPath(filePath), attachRequest{Mode: mode})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: cannot attach to PID %d: %v\n", pid, err)
+		os.Exit(1)
+	}
+	defer conn.Close()
+
+	inFd := int(os.Stdin.Fd())
+	if term.IsTerminal(inFd) {
+		if cols, rows, err := term.GetSize(inFd); err == nil && (cols != reply.Cols || rows != reply.Rows) {
+			fmt.Fprintf(os.Stderr, "Note: session is %dx%d, this terminal is %dx%d\r\n", reply.Cols, reply.Rows, cols, rows)
+		}
+		oldState, err := term.MakeRaw(inFd)
+		if err == nil {
+			defer term.Restore(inFd, oldState)
+		}
+	}
+	access := "read-only"
+	if mode == AttachWrite {
+		access = "read-write"
+	}
+	fmt.Fprintf(os.Stderr, "[attached to PID %d (%s), Ctrl-] to detach]\r\n", pid, access)
+
+	done := make(chan string, 2)
+	go func() {
+		io.Copy(os.Stdout, reader)
+		done <- "session ended"
+	}()
+	go func() {
+		buf := make([]byte, 1024)
+		for {
+			n, err := os.Stdin.Read(buf)
+			if err != nil {
+				return
+			}
+			data := buf[:n]
+			if i := bytes.IndexByte(data, attachDetachKey); i >= 0 {
+				if mode == AttachWrite && i > 0 {
+					conn.Write(data[:i])
+				}
+				done <- "detached"
+				return
+			}
+			if mode == AttachWrite {
+				if _, err := conn.Write(data); err != nil {
+					return
+				}
+			}
+		}
+	}()
+
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, syscall.SIGTERM, syscall.SIGHUP)
+	defer signal.Stop(sigCh)
+
+	var reason string
+	select {
+	case reason = <-done:
+	case <-sigCh:
+		reason = "detached"
+	}
+	fmt.Fprintf(os.Stderr, "\x1b[0m\r\n[%s]\r\n", reason)
+}
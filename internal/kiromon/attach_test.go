@@ -0,0 +1,114 @@
+package kiromon
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// readUntil reads from r until the accumulated output contains want
+func readUntil(t *testing.T, conn net.Conn, r io.Reader, want string) string {
+	t.Helper()
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	var got strings.Builder
+	buf := make([]byte, 256)
+	for !strings.Contains(got.String(), want) {
+		n, err := r.Read(buf)
+		got.Write(buf[:n])
+		if err != nil {
+			t.Fatalf("reading %q: %v (got %q)", want, err, got.String())
+		}
+	}
+	return got.String()
+}
+
+func TestGetAttachSocketPath(t *testing.T) {
+	if got := getAttachSocketPath("/run/kiromon/kiro-cli-123.json"); got != "/run/kiromon/kiro-cli-123.pty.sock" {
+		t.Errorf("getAttachSocketPath() = %q", got)
+	}
+}
+
+func TestPTYServer(t *testing.T) {
+	// Unix socket paths are length-limited, so avoid the long t.TempDir()
+	dir, err := os.MkdirTemp("", "km")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "test-1.pty.sock")
+
+	screen := newVTScreen(4, 20, nil)
+	screen.Write([]byte("hello\r\n> "))
+	input := make(chan string, 4)
+	server, err := newPTYServer(path, screen, func(p []byte) error {
+		input <- string(p)
+		return nil
+	}, func() string { return StateWaiting }, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+
+	// A read-only viewer first gets the current screen, then live output
+	conn, reader, reply, err := dialAttach(path, attachRequest{Mode: AttachRead})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if reply.Rows != 4 || reply.Cols != 20 {
+		t.Errorf("reply = %+v", reply)
+	}
+	if got := readUntil(t, conn, reader, "\x1b[2;3H"); !strings.Contains(got, "hello\r\n>") {
+		t.Errorf("repaint = %q", got)
+	}
+	server.Publish([]byte("working"))
+	readUntil(t, conn, reader, "working")
+
+	// Keystrokes from a read-only viewer are ignored
+	conn.Write([]byte("ignored"))
+
+	// A read-write client's keystrokes reach the command
+	rw, rwReader, _, err := dialAttach(path, attachRequest{Mode: AttachWrite})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rw.Close()
+	// Published output is part of the repaint of clients attaching later
+	readUntil(t, rw, rwReader, "> working")
+	rw.Write([]byte("y\r"))
+	select {
+	case got := <-input:
+		if got != "y\r" {
+			t.Errorf("input = %q", got)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("input was not forwarded")
+	}
+	server.Publish([]byte("done"))
+	readUntil(t, rw, rwReader, "done")
+
+	// Unknown requests are answered with an error
+	if _, _, _, err := dialAttach(path, attachRequest{Mode: "admin"}); err == nil || !strings.Contains(err.Error(), "unknown request") {
+		t.Errorf("dialAttach(admin) error = %v", err)
+	}
+
+	// Closing the server ends the stream
+	server.Close()
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	if _, err := io.ReadAll(bufio.NewReader(reader)); err != nil {
+		t.Errorf("stream did not end cleanly: %v", err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Error("socket was not removed")
+	}
+	select {
+	case got := <-input:
+		t.Errorf("read-only input forwarded: %q", got)
+	default:
+	}
+}
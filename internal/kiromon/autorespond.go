@@ -0,0 +1,204 @@
+package kiromon
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// What a waiting command is waiting for, as written to the status file
+const (
+	WaitingForTask     = "task"
+	WaitingForApproval = "approval"
+)
+
+// DefaultApprovalPattern recognizes confirmation prompts such as kiro-cli's "Allow this action? [y/n/t]"
+const DefaultApprovalPattern = `(?i)allow this action|\[y/n(/t)?\]|\(y/n\)`
+
+// DefaultAutoRespondCooldown is the minimum time between two responses of one rule
+const DefaultAutoRespondCooldown = 2 * time.Second
+
+// autoRespondScanLines is how many of the last visible lines rules and the approval pattern look at
+const autoRespondScanLines = 5
+
+// AutoRespondRule answers a recurring prompt with keystrokes
+type AutoRespondRule struct {
+	Name     string        `yaml:"name"`
+	Match    string        `yaml:"match"`     // regex on the last lines of the screen
+	Send     string        `yaml:"send"`      // text typed first
+	Keys     []string      `yaml:"keys"`      // key names typed after the text, as in kiromon send -k
+	MaxFires int           `yaml:"max_fires"` // 0 means unlimited
+	Cooldown time.Duration `yaml:"cooldown"`
+}
+
+// autoRule is a compiled AutoRespondRule with its firing history
+type autoRule struct {
+	name     string
+	match    *regexp.Regexp
+	input    []string
+	maxFires int
+	cooldown time.Duration
+	fires    int
+	last     time.Time
+}
+
+// autoResponse is one automatic answer chosen by the responder
+type autoResponse struct {
+	Rule  string
+	Line  string // screen line the rule matched
+	Input []string
+	Fire  int // 1 for the rule's first response
+	Max   int
+}
+
+// autoResponder evaluates auto-respond rules against the screen
+type autoResponder struct {
+	mu       sync.Mutex
+	rules    []*autoRule
+	approval *regexp.Regexp
+	total    int
+	answered bool // a response was typed in the current waiting period
+}
+
+// newAutoResponder compiles the rules and approval pattern of a preset.
+// An empty approval pattern uses DefaultApprovalPattern.
+func newAutoResponder(rules []AutoRespondRule, approvalPattern string) (*autoResponder, error) {
+	if approvalPattern == "" {
+		approvalPattern = DefaultApprovalPattern
+	}
+	approval, err := regexp.Compile(approvalPattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid approval_pattern: %w", err)
+	}
+	r := &autoResponder{approval: approval}
+
+	for i, rule := range rules {
+		name := rule.Name
+		if name == "" {
+			name = fmt.Sprintf("rule %d", i+1)
+		}
+		if rule.Match == "" {
+			return nil, fmt.Errorf("auto_respond %s: match is required", name)
+		}
+		re, err := regexp.Compile(rule.Match)
+		if err != nil {
+			return nil, fmt.Errorf("auto_respond %s: invalid match: %w", name, err)
+		}
+		var input []string
+		if rule.Send != "" {
+			input = append(input, rule.Send)
+		}
+		for _, key := range rule.Keys {
+			b, err := keyBytes(key)
+			if err != nil {
+				return nil, fmt.Errorf("auto_respond %s: %w", name, err)
+			}
+			input = append(input, b)
+		}
+		if len(input) == 0 {
+			return nil, fmt.Errorf("auto_respond %s: send or keys is required", name)
+		}
+		cooldown := rule.Cooldown
+		if cooldown <= 0 {
+			cooldown = DefaultAutoRespondCooldown
+		}
+		r.rules = append(r.rules, &autoRule{
+			name:     name,
+			match:    re,
+			input:    input,
+			maxFires: rule.MaxFires,
+			cooldown: cooldown,
+		})
+	}
+	return r, nil
+}
+
+// Respond returns the response to type for the screen, or nil. Rules are
+// only evaluated while the command is waiting, and at most one response is
+// typed until it runs again, so a prompt the command did not accept is left
+// to the user. The first matching rule that is neither cooling down nor
+// used up fires.
+func (r *autoResponder) Respond(state string, now time.Time, screen []string) *autoResponse {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if state != StateWaiting {
+		r.answered = false
+		return nil
+	}
+	if r.answered {
+		return nil
+	}
+	screen = lastLines(screen, autoRespondScanLines)
+	for _, rule := range r.rules {
+		line, ok := matchLine(rule.match, screen)
+		if !ok {
+			continue
+		}
+		if rule.maxFires > 0 && rule.fires >= rule.maxFires || now.Sub(rule.last) < rule.cooldown {
+			continue
+		}
+		rule.fires++
+		rule.last = now
+		r.total++
+		r.answered = true
+		return &autoResponse{Rule: rule.name, Line: line, Input: rule.input, Fire: rule.fires, Max: rule.maxFires}
+	}
+	return nil
+}
+
+// WaitingFor tells whether a waiting screen asks for approval or for a new task
+func (r *autoResponder) WaitingFor(screen []string) string {
+	screen = lastLines(screen, autoRespondScanLines)
+	if _, ok := matchLine(r.approval, screen); ok {
+		return WaitingForApproval
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, rule := range r.rules {
+		if _, ok := matchLine(rule.match, screen); ok {
+			return WaitingForApproval
+		}
+	}
+	return WaitingForTask
+}
+
+// Total returns how many responses have been typed
+func (r *autoResponder) Total() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.total
+}
+
+// String describes the response for logs, e.g. `allow-read: sent "t" "\r" (2/5) for "Allow this action? [y/n/t]"`
+func (a *autoResponse) String() string {
+	count := strconv.Itoa(a.Fire)
+	if a.Max > 0 {
+		count = fmt.Sprintf("%d/%d", a.Fire, a.Max)
+	}
+	sent := make([]string, len(a.Input))
+	for i, p := range a.Input {
+		sent[i] = strconv.Quote(p)
+	}
+	return fmt.Sprintf("%s: sent %s (%s) for %q", a.Rule, strings.Join(sent, " "), count, a.Line)
+}
+
+// lastLines returns at most the last n lines
+func lastLines(lines []string, n int) []string {
+	if len(lines) > n {
+		return lines[len(lines)-n:]
+	}
+	return lines
+}
+
+// matchLine returns the last line matching re, the one nearest the cursor
+func matchLine(re *regexp.Regexp, lines []string) (string, bool) {
+	for i := len(lines) - 1; i >= 0; i-- {
+		if re.MatchString(lines[i]) {
+			return lines[i], true
+		}
+	}
+	return "", false
+}
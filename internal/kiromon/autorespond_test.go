@@ -0,0 +1,81 @@
+package kiromon
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestAutoResponder(t *testing.T) {
+	r, err := newAutoResponder([]AutoRespondRule{
+		{Name: "trust", Match: `Allow this action\? \[y/n/t\]`, Send: "t", Keys: []string{"Enter"}, MaxFires: 2, Cooldown: 5 * time.Second},
+	}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	prompt := []string{"Running tool fs_read", "Allow this action? [y/n/t]:"}
+	start := time.Now()
+
+	// Rules only fire while waiting
+	if a := r.Respond(StateRunning, start, prompt); a != nil {
+		t.Errorf("responded while running: %v", a)
+	}
+	a := r.Respond(StateWaiting, start, prompt)
+	if a == nil || a.Rule != "trust" || a.Line != prompt[1] || !reflect.DeepEqual(a.Input, []string{"t", "\r"}) {
+		t.Fatalf("Respond() = %+v", a)
+	}
+	if got := a.String(); got != `trust: sent "t" "\r" (1/2) for "Allow this action? [y/n/t]:"` {
+		t.Errorf("String() = %s", got)
+	}
+
+	// A prompt that is still waiting after the response is left alone
+	if a := r.Respond(StateWaiting, start.Add(10*time.Second), prompt); a != nil {
+		t.Errorf("responded twice in one waiting period: %v", a)
+	}
+
+	// The cooldown and max_fires limit further responses
+	r.Respond(StateRunning, start.Add(time.Second), nil)
+	if a := r.Respond(StateWaiting, start.Add(time.Second), prompt); a != nil {
+		t.Errorf("responded during cooldown: %v", a)
+	}
+	if a := r.Respond(StateWaiting, start.Add(6*time.Second), prompt); a == nil || a.Fire != 2 {
+		t.Errorf("second response = %+v", a)
+	}
+	r.Respond(StateRunning, start.Add(7*time.Second), nil)
+	if a := r.Respond(StateWaiting, start.Add(20*time.Second), prompt); a != nil {
+		t.Errorf("responded past max_fires: %v", a)
+	}
+	if r.Total() != 2 {
+		t.Errorf("Total() = %d, want 2", r.Total())
+	}
+
+	// Confirmation prompts are told apart from the task prompt
+	if got := r.WaitingFor(prompt); got != WaitingForApproval {
+		t.Errorf("WaitingFor(approval) = %q", got)
+	}
+	if got := r.WaitingFor([]string{"Delete 3 files? (y/n)"}); got != WaitingForApproval {
+		t.Errorf("WaitingFor(y/n) = %q", got)
+	}
+	if got := r.WaitingFor([]string{"Done.", "> "}); got != WaitingForTask {
+		t.Errorf("WaitingFor(task) = %q", got)
+	}
+}
+
+func TestNewAutoResponderErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		rules    []AutoRespondRule
+		approval string
+	}{
+		{"no match", []AutoRespondRule{{Send: "y"}}, ""},
+		{"bad match", []AutoRespondRule{{Match: "(", Send: "y"}}, ""},
+		{"bad key", []AutoRespondRule{{Match: "ok", Keys: []string{"Hyper"}}}, ""},
+		{"nothing to send", []AutoRespondRule{{Match: "ok"}}, ""},
+		{"bad approval", nil, "("},
+	}
+	for _, tt := range tests {
+		if _, err := newAutoResponder(tt.rules, tt.approval); err == nil {
+			t.Errorf("%s: expected an error", tt.name)
+		}
+	}
+}
@@ -21,7 +21,12 @@ type MonitorOptions struct {
 	Command       string
 	StartMsg      string
 	EndMsg        string
+	ExitMsg       string
+	ErrMsg        string
+	Reminder      ReminderConfig
 	PromptPattern string
+	Webhook       string
+	Format        string // FormatJSON or FormatNDJSON; empty for text
 }
 
 // parseMonitorOptions parses common monitor options from args
@@ -81,6 +86,58 @@ func parseMonitorOptions(args []string) *MonitorOptions {
 				fmt.Fprintln(os.Stderr, "Error: -me requires a message")
 				os.Exit(1)
 			}
+		case "-mx":
+			if i+1 < len(args) && !strings.HasPrefix(args[i+1], "-") {
+				i++
+				opts.ExitMsg = args[i]
+			} else {
+				fmt.Fprintln(os.Stderr, "Error: -mx requires a message")
+				os.Exit(1)
+			}
+		case "-merr":
+			if i+1 < len(args) && !strings.HasPrefix(args[i+1], "-") {
+				i++
+				opts.ErrMsg = args[i]
+			} else {
+				fmt.Fprintln(os.Stderr, "Error: -merr requires a message")
+				os.Exit(1)
+			}
+		case "-remind":
+			if i+1 < len(args) && !strings.HasPrefix(args[i+1], "-") {
+				i++
+				intervals, err := parseReminderIntervals(args[i])
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "Invalid -remind: %v\n", err)
+					os.Exit(1)
+				}
+				opts.Reminder.Intervals = intervals
+			} else {
+				fmt.Fprintln(os.Stderr, "Error: -remind requires intervals (e.g., 5m,15m,30m)")
+				os.Exit(1)
+			}
+		case "-remind-max":
+			if i+1 < len(args) {
+				i++
+				if _, err := fmt.Sscanf(args[i], "%d", &opts.Reminder.Max); err != nil {
+					fmt.Fprintf(os.Stderr, "Invalid count: %s\n", args[i])
+					os.Exit(1)
+				}
+			} else {
+				fmt.Fprintln(os.Stderr, "Error: -remind-max requires a number")
+				os.Exit(1)
+			}
+		case "-w":
+			if i+1 < len(args) && !strings.HasPrefix(args[i+1], "-") {
+				i++
+				opts.Webhook = args[i]
+			} else {
+				fmt.Fprintln(os.Stderr, "Error: -w requires a URL")
+				os.Exit(1)
+			}
+		case "--json":
+			opts.Format = FormatJSON
+		case "--ndjson":
+			opts.Format = FormatNDJSON
 		case "-r":
 			if i+1 < len(args) && !strings.HasPrefix(args[i+1], "-") {
 				i++
@@ -109,31 +166,70 @@ func parseMonitorOptions(args []string) *MonitorOptions {
 func printUsage() {
 	fmt.Fprintln(os.Stderr, "Usage:")
 	fmt.Fprintln(os.Stderr, "  kiromon <command> [args...]       - Run command with monitoring")
+	fmt.Fprintln(os.Stderr, "  kiromon -- <command> [args...]    - Same, for commands named like a subcommand (e.g. kiromon -- top)")
+	fmt.Fprintln(os.Stderr, "  kiromon -rec <file> [-rec-input] <command> [args...]")
+	fmt.Fprintln(os.Stderr, "                                    - Also record the session as an asciicast v2 file")
 	fmt.Fprintln(os.Stderr, "  kiromon -s <name>                 - Show status of all instances")
 	fmt.Fprintln(os.Stderr, "  kiromon -s <name> -p <pid>        - Show status of specific PID")
 	fmt.Fprintln(os.Stderr, "  kiromon -p <pid>                  - Show status by PID only")
 	fmt.Fprintln(os.Stderr, "  kiromon -s <name> -d              - Daemon mode (monitor all instances)")
 	fmt.Fprintln(os.Stderr, "  kiromon -p <pid> -d               - Daemon mode (monitor specific PID)")
-	fmt.Fprintln(os.Stderr, "  kiromon -s <name> -d -i <sec>     - Set polling interval (default: 2s)")
+	fmt.Fprintln(os.Stderr, "  kiromon -s <name> -d -i <sec>     - Set polling interval (default: 2s, 10s when watching)")
 	fmt.Fprintln(os.Stderr, "  kiromon -s <name> -d -c <cmd>     - Run command on state change")
 	fmt.Fprintln(os.Stderr, "  kiromon -s <name> -d -c <cmd> -ms <msg> -me <msg>  - Custom messages")
 	fmt.Fprintln(os.Stderr, "  kiromon -s <name> -d -r <regex>   - Custom prompt pattern for waiting state")
+	fmt.Fprintln(os.Stderr, "  kiromon -s <name> -d -w <url>     - POST state changes to a webhook")
+	fmt.Fprintln(os.Stderr, "  kiromon -s <name> -d -c <cmd> -remind 5m,15m  - Remind while an instance keeps waiting")
 	fmt.Fprintln(os.Stderr, "  kiromon -l                        - List all monitored processes")
+	fmt.Fprintln(os.Stderr, "  kiromon attach <pid> [--rw]       - Mirror a session's output (--rw: also send keystrokes; Ctrl-] detaches)")
+	fmt.Fprintln(os.Stderr, "  kiromon send <pid> [--if-waiting] [-k <key>] [-e] <text>...")
+	fmt.Fprintln(os.Stderr, "                                    - Type text and keys (Enter, Esc, Ctrl-C, ...) into a session")
+	fmt.Fprintln(os.Stderr, "  kiromon queue add <pid> [-f <file>] [<text>...] | list|clear|resume <pid>")
+	fmt.Fprintln(os.Stderr, "                                    - Queue prompts typed one by one each time the session waits")
+	fmt.Fprintln(os.Stderr, "  kiromon dnd [on|off|for <dur>|status]")
+	fmt.Fprintln(os.Stderr, "                                    - Do not disturb: hold back notifications of all instances (see quiet in config)")
+	fmt.Fprintln(os.Stderr, "  kiromon top [-sort <key>] [-f <text>] [-i <sec>]")
+	fmt.Fprintln(os.Stderr, "                                    - Live dashboard (sort: state, name, idle, task, pid)")
+	fmt.Fprintln(os.Stderr, "  kiromon -s|-p|-l ... --json       - Print status as one JSON document")
+	fmt.Fprintln(os.Stderr, "  kiromon -s|-p|-l ... --ndjson     - Print one JSON object per line (events in daemon mode)")
 	fmt.Fprintln(os.Stderr, "  kiromon -init                     - Create default config file")
+	fmt.Fprintln(os.Stderr, "  kiromon history [-cmd <text>] [-since <t>] [-until <t>] [-min <dur>] [-n <count>] [-stats] [--json|--ndjson]")
+	fmt.Fprintln(os.Stderr, "                                    - Show recorded tasks and duration statistics")
 	fmt.Fprintln(os.Stderr, "")
 	fmt.Fprintln(os.Stderr, "Standalone mode (run + monitor in one process):")
-	fmt.Fprintln(os.Stderr, "  kiromon -c <cmd> [-ms <msg>] [-me <msg>] [-log <path>] [-min-duration <dur>] [--] <command> [args...]")
+	fmt.Fprintln(os.Stderr, "  kiromon -c <cmd> [-w <url>] [-ms <msg>] [-me <msg>] [-mx <msg>] [-merr <msg>] [-log <path>] [-min-duration <dur>] [-max-task <dur>] [-remind <durs>] [-rec <file>] [--] <command> [args...]")
+	fmt.Fprintln(os.Stderr, "  kiromon -w <url> [-ms <msg>] [-me <msg>] ... [--] <command> [args...]")
 	fmt.Fprintln(os.Stderr, "")
 	fmt.Fprintln(os.Stderr, "Options:")
+	fmt.Fprintln(os.Stderr, "  -w <url>           POST state changes as JSON to a webhook (see config for slack/ntfy)")
 	fmt.Fprintln(os.Stderr, "  -ms <msg>          Message for task start (running state)")
 	fmt.Fprintln(os.Stderr, "  -me <msg>          Message for task end (waiting state)")
+	fmt.Fprintln(os.Stderr, "  -mx <msg>          Message when the command exits ({exit_code}, {signal})")
+	fmt.Fprintln(os.Stderr, "  -merr <msg>        Message when a task ends after an error line ({error_line}); default: -me")
 	fmt.Fprintln(os.Stderr, "                     If omitted, no notification for that state")
 	fmt.Fprintln(os.Stderr, "  -log <path>        Log file path (default: syslog only)")
 	fmt.Fprintln(os.Stderr, "  -min-duration <d>  Minimum task duration to trigger notification (e.g., 5s)")
+	fmt.Fprintln(os.Stderr, "  -max-task <d>      Send a stuck notification when a task runs longer (e.g., 15m)")
+	fmt.Fprintln(os.Stderr, "  -max-silence <d>   Send a stuck notification when a running task prints nothing for this long")
+	fmt.Fprintln(os.Stderr, "  -stuck-repeat <d>  Interval between repeated stuck notifications (default: the threshold)")
+	fmt.Fprintln(os.Stderr, "  -stuck-interrupt   Also send SIGINT to the command on the first stuck notification of a task")
+	fmt.Fprintln(os.Stderr, "  -remind <d,...>    Remind while waiting for input: after each interval, the last one repeating (e.g., 5m,15m,30m)")
+	fmt.Fprintln(os.Stderr, "  -remind-max <n>    Reminders per waiting period (default: 3, -1: unlimited)")
+	fmt.Fprintln(os.Stderr, "  -rec <file>        Record the session in asciicast v2 format with a marker per state change")
+	fmt.Fprintln(os.Stderr, "  -rec-input         Also record keystrokes (may capture passwords)")
 	fmt.Fprintln(os.Stderr, "")
 	fmt.Fprintln(os.Stderr, "Placeholders in messages:")
 	fmt.Fprintln(os.Stderr, "  {time}      Current time (xx時xx分xx秒)")
 	fmt.Fprintln(os.Stderr, "  {duration}  Task duration (xx時間xx分xx秒)")
+	fmt.Fprintln(os.Stderr, "  {exit_code} {signal}  Exit code and signal name (-mx only)")
+	fmt.Fprintln(os.Stderr, "  {transcript}          Output file of the finished task (-me, -mx; preset transcript)")
+	fmt.Fprintln(os.Stderr, "  {error_line}          Output line that marked the task as failed (-merr)")
+	fmt.Fprintln(os.Stderr, "")
+	fmt.Fprintln(os.Stderr, "Notification command (-c) may be a shell-quoted string with placeholders:")
+	fmt.Fprintln(os.Stderr, "  {message} {state} {pid} {command} {last_line} {time} {duration} {exit_code} {signal}")
+	fmt.Fprintln(os.Stderr, "  Without placeholders, the message is appended as the last argument.")
+	fmt.Fprintln(os.Stderr, "  KIROMON_STATE, KIROMON_PID, KIROMON_COMMAND, KIROMON_MESSAGE, KIROMON_LAST_LINE,")
+	fmt.Fprintln(os.Stderr, "  KIROMON_TIME, KIROMON_TASK_START, KIROMON_DURATION_SECONDS are set in its environment.")
 	fmt.Fprintln(os.Stderr, "")
 	fmt.Fprintln(os.Stderr, "Examples:")
 	fmt.Fprintln(os.Stderr, "  kiromon kiro-cli chat")
@@ -143,6 +239,7 @@ func printUsage() {
 	fmt.Fprintln(os.Stderr, "  kiromon -c notify-send -me \"完了\" kiro-cli chat  # End only")
 	fmt.Fprintln(os.Stderr, "  kiromon -s kiro-cli -d -r '> ?$'  # Custom prompt pattern")
 	fmt.Fprintln(os.Stderr, "  kiromon -c say -ms \"開始\" -me \"完了\" kiro-cli chat  # Standalone")
+	fmt.Fprintln(os.Stderr, "  kiromon -c 'notify-send -u critical -a kiromon \"{state}\" \"{message}\"' -me \"完了\" kiro-cli chat")
 }
 
 // runStandalone runs in standalone mode (wrapper + notification in one process)
@@ -150,21 +247,35 @@ func runStandalone() {
 	command := ""
 	startMsg := ""
 	endMsg := ""
+	exitMsg := ""
+	errMsg := ""
 	logPath := ""
+	webhookURL := ""
 	var minDuration time.Duration
+	var watchdog WatchdogConfig
+	var reminder ReminderConfig
 	var cmdArgs []string
 
-	// First, get the command after -c (os.Args[1] is "-c")
-	if len(os.Args) < 3 {
-		fmt.Fprintln(os.Stderr, "Error: -c requires a command")
-		os.Exit(1)
-	}
-	command = os.Args[2]
-
-	// Parse remaining options
-	args := os.Args[3:]
+	// Parse options (os.Args[1] is "-c" or "-w")
+	args := os.Args[1:]
 	for i := 0; i < len(args); i++ {
 		switch args[i] {
+		case "-c":
+			if i+1 < len(args) {
+				i++
+				command = args[i]
+			} else {
+				fmt.Fprintln(os.Stderr, "Error: -c requires a command")
+				os.Exit(1)
+			}
+		case "-w":
+			if i+1 < len(args) {
+				i++
+				webhookURL = args[i]
+			} else {
+				fmt.Fprintln(os.Stderr, "Error: -w requires a URL")
+				os.Exit(1)
+			}
 		case "--":
 			// Everything after -- is the command to run
 			if i+1 < len(args) {
@@ -187,6 +298,32 @@ func runStandalone() {
 				fmt.Fprintln(os.Stderr, "Error: -me requires a message")
 				os.Exit(1)
 			}
+		case "-mx":
+			if i+1 < len(args) {
+				i++
+				exitMsg = args[i]
+			} else {
+				fmt.Fprintln(os.Stderr, "Error: -mx requires a message")
+				os.Exit(1)
+			}
+		case "-merr":
+			if i+1 < len(args) {
+				i++
+				errMsg = args[i]
+			} else {
+				fmt.Fprintln(os.Stderr, "Error: -merr requires a message")
+				os.Exit(1)
+			}
+		case "-rec":
+			if i+1 < len(args) {
+				i++
+				recordOptions.Path = args[i]
+			} else {
+				fmt.Fprintln(os.Stderr, "Error: -rec requires a file path")
+				os.Exit(1)
+			}
+		case "-rec-input":
+			recordOptions.Input = true
 		case "-log":
 			if i+1 < len(args) {
 				i++
@@ -208,6 +345,52 @@ func runStandalone() {
 				fmt.Fprintln(os.Stderr, "Error: -min-duration requires a duration (e.g., 5s)")
 				os.Exit(1)
 			}
+		case "-max-task", "-max-silence", "-stuck-repeat":
+			if i+1 < len(args) {
+				i++
+				d, err := time.ParseDuration(args[i])
+				if err != nil || d <= 0 {
+					fmt.Fprintf(os.Stderr, "Invalid duration: %s\n", args[i])
+					os.Exit(1)
+				}
+				switch args[i-1] {
+				case "-max-task":
+					watchdog.MaxTask = d
+				case "-max-silence":
+					watchdog.MaxSilence = d
+				default:
+					watchdog.Repeat = d
+				}
+			} else {
+				fmt.Fprintf(os.Stderr, "Error: %s requires a duration (e.g., 15m)\n", args[i])
+				os.Exit(1)
+			}
+		case "-stuck-interrupt":
+			watchdog.Interrupt = true
+		case "-remind":
+			if i+1 < len(args) {
+				i++
+				intervals, err := parseReminderIntervals(args[i])
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "Invalid -remind: %v\n", err)
+					os.Exit(1)
+				}
+				reminder.Intervals = intervals
+			} else {
+				fmt.Fprintln(os.Stderr, "Error: -remind requires intervals (e.g., 5m,15m,30m)")
+				os.Exit(1)
+			}
+		case "-remind-max":
+			if i+1 < len(args) {
+				i++
+				if _, err := fmt.Sscanf(args[i], "%d", &reminder.Max); err != nil {
+					fmt.Fprintf(os.Stderr, "Invalid count: %s\n", args[i])
+					os.Exit(1)
+				}
+			} else {
+				fmt.Fprintln(os.Stderr, "Error: -remind-max requires a number")
+				os.Exit(1)
+			}
 		default:
 			// First non-option is the command to run
 			if !strings.HasPrefix(args[i], "-") {
@@ -217,8 +400,8 @@ func runStandalone() {
 		}
 	}
 
-	if command == "" {
-		fmt.Fprintln(os.Stderr, "Error: -c <command> is required for standalone mode")
+	if command == "" && webhookURL == "" {
+		fmt.Fprintln(os.Stderr, "Error: -c <command> or -w <url> is required for standalone mode")
 		os.Exit(1)
 	}
 
@@ -227,11 +410,24 @@ func runStandalone() {
 		os.Exit(1)
 	}
 
+	notifyCommand, err := parseCommandTemplate(command)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid command: %v\n", err)
+		os.Exit(1)
+	}
+	var webhook *WebhookConfig
+	if webhookURL != "" {
+		webhook = &WebhookConfig{URL: webhookURL}
+	}
+
 	// Apply preset if available and options not explicitly set
 	cmdName := filepath.Base(cmdArgs[0])
 	if preset := getPreset(cmdName); preset != nil {
-		if command == "" && preset.Command != "" {
-			command = preset.Command
+		if len(notifyCommand) == 0 && len(preset.Command) > 0 {
+			notifyCommand = preset.Command
+		}
+		if webhook == nil {
+			webhook = preset.Webhook
 		}
 		if startMsg == "" {
 			startMsg = preset.StartMsg
@@ -239,12 +435,20 @@ func runStandalone() {
 		if endMsg == "" {
 			endMsg = preset.EndMsg
 		}
+		if exitMsg == "" {
+			exitMsg = preset.ExitMsg
+		}
+		if errMsg == "" {
+			errMsg = preset.ErrMsg
+		}
+		watchdog = watchdog.withDefaults(preset.Watchdog)
+		reminder = reminder.withDefaults(preset.Reminder)
 	}
 
 	// Apply config file defaults
 	if config := loadConfig(); config != nil {
-		if command == "" && config.DefaultCommand != "" {
-			command = config.DefaultCommand
+		if len(notifyCommand) == 0 && len(config.DefaultCommand) > 0 {
+			notifyCommand = config.DefaultCommand
 		}
 		if logPath == "" && config.LogPath != "" {
 			logPath = config.LogPath
@@ -267,12 +471,17 @@ func runStandalone() {
 	}
 
 	config := &StandaloneConfig{
-		Command:       command,
+		Command:       notifyCommand,
 		StartMsg:      startMsg,
 		EndMsg:        endMsg,
+		ExitMsg:       exitMsg,
+		ErrMsg:        errMsg,
+		Watchdog:      &watchdog,
+		Reminder:      &reminder,
 		LogFile:       logFile,
 		Syslog:        syslogWriter,
 		MinDuration:   minDuration,
+		Webhook:       webhook,
 	}
 
 	runWrapper(cmdArgs, config)
@@ -283,14 +492,14 @@ func showStatus() {
 	opts := parseMonitorOptions(os.Args[2:])
 
 	if opts.Name == "" {
-		listProcesses()
+		listProcesses(opts.Format)
 		return
 	}
 
 	if opts.Daemon {
-		runStatusDaemon(opts.Name, opts.PID, opts.Interval, opts.Command, opts.StartMsg, opts.EndMsg, opts.PromptPattern)
+		runStatusDaemon(opts.Name, opts)
 	} else {
-		showSingleStatus(opts.Name, opts.PID)
+		showSingleStatus(opts.Name, opts.PID, opts.Format)
 	}
 }
 
@@ -328,19 +537,23 @@ func showStatusByPID() {
 	name := strings.TrimSuffix(baseName, fmt.Sprintf("-%d.json", opts.PID))
 
 	if opts.Daemon {
-		runStatusDaemon(name, opts.PID, opts.Interval, opts.Command, opts.StartMsg, opts.EndMsg, opts.PromptPattern)
+		runStatusDaemon(name, opts)
 	} else {
 		status, err := readStatusWithLock(filePath)
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "Error reading status: %v\n", err)
 			os.Exit(1)
 		}
+		if opts.Format != "" {
+			writeReports(os.Stdout, opts.Format, []ProcessReport{newProcessReport(name, status)})
+			return
+		}
 		printStatus(name, status)
 	}
 }
 
 // showSingleStatus shows status for a single process or all matching processes
-func showSingleStatus(name string, pid int) {
+func showSingleStatus(name string, pid int, format string) {
 	// If PID specified, look for exact file
 	if pid > 0 {
 		statusFile := getStatusFileWithPID(name, pid)
@@ -349,6 +562,10 @@ func showSingleStatus(name string, pid int) {
 			fmt.Fprintf(os.Stderr, "No status found for '%s' with PID %d\n", name, pid)
 			os.Exit(1)
 		}
+		if format != "" {
+			writeReports(os.Stdout, format, []ProcessReport{newProcessReport(name, status)})
+			return
+		}
 		printStatus(name, status)
 		return
 	}
@@ -375,46 +592,136 @@ func showSingleStatus(name string, pid int) {
 	}
 
 	// Show all matching processes
+	var reports []ProcessReport
 	for _, f := range found {
 		status, err := readStatusWithLock(f)
 		if err != nil {
 			continue
 		}
 		// Check if process is still alive
-		if syscall.Kill(status.PID, 0) != nil {
+		if status.State != StateStopped && syscall.Kill(status.PID, 0) != nil {
 			os.Remove(f)
 			continue
 		}
+		if format != "" {
+			reports = append(reports, newProcessReport(name, status))
+			continue
+		}
 		printStatus(name, status)
 		fmt.Println()
 	}
+	if format != "" {
+		writeReports(os.Stdout, format, reports)
+	}
 }
 
 // runStatusDaemon runs in daemon mode, monitoring status files
-func runStatusDaemon(name string, pid int, interval float64, command string, startMsg string, endMsg string, promptPattern string) {
+func runStatusDaemon(name string, opts *MonitorOptions) {
+	pid, interval, promptPattern := opts.PID, opts.Interval, opts.PromptPattern
+	startMsg, endMsg, exitMsg, errMsg := opts.StartMsg, opts.EndMsg, opts.ExitMsg, opts.ErrMsg
+	reminder := opts.Reminder
+
+	// A stream of state changes has no single document, so --json logs NDJSON too
+	daemonFormat = FormatText
+	if opts.Format != "" {
+		daemonFormat = FormatNDJSON
+	}
+	out := daemonOutput()
+
 	// Find all status files for this name
 	dir := getStatusDir()
 
+	notifyCommand, err := parseCommandTemplate(opts.Command)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid command: %v\n", err)
+		os.Exit(1)
+	}
+
+	// Webhook from -w, or from the preset for this command name
+	var webhook *WebhookConfig
+	var notifiers []SinkConfig
+	var stuckMsg string
+	preset := getPreset(name)
+	if opts.Webhook != "" {
+		webhook = &WebhookConfig{URL: opts.Webhook}
+	} else if preset != nil {
+		webhook = preset.Webhook
+	}
+	if preset != nil {
+		notifiers = preset.Notifiers
+		if exitMsg == "" {
+			exitMsg = preset.ExitMsg
+		}
+		if errMsg == "" {
+			errMsg = preset.ErrMsg
+		}
+		reminder = reminder.withDefaults(preset.Reminder)
+		if preset.Watchdog != nil {
+			stuckMsg = preset.Watchdog.Message
+		}
+	}
+	// Stuck alerts only come from wrappers with a watchdog configured
+	events := addSinkEvent(failedSinkEvents(exitSinkEvents(exitMsg), errMsg), EventStuck)
+	if reminder.enabled() {
+		events = addSinkEvent(events, EventRemind)
+	}
+	sinks, err := buildSinks(notifyCommand, webhook, events, notifiers, daemonLog)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid notifier: %v\n", err)
+		os.Exit(1)
+	}
+
 	// Compile custom prompt pattern if provided
 	var customPromptRe *regexp.Regexp
 	if promptPattern != "" {
 		customPromptRe = regexp.MustCompile(promptPattern)
 	}
 
-	fmt.Printf("Monitoring %s", name)
+	// Watch the status directory so changes are noticed immediately;
+	// polling then only acts as a safety net
+	watcher, err := newDirWatcher(dir)
+	if err == nil {
+		defer watcher.Close()
+		if interval == DefaultPollInterval {
+			interval = WatchPollInterval
+		}
+	}
+
+	fmt.Fprintf(out, "Monitoring %s", name)
 	if pid > 0 {
-		fmt.Printf(" (PID: %d)", pid)
+		fmt.Fprintf(out, " (PID: %d)", pid)
 	}
-	fmt.Printf(" (interval: %.1fs)\n", interval)
+	fmt.Fprintf(out, " (interval: %.1fs)\n", interval)
 	if promptPattern != "" {
-		fmt.Printf("Prompt pattern: %s\n", promptPattern)
+		fmt.Fprintf(out, "Prompt pattern: %s\n", promptPattern)
+	}
+	if webhook != nil {
+		fmt.Fprintf(out, "Webhook: %s\n", webhook.URL)
 	}
-	if command != "" {
-		fmt.Printf("Command: %s\n", command)
-		fmt.Printf("  Start: %q\n", startMsg)
-		fmt.Printf("  End:   %q\n", endMsg)
+	if len(notifiers) > 0 {
+		fmt.Fprintf(out, "Notifiers: %d\n", len(notifiers))
 	}
-	fmt.Println(strings.Repeat("-", 50))
+	if len(sinks) > 0 {
+		if len(notifyCommand) > 0 {
+			fmt.Fprintf(out, "Command: %s\n", notifyCommand)
+		}
+		fmt.Fprintf(out, "  Start: %q\n", startMsg)
+		fmt.Fprintf(out, "  End:   %q\n", endMsg)
+		fmt.Fprintf(out, "  Exit:  %q\n", exitMsg)
+		if errMsg != "" {
+			fmt.Fprintf(out, "  Error: %q\n", errMsg)
+		}
+	}
+	if reminder.enabled() {
+		fmt.Fprintf(out, "Reminders: %v\n", reminder.Intervals)
+	}
+	if watcher != nil {
+		fmt.Fprintf(out, "Watching %s\n", dir)
+	}
+	if quiet := getQuietGate(); len(quiet.windows) > 0 || len(quiet.focus) > 0 {
+		fmt.Fprintf(out, "Quiet: %s (policy: %s)\n", quiet, quiet.policy)
+	}
+	fmt.Fprintln(out, strings.Repeat("-", 50))
 
 	ticker := time.NewTicker(time.Duration(interval * float64(time.Second)))
 	defer ticker.Stop()
@@ -422,35 +729,160 @@ func runStatusDaemon(name string, pid int, interval float64, command string, sta
 	// Handle Ctrl+C
 	sigCh := make(chan os.Signal, 1)
 	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(sigCh)
 
 	// Track state per PID
 	lastStates := make(map[int]string)
+	lastShown := make(map[int]string)
+	lastStuck := make(map[int]string)
 	taskStartTimes := make(map[int]time.Time)
+	lastStatus := make(map[int]*Status)
+	reminders := make(map[int]*waitReminder)
+
+	// Wrappers with an event socket push state changes; their status files
+	// are then only used to detect processes that died without saying so
+	socketEvents := make(chan socketMessage, 16)
+	subscribed := make(map[int]bool)
+	subscribe := func(pid int, filePath string) bool {
+		if subscribed[pid] {
+			return true
+		}
+		// -r matches the last line of every status update, while the socket
+		// only carries changes of the wrapper's own state
+		if customPromptRe != nil {
+			return false
+		}
+		if err := subscribeEvents(getSocketPath(filePath), pid, socketEvents); err != nil {
+			return false
+		}
+		subscribed[pid] = true
+		return true
+	}
+
+	// terminated reports a process that went away, once
+	terminated := func(status *Status) {
+		if lastStates[status.PID] == "terminated" {
+			return
+		}
+		text := fmt.Sprintf("PID %d terminated", status.PID)
+		if status.ExitCode != nil {
+			text += fmt.Sprintf(" (%s)", exitDescription(status))
+		}
+		logDaemonEvent(DaemonEvent{
+			Event:     DaemonTerminated,
+			PID:       status.PID,
+			PrevState: lastStates[status.PID],
+			Command:   status.Command,
+			LastLine:  status.LastLine,
+			ExitCode:  status.ExitCode,
+			Signal:    status.Signal,
+		}, text)
+		lastStates[status.PID] = "terminated"
+		notifyTerminated(status, lastShown[status.PID], sinks, exitMsg)
+		delete(lastShown, status.PID)
+		delete(lastStuck, status.PID)
+	}
+
+	// remindWaiting reminds about a process that keeps waiting for input
+	remindWaiting := func(status *Status) {
+		r, ok := reminders[status.PID]
+		if !ok {
+			r = newWaitReminder(&reminder)
+			reminders[status.PID] = r
+		}
+		state := lastStates[status.PID]
+		since := status.StateChangedAt
+		var lastInput time.Time
+		if status.LastInputAt != nil {
+			lastInput = *status.LastInputAt
+		}
+		due := r.Check(state, since, lastInput, time.Now())
+		if due == nil {
+			return
+		}
+		ev := NotifyEvent{
+			Event:     EventRemind,
+			State:     state,
+			PID:       status.PID,
+			Command:   status.Command,
+			Message:   fmt.Sprintf("PID %d (%s) が%s", status.PID, status.Command, due),
+			LastLine:  status.LastLine,
+			TaskStart: time.Now().Add(-due.Waited),
+			Time:      time.Now(),
+		}
+		if reminder.Message != "" {
+			ev.Message = ev.expand(reminder.Message)
+		}
+		logDaemonEvent(DaemonEvent{
+			Event:        DaemonRemind,
+			PID:          status.PID,
+			State:        state,
+			Command:      status.Command,
+			LastLine:     status.LastLine,
+			Notification: EventRemind,
+			Message:      ev.Message,
+		}, fmt.Sprintf("PID %d: 🔔 %s", status.PID, ev.Message))
+		dispatchNotification(sinks, ev, daemonLog)
+	}
+
+	// matches reports whether a status file name belongs to the monitored name or PID
+	prefix := name + "-"
+	exactFile := name + ".json"
+	matches := func(fileName string) bool {
+		if !strings.HasSuffix(fileName, ".json") {
+			return false
+		}
+		if pid > 0 {
+			return fileName == filepath.Base(getStatusFileWithPID(name, pid))
+		}
+		return fileName == exactFile || strings.HasPrefix(fileName, prefix)
+	}
+
+	// checkFile handles one status file and reports whether its process is alive
+	checkFile := func(filePath string) bool {
+		status, err := readStatusWithLock(filePath)
+		if err != nil {
+			return false
+		}
+
+		// A stopped tombstone is only news if the process was seen running
+		if status.State == StateStopped {
+			if _, seen := lastStates[status.PID]; seen {
+				terminated(status)
+			} else {
+				lastStates[status.PID] = "terminated"
+			}
+			return false
+		}
+
+		// Check if process is still running
+		if err := syscall.Kill(status.PID, 0); err != nil {
+			terminated(status)
+			os.Remove(filePath)
+			return false
+		}
+
+		lastStatus[status.PID] = status
+		if !subscribe(status.PID, filePath) {
+			checkAndNotify(status, customPromptRe, lastStates, lastShown, taskStartTimes, sinks, startMsg, endMsg, errMsg)
+			notifyStuck(status, lastStuck, taskStartTimes, sinks, stuckMsg)
+		}
+		remindWaiting(status)
+		return true
+	}
 
 	checkStatus := func() {
 		// If specific PID requested, only check that one
 		if pid > 0 {
 			filePath := getStatusFileWithPID(name, pid)
-			status, err := readStatusWithLock(filePath)
-			if err != nil {
-				if lastStates[pid] != "not_found" {
-					fmt.Printf("[%s] PID %d: not found\n", time.Now().Format("15:04:05"), pid)
+			if _, err := os.Stat(filePath); err != nil {
+				if lastStates[pid] != "not_found" && lastStates[pid] != "terminated" {
+					logDaemonEvent(DaemonEvent{Event: DaemonNotFound, PID: pid}, fmt.Sprintf("PID %d: not found", pid))
 					lastStates[pid] = "not_found"
 				}
 				return
 			}
-
-			// Check if process is still running
-			if err := syscall.Kill(status.PID, 0); err != nil {
-				if lastStates[pid] != "terminated" {
-					fmt.Printf("[%s] PID %d terminated\n", time.Now().Format("15:04:05"), pid)
-					lastStates[pid] = "terminated"
-				}
-				os.Remove(filePath)
-				return
-			}
-
-			checkAndNotify(status, customPromptRe, lastStates, taskStartTimes, command, startMsg, endMsg)
+			checkFile(filePath)
 			return
 		}
 
@@ -460,49 +892,62 @@ func runStatusDaemon(name string, pid int, interval float64, command string, sta
 			return
 		}
 
-		prefix := name + "-"
-		exactFile := name + ".json"
 		foundAny := false
-
 		for _, entry := range entries {
-			if !strings.HasSuffix(entry.Name(), ".json") {
-				continue
-			}
-			if entry.Name() != exactFile && !strings.HasPrefix(entry.Name(), prefix) {
+			if !matches(entry.Name()) {
 				continue
 			}
-
-			filePath := filepath.Join(dir, entry.Name())
-			status, err := readStatusWithLock(filePath)
-			if err != nil {
-				continue
+			if checkFile(filepath.Join(dir, entry.Name())) {
+				foundAny = true
 			}
-
-			// Check if process is still running
-			if err := syscall.Kill(status.PID, 0); err != nil {
-				if lastStates[status.PID] != "terminated" {
-					fmt.Printf("[%s] PID %d terminated\n", time.Now().Format("15:04:05"), status.PID)
-					lastStates[status.PID] = "terminated"
-				}
-				os.Remove(filePath)
-				continue
-			}
-
-			foundAny = true
-			checkAndNotify(status, customPromptRe, lastStates, taskStartTimes, command, startMsg, endMsg)
 		}
 
 		if !foundAny && len(lastStates) > 0 {
 			// All processes gone
 			for p, state := range lastStates {
 				if state != "not_found" && state != "terminated" {
-					fmt.Printf("[%s] PID %d: process not found\n", time.Now().Format("15:04:05"), p)
+					logDaemonEvent(DaemonEvent{Event: DaemonNotFound, PID: p, PrevState: state}, fmt.Sprintf("PID %d: process not found", p))
 					lastStates[p] = "not_found"
 				}
 			}
 		}
 	}
 
+	// handleWatch reacts to a single change in the status directory
+	handleWatch := func(ev watchEvent) {
+		if ev.Name == "" {
+			checkStatus()
+			return
+		}
+		if !matches(ev.Name) {
+			return
+		}
+		if !ev.Removed {
+			// Wrappers rewrite their status file every tick; subscribed ones
+			// push state changes over the socket, so their files are left to
+			// polling for liveness, unless reminders need last_input_at
+			if !subscribed[pidFromStatusFile(ev.Name)] || reminder.enabled() {
+				checkFile(filepath.Join(dir, ev.Name))
+			}
+			return
+		}
+
+		// A removed status file means the wrapper exited; subscribed
+		// wrappers report that over their socket instead
+		p := pidFromStatusFile(ev.Name)
+		status, seen := lastStatus[p]
+		if !seen || subscribed[p] {
+			return
+		}
+		delete(lastStatus, p)
+		terminated(status)
+	}
+
+	var watchEvents chan watchEvent
+	if watcher != nil {
+		watchEvents = watcher.Events
+	}
+
 	// Initial check
 	checkStatus()
 
@@ -510,29 +955,90 @@ func runStatusDaemon(name string, pid int, interval float64, command string, sta
 		select {
 		case <-ticker.C:
 			checkStatus()
+			getQuietGate().Flush(time.Now(), daemonLog)
+		case ev, ok := <-watchEvents:
+			if !ok {
+				// Watching stopped: rely on polling alone
+				watchEvents = nil
+				continue
+			}
+			handleWatch(ev)
+		case msg := <-socketEvents:
+			if msg.event == nil {
+				// Disconnected: fall back to polling the status file
+				delete(subscribed, msg.pid)
+				continue
+			}
+			status := msg.event.status()
+			if status.State == StateStopped {
+				terminated(status)
+				continue
+			}
+			checkAndNotify(status, customPromptRe, lastStates, lastShown, taskStartTimes, sinks, startMsg, endMsg, errMsg)
+			notifyStuck(status, lastStuck, taskStartTimes, sinks, stuckMsg)
 		case <-sigCh:
-			fmt.Println("\nStopped monitoring")
+			fmt.Fprintln(out, "\nStopped monitoring")
+			waitNotifications(getQuietGate().FlushOnExit(daemonLog), notifyWaitTimeout)
 			return
 		}
 	}
 }
 
 // listProcesses lists all monitored processes
-func listProcesses() {
-	dir := getStatusDir()
-	entries, err := os.ReadDir(dir)
-	if err != nil {
+func listProcesses(format string) {
+	procs := readMonitoredProcesses()
+	if format != "" {
+		var reports []ProcessReport
+		for _, p := range procs {
+			reports = append(reports, newProcessReport(p.Name, p.Status))
+		}
+		writeReports(os.Stdout, format, reports)
+		return
+	}
+
+	if len(procs) == 0 {
 		fmt.Println("No monitored processes found")
 		return
 	}
 
 	// Group by command name
-	type processInfo struct {
-		status   *Status
-		filePath string
+	groups := make(map[string][]*Status)
+	for _, p := range procs {
+		groups[p.Name] = append(groups[p.Name], p.Status)
 	}
-	groups := make(map[string][]processInfo)
 
+	fmt.Println("Monitored processes:")
+	fmt.Println(strings.Repeat("-", 70))
+
+	for name, statuses := range groups {
+		if len(statuses) == 1 {
+			status := statuses[0]
+			fmt.Printf("%s %-20s PID:%-8d %s\n", statusIcon(status), name, status.PID, listDetail(status))
+		} else {
+			// Multiple instances
+			fmt.Printf("📦 %s (%d instances)\n", name, len(statuses))
+			for _, status := range statuses {
+				fmt.Printf("   %s PID:%-8d %s\n", statusIcon(status), status.PID, listDetail(status))
+			}
+		}
+	}
+}
+
+// monitoredProcess is a status file with the command name taken from its file name
+type monitoredProcess struct {
+	Name   string
+	Status *Status
+}
+
+// readMonitoredProcesses reads every status file, removing those of dead processes
+func readMonitoredProcesses() []monitoredProcess {
+	dir := getStatusDir()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil
+	}
+
+	var procs []monitoredProcess
 	for _, entry := range entries {
 		if !strings.HasSuffix(entry.Name(), ".json") {
 			continue
@@ -562,37 +1068,39 @@ func listProcesses() {
 			}
 		}
 
-		groups[baseName] = append(groups[baseName], processInfo{status: status, filePath: filePath})
+		procs = append(procs, monitoredProcess{Name: baseName, Status: status})
 	}
+	return procs
+}
 
-	if len(groups) == 0 {
-		fmt.Println("No monitored processes found")
-		return
+// stateIcon returns the icon shown for a state in listings
+func stateIcon(state string) string {
+	switch state {
+	case StateWaiting:
+		return "⏳"
+	case StateStopped:
+		return "⏹"
 	}
+	return "🔄"
+}
 
-	fmt.Println("Monitored processes:")
-	fmt.Println(strings.Repeat("-", 70))
+// statusIcon returns the icon of a status, preferring its declared state's
+func statusIcon(status *Status) string {
+	if status.Substate != "" && status.StateIcon != "" {
+		return status.StateIcon
+	}
+	return stateIcon(status.State)
+}
 
-	for name, processes := range groups {
-		if len(processes) == 1 {
-			p := processes[0]
-			stateIcon := "🔄"
-			if p.status.State == StateWaiting {
-				stateIcon = "⏳"
-			}
-			fmt.Printf("%s %-20s PID:%-8d idle: %.1fs\n", stateIcon, name, p.status.PID, p.status.IdleSeconds)
-		} else {
-			// Multiple instances
-			fmt.Printf("📦 %s (%d instances)\n", name, len(processes))
-			for _, p := range processes {
-				stateIcon := "🔄"
-				if p.status.State == StateWaiting {
-					stateIcon = "⏳"
-				}
-				fmt.Printf("   %s PID:%-8d idle: %.1fs\n", stateIcon, p.status.PID, p.status.IdleSeconds)
-			}
-		}
+// listDetail returns the idle time of a live process, or how a stopped one ended
+func listDetail(status *Status) string {
+	if status.State == StateStopped {
+		return exitDescription(status)
 	}
+	if status.Substate != "" {
+		return fmt.Sprintf("%s  idle: %.1fs", status.Substate, status.IdleSeconds)
+	}
+	return fmt.Sprintf("idle: %.1fs", status.IdleSeconds)
 }
 
 // printStatus prints the status of a process
@@ -603,14 +1111,58 @@ func printStatus(name string, status *Status) {
 		stateIcon = "🔄 RUNNING"
 	case StateWaiting:
 		stateIcon = "⏳ WAITING FOR INPUT"
+		if status.WaitingFor == WaitingForApproval {
+			stateIcon = "⏳ WAITING FOR APPROVAL"
+		}
+	}
+	if status.Substate != "" {
+		stateIcon = fmt.Sprintf("%s %s (%s)", statusIcon(status), strings.ToUpper(status.Substate), status.State)
 	}
 
 	fmt.Printf("=== %s: %s ===\n", name, stateIcon)
 	fmt.Printf("Command: %s\n", status.Command)
 	fmt.Printf("PID: %d\n", status.PID)
+	if status.Cwd != "" {
+		fmt.Printf("Directory: %s\n", status.Cwd)
+	}
+	if status.Hostname != "" || status.TTY != "" {
+		fmt.Printf("Host: %s %s\n", status.Hostname, status.TTY)
+	}
 	fmt.Printf("Current line: %q\n", status.LastLine)
 	fmt.Printf("Idle detected: %v\n", status.IdleDetected)
 	fmt.Printf("Idle: %.1f seconds\n", status.IdleSeconds)
+	if status.Reason != "" {
+		fmt.Printf("Reason: %s\n", status.Reason)
+	}
+	if status.SchemaVersion >= 2 {
+		fmt.Printf("Tasks: %d (current since %s)\n", status.TaskCount, status.TaskStartTime.Format("15:04:05"))
+		fmt.Printf("State changed: %s\n", status.StateChangedAt.Format("15:04:05"))
+	}
+	if status.ExitCode != nil {
+		fmt.Printf("Exit: %s\n", exitDescription(status))
+	}
+	if status.EndTime != nil {
+		fmt.Printf("Ended: %s\n", status.EndTime.Format("15:04:05"))
+	}
+	if status.Transcript != "" {
+		fmt.Printf("Transcript: %s\n", status.Transcript)
+	}
+	if status.Stuck != "" {
+		fmt.Printf("Watchdog: ⚠ stuck (%s)\n", status.Stuck)
+	}
+	if status.TaskFailed {
+		fmt.Printf("Last task: ❌ failed: %s\n", status.ErrorLine)
+	}
+	if status.AutoResponses > 0 {
+		fmt.Printf("Auto-responses: %d\n", status.AutoResponses)
+	}
+	if status.QueueLength > 0 || status.QueuePaused != "" {
+		fmt.Printf("Queue: %d pending", status.QueueLength)
+		if status.QueuePaused != "" {
+			fmt.Printf(" (paused: %s)", status.QueuePaused)
+		}
+		fmt.Println()
+	}
 	fmt.Printf("Updated: %s\n", status.UpdatedAt.Format("15:04:05"))
 	fmt.Println()
 	fmt.Println("--- Last Output ---")
@@ -1,7 +1,14 @@
 package kiromon
 
 import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
 	"testing"
+	"time"
 )
 
 func TestParseMonitorOptions(t *testing.T) {
@@ -50,6 +57,21 @@ func TestParseMonitorOptions(t *testing.T) {
 			[]string{"-r", "> ?$", "kiro-cli"},
 			MonitorOptions{Name: "kiro-cli", PromptPattern: "> ?$", Interval: DefaultPollInterval},
 		},
+		{
+			"with webhook",
+			[]string{"-w", "https://ntfy.sh/topic", "kiro-cli"},
+			MonitorOptions{Name: "kiro-cli", Webhook: "https://ntfy.sh/topic", Interval: DefaultPollInterval},
+		},
+		{
+			"json output",
+			[]string{"--json", "kiro-cli"},
+			MonitorOptions{Name: "kiro-cli", Format: FormatJSON, Interval: DefaultPollInterval},
+		},
+		{
+			"ndjson daemon",
+			[]string{"-d", "--ndjson", "kiro-cli"},
+			MonitorOptions{Name: "kiro-cli", Daemon: true, Format: FormatNDJSON, Interval: DefaultPollInterval},
+		},
 		{
 			"full options",
 			[]string{"-d", "-p", "999", "-i", "3.0", "-c", "cmd", "-ms", "s", "-me", "e", "-r", "pat", "name"},
@@ -94,6 +116,93 @@ func TestParseMonitorOptions(t *testing.T) {
 			if result.PromptPattern != tt.expected.PromptPattern {
 				t.Errorf("PromptPattern = %q, want %q", result.PromptPattern, tt.expected.PromptPattern)
 			}
+			if result.Webhook != tt.expected.Webhook {
+				t.Errorf("Webhook = %q, want %q", result.Webhook, tt.expected.Webhook)
+			}
+			if result.Format != tt.expected.Format {
+				t.Errorf("Format = %q, want %q", result.Format, tt.expected.Format)
+			}
 		})
 	}
 }
+
+// writeTestStatus writes a status file as a wrapper would
+func writeTestStatus(t *testing.T, path string, status Status) {
+	t.Helper()
+	data, err := json.Marshal(status)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := atomicWriteFile(path, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestStatusDaemonPromptPattern(t *testing.T) {
+	// Unix socket paths are length-limited, so avoid the long t.TempDir()
+	dir, err := os.MkdirTemp("", "km")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	t.Setenv("XDG_RUNTIME_DIR", dir)
+	t.Setenv("TMPDIR", dir)
+	t.Setenv("XDG_CONFIG_HOME", dir)
+
+	// A live wrapper with an event socket that stays running
+	pid := os.Getpid()
+	statusPath := getStatusFileWithPID("test", pid)
+	status := Status{State: StateRunning, Command: "test", PID: pid, LastLine: "thinking", UpdatedAt: time.Now()}
+	writeTestStatus(t, statusPath, status)
+	server, err := newEventServer(getSocketPath(statusPath))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+	server.Publish(StateEvent{State: StateRunning, PID: pid, Command: "test", LastLine: "thinking", Time: time.Now()})
+
+	notes := filepath.Join(dir, "notes")
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		runStatusDaemon("test", &MonitorOptions{
+			Interval:      0.2,
+			Command:       fmt.Sprintf("sh -c 'echo {event} >> %s'", notes),
+			EndMsg:        "完了",
+			PromptPattern: "READY>",
+		})
+	}()
+	defer func() {
+		syscall.Kill(pid, syscall.SIGINT)
+		<-done
+	}()
+
+	// The custom prompt appears while the wrapper itself still says running
+	time.Sleep(500 * time.Millisecond)
+	status.LastLine, status.UpdatedAt = "READY>", time.Now()
+	writeTestStatus(t, statusPath, status)
+
+	deadline := time.Now().Add(3 * time.Second)
+	for {
+		if data, _ := os.ReadFile(notes); strings.Contains(string(data), EventEnd) {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("end was not notified for the custom prompt")
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func TestWrapHint(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "top"), []byte("#!/bin/sh\n"), 0755)
+	t.Setenv("PATH", dir)
+
+	if hint := wrapHint("top"); !strings.Contains(hint, "kiromon -- top") {
+		t.Errorf("wrapHint(top) = %q", hint)
+	}
+	if hint := wrapHint("queue"); hint != "" {
+		t.Errorf("wrapHint(queue) = %q without a queue command", hint)
+	}
+}
@@ -21,36 +21,67 @@ const (
 // Default settings
 const (
 	MaxLines            = 100
-	DebounceDelay       = 1   // seconds
-	StatusInterval      = 500 // milliseconds
-	DefaultPollInterval = 2.0 // seconds
+	DebounceDelay       = 1    // seconds
+	StatusInterval      = 500  // milliseconds
+	DefaultPollInterval = 2.0  // seconds
+	WatchPollInterval   = 10.0 // seconds, safety-net polling while watching the status directory
 )
 
+// DefaultTombstoneRetention is how long a stopped status file is kept
+const DefaultTombstoneRetention = 10 * time.Minute
+
 // StandaloneConfig holds configuration for standalone mode
 type StandaloneConfig struct {
-	Command       string
+	Command       CommandTemplate
 	StartMsg      string
 	EndMsg        string
+	ExitMsg       string
+	ErrMsg        string
+	Watchdog      *WatchdogConfig
+	Reminder      *ReminderConfig
 	LogFile       *os.File
 	Syslog        *syslog.Writer
 	LogMu         sync.Mutex
 	TaskStartTime time.Time
 	TaskStartMu   sync.Mutex
 	MinDuration   time.Duration
+	Webhook       *WebhookConfig
+	Sinks         []*notifySink
 }
 
 // PresetConfig holds preset configuration for a specific command
 type PresetConfig struct {
-	Command  string `yaml:"command"`
-	StartMsg string `yaml:"start_msg"`
-	EndMsg   string `yaml:"end_msg"`
+	Command         CommandTemplate   `yaml:"command"`
+	StartMsg        string            `yaml:"start_msg"`
+	EndMsg          string            `yaml:"end_msg"`
+	ExitMsg         string            `yaml:"exit_msg"`
+	ErrMsg          string            `yaml:"err_msg"`
+	PromptPattern   string            `yaml:"prompt_pattern"`
+	RunningKeywords []string          `yaml:"running_keywords"`
+	PromptScanLines int               `yaml:"prompt_scan_lines"`
+	Detector        string            `yaml:"detector"`
+	IdleThreshold   time.Duration     `yaml:"idle_threshold"`
+	Webhook         *WebhookConfig    `yaml:"webhook"`
+	Notifiers       []SinkConfig      `yaml:"notifiers"`
+	Transcript      *TranscriptConfig `yaml:"transcript"`
+	Queue           *QueueConfig      `yaml:"queue"`
+	AutoRespond     []AutoRespondRule `yaml:"auto_respond"`
+	ApprovalPattern string            `yaml:"approval_pattern"`
+	States          []StateConfig     `yaml:"states"`
+	ErrorPatterns   []string          `yaml:"error_patterns"` // nil: DefaultErrorPatterns, []: disabled
+	Watchdog        *WatchdogConfig   `yaml:"watchdog"`
+	Reminder        *ReminderConfig   `yaml:"reminder"`
 }
 
 // FileConfig represents the configuration file structure
 type FileConfig struct {
-	DefaultCommand string                  `yaml:"default_command"`
-	LogPath        string                  `yaml:"log_path"`
-	Presets        map[string]PresetConfig `yaml:"presets"`
+	DefaultCommand     CommandTemplate         `yaml:"default_command"`
+	LogPath            string                  `yaml:"log_path"`
+	TombstoneRetention *time.Duration          `yaml:"tombstone_retention"`
+	History            *bool                   `yaml:"history"`
+	HistoryPath        string                  `yaml:"history_path"`
+	Presets            map[string]PresetConfig `yaml:"presets"`
+	Quiet              *QuietConfig            `yaml:"quiet"`
 }
 
 // globalConfig holds the loaded configuration
@@ -98,6 +129,18 @@ func getPreset(cmdName string) *PresetConfig {
 	return nil
 }
 
+// tombstoneRetention returns how long stopped status files are kept; 0 removes them on exit
+func tombstoneRetention() time.Duration {
+	if config := loadConfig(); config != nil && config.TombstoneRetention != nil {
+		return *config.TombstoneRetention
+	}
+	return DefaultTombstoneRetention
+}
+
+// promptRules compiles the preset's state detection patterns
+func (p *PresetConfig) promptRules() (*PromptRules, error) {
+	return newPromptRules(p.PromptPattern, p.RunningKeywords, p.PromptScanLines)
+}
 
 // defaultConfigContent is the default config file content
 const defaultConfigContent = `# kiromon 設定ファイル
@@ -109,12 +152,89 @@ const defaultConfigContent = `# kiromon 設定ファイル
 # ログファイルパス
 # log_path: ~/kiromon.log
 
+# 終了したプロセスのステータスファイル（終了コード付き）を残す時間（0s で即削除）
+# tombstone_retention: 10m
+
+# 通知を控える時間帯（kiromon dnd on / off / for 30m でも控えられます）
+# quiet:
+#   hours: ["22:00-07:00"]
+#   policy: drop              # drop / silent（silent: true の通知先だけ）/ digest（後でまとめて通知）
+#   allow: [stuck]            # 控えている間も通知するイベント
+#   focus_command: ["focus-mode-active"]  # 終了コード 0 の間は控える
+
+# タスク履歴（kiromon history）の記録と保存先
+# history: true
+# history_path: ~/.local/state/kiromon/history.jsonl
+
 # コマンドごとのプリセット設定
 # presets:
 #   kiro-cli:
+#     # 通知コマンド（文字列またはリスト、{message} などのプレースホルダ可）
 #     command: voicevox-speak-standalone
 #     start_msg: "{time}、タスクを開始したのだ"
 #     end_msg: "{time}、タスクを終了したのだ。処理時間は、{duration}だったのだ。"
+#     # コマンド終了時のメッセージ（{exit_code} / {signal} を使用可能）
+#     # exit_msg: "終了コード{exit_code}で終了したのだ"
+#     # エラーを出力して終わったタスクのメッセージ（{error_line} を使用可能）
+#     # err_msg: "エラーで止まったのだ。{error_line}"
+#     # タスクを失敗とみなす出力の正規表現（省略時は Error: や Traceback など、[] で無効）
+#     # error_patterns: ['^(\w+\.)*\w*(Error|Exception):']
+#     # 実行中のまま止まったタスクを stuck イベントで通知
+#     # watchdog:
+#     #   max_task: 15m
+#     #   max_silence: 5m
+#     #   repeat: 10m
+#     #   interrupt: false      # 最初の通知で SIGINT を送る
+#     # 入力待ちが続いたら remind イベントで通知
+#     # reminder:
+#     #   intervals: [5m, 15m, 30m]
+#     #   max: 3                # -1 で無制限
+#     # 入力待ちプロンプトの正規表現（省略時は kiro-cli の入力欄を検出）
+#     # prompt_pattern: '(?i)ask a question or describe a task'
+#     # 実行中を示す行の正規表現
+#     # running_keywords: ['Thinking\.\.\.', 'Running\.\.\.']
+#     # プロンプトを探す末尾の行数
+#     # prompt_scan_lines: 3
+#     # 状態検出方式: heuristic（デフォルト）/ regex / idle
+#     # detector: heuristic
+#     # 出力が何秒変化しなければ待機とみなすか
+#     # idle_threshold: 1s
+#     # 通知コマンドの代わりに（または併せて）HTTP POST で通知
+#     # webhook:
+#     #   url: https://ntfy.sh/my-topic
+#     #   format: ntfy          # json / slack / ntfy
+#     # 複数の通知先（type: exec / webhook / bell / file / syslog）
+#     # notifiers:
+#     #   - type: bell
+#     #     events: [end, error]  # start / end / failed / stuck / remind / stopped / error
+#     #   - type: file
+#     #     path: ~/kiromon-events.log
+#     #     message: "{event} {command}"
+#     # タスクごとの出力全体をファイルに保存（{transcript} でパスを参照可能）
+#     # transcript:
+#     #   enabled: true
+#     #   dir: ~/.local/state/kiromon/transcripts
+#     #   raw: false            # エスケープシーケンス付きの .raw も保存
+#     #   keep: 50              # コマンドごとに残すファイル数
+#     # kiromon queue で積んだプロンプトを直前のタスクの出力にこのパターンが出たら止める
+#     # queue:
+#     #   pause_on: ['(?i)^error', 'rate limit']
+#     # 確認プロンプトに自動で応答（画面末尾の行に match が一致したら send と keys を入力）
+#     # auto_respond:
+#     #   - name: trust-tools
+#     #     match: 'Allow this action\? \[y/n/t\]'
+#     #     send: "t"
+#     #     keys: [Enter]
+#     #     max_fires: 20         # 0 で無制限
+#     #     cooldown: 5s
+#     # 承認待ち（waiting_for: approval）とみなすプロンプトの正規表現
+#     # approval_pattern: '(?i)allow this action|\[y/n(/t)?\]|\(y/n\)'
+#     # 画面の内容から判定する状態を追加（notifiers の transitions: ["*->errored"] で通知）
+#     # states:
+#     #   - name: errored
+#     #     match: '(?i)^error'
+#     #     priority: 10
+#     #     icon: "❌"
 `
 
 // initConfig creates the default config file
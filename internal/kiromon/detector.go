@@ -0,0 +1,213 @@
+package kiromon
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Detector names selectable with the preset "detector" key
+const (
+	DetectorHeuristic = "heuristic"
+	DetectorRegex     = "regex"
+	DetectorIdle      = "idle"
+)
+
+// DefaultIdleThreshold is how long output must stay unchanged before it counts as idle
+const DefaultIdleThreshold = 1 * time.Second
+
+// echoWindow is how long after a keystroke output is treated as terminal echo
+const echoWindow = 500 * time.Millisecond
+
+// Detection is the result of evaluating a Detector
+type Detection struct {
+	State      string  // StateRunning or StateWaiting
+	Confidence float64 // 0.0 (guess) to 1.0 (certain)
+	Reason     string  // short explanation for logs and status
+}
+
+// Screen is the view of the terminal a Detector inspects on each tick
+type Screen interface {
+	// CurrentLine returns the line the cursor is on
+	CurrentLine() string
+	// RecentLines returns up to n lines from the bottom of the screen
+	RecentLines(n int) []string
+}
+
+// Detector decides whether the wrapped process is running or waiting for input.
+// It is fed with PTY output chunks, stdin events and periodic ticks.
+type Detector interface {
+	Output(data []byte, at time.Time)
+	Input(at time.Time)
+	Tick(now time.Time, screen Screen) Detection
+}
+
+// newDetector creates the named detector; an empty name selects the heuristic one
+func newDetector(name string, rules *PromptRules, idleThreshold time.Duration) (Detector, error) {
+	if idleThreshold <= 0 {
+		idleThreshold = DefaultIdleThreshold
+	}
+
+	var d Detector
+	switch name {
+	case "", DetectorHeuristic:
+		d = &heuristicDetector{rules: rules, idleThreshold: idleThreshold}
+	case DetectorRegex:
+		d = &regexDetector{rules: rules}
+	case DetectorIdle:
+		d = &idleDetector{idleThreshold: idleThreshold}
+	default:
+		return nil, fmt.Errorf("unknown detector %q (want %s, %s or %s)", name, DetectorHeuristic, DetectorRegex, DetectorIdle)
+	}
+	return &syncDetector{d: d}, nil
+}
+
+// syncDetector serializes calls from the stdin, stdout and status goroutines
+type syncDetector struct {
+	mu sync.Mutex
+	d  Detector
+}
+
+func (s *syncDetector) Output(data []byte, at time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.d.Output(data, at)
+}
+
+func (s *syncDetector) Input(at time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.d.Input(at)
+}
+
+func (s *syncDetector) Tick(now time.Time, screen Screen) Detection {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.d.Tick(now, screen)
+}
+
+// heuristicDetector treats a stable current line as waiting, unless it is a
+// running line or the tool's prompt marker has scrolled off screen.
+// Line changes caused only by the echo of the user's typing do not count.
+type heuristicDetector struct {
+	rules         *PromptRules
+	idleThreshold time.Duration
+	prevLine      string
+	stableSince   time.Time
+	markerSeen    bool
+	lastInput     time.Time
+	outputSeen    bool // non-echo output since the previous tick
+}
+
+func (d *heuristicDetector) Output(data []byte, at time.Time) {
+	if d.lastInput.IsZero() || at.Sub(d.lastInput) >= echoWindow {
+		d.outputSeen = true
+	}
+}
+
+func (d *heuristicDetector) Input(at time.Time) {
+	d.lastInput = at
+}
+
+func (d *heuristicDetector) Tick(now time.Time, screen Screen) Detection {
+	line := screen.CurrentLine()
+	if line != d.prevLine {
+		if d.outputSeen || d.prevLine == "" {
+			d.stableSince = now
+		}
+		d.prevLine = line
+	}
+	d.outputSeen = false
+
+	recent := screen.RecentLines(d.rules.ScanLines)
+	promptShown := false
+	for _, l := range recent {
+		if d.rules.isPromptLine(l) {
+			promptShown = true
+			break
+		}
+	}
+	if promptShown || d.rules.isPromptLine(line) {
+		d.markerSeen = true
+	}
+
+	if line == "" {
+		return Detection{State: StateRunning, Confidence: 0.5, Reason: "no output yet"}
+	}
+	if now.Sub(d.stableSince) < d.idleThreshold {
+		return Detection{State: StateRunning, Confidence: 0.6, Reason: "output changing"}
+	}
+
+	// Certain lines indicate active processing regardless of idle time
+	if d.rules.isRunningLine(line) {
+		return Detection{State: StateRunning, Confidence: 0.9, Reason: "running keyword"}
+	}
+
+	// Genuine waiting requires the input prompt box to be currently
+	// displayed: the marker must appear within the last few screen lines.
+	// During processing the marker scrolls out, so idle output mid-task
+	// (e.g. long thinking, or a persistent bottom hint line) is correctly
+	// treated as running. Tools that never emit the marker fall back to
+	// pure idle detection.
+	if d.markerSeen {
+		if !promptShown {
+			return Detection{State: StateRunning, Confidence: 0.7, Reason: "prompt not on screen"}
+		}
+		return Detection{State: StateWaiting, Confidence: 0.9, Reason: "prompt on screen"}
+	}
+	return Detection{State: StateWaiting, Confidence: 0.6, Reason: "output idle"}
+}
+
+// regexDetector reports waiting exactly when the prompt pattern is on screen
+type regexDetector struct {
+	rules *PromptRules
+}
+
+func (d *regexDetector) Output(data []byte, at time.Time) {}
+
+func (d *regexDetector) Input(at time.Time) {}
+
+func (d *regexDetector) Tick(now time.Time, screen Screen) Detection {
+	line := screen.CurrentLine()
+	if d.rules.isRunningLine(line) {
+		return Detection{State: StateRunning, Confidence: 0.9, Reason: "running keyword"}
+	}
+	if d.rules.isPromptLine(line) {
+		return Detection{State: StateWaiting, Confidence: 1.0, Reason: "prompt matched"}
+	}
+	for _, l := range screen.RecentLines(d.rules.ScanLines) {
+		if d.rules.isPromptLine(l) {
+			return Detection{State: StateWaiting, Confidence: 0.8, Reason: "prompt on screen"}
+		}
+	}
+	return Detection{State: StateRunning, Confidence: 0.8, Reason: "prompt not matched"}
+}
+
+// idleDetector ignores screen content and reports waiting after a quiet period.
+// Output shortly after a keystroke is treated as echo and does not count.
+type idleDetector struct {
+	idleThreshold time.Duration
+	lastOutput    time.Time
+	lastInput     time.Time
+}
+
+func (d *idleDetector) Output(data []byte, at time.Time) {
+	if !d.lastInput.IsZero() && at.Sub(d.lastInput) < echoWindow {
+		return
+	}
+	d.lastOutput = at
+}
+
+func (d *idleDetector) Input(at time.Time) {
+	d.lastInput = at
+}
+
+func (d *idleDetector) Tick(now time.Time, screen Screen) Detection {
+	if d.lastOutput.IsZero() {
+		return Detection{State: StateRunning, Confidence: 0.5, Reason: "no output yet"}
+	}
+	if now.Sub(d.lastOutput) < d.idleThreshold {
+		return Detection{State: StateRunning, Confidence: 0.6, Reason: "output active"}
+	}
+	return Detection{State: StateWaiting, Confidence: 0.6, Reason: "output idle"}
+}
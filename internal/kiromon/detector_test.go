@@ -0,0 +1,138 @@
+package kiromon
+
+import (
+	"testing"
+	"time"
+)
+
+// fakeScreen is a fixed Screen for detector tests
+type fakeScreen struct {
+	current string
+	lines   []string
+}
+
+func (s fakeScreen) CurrentLine() string { return s.current }
+
+func (s fakeScreen) RecentLines(n int) []string {
+	if n < len(s.lines) {
+		return s.lines[len(s.lines)-n:]
+	}
+	return s.lines
+}
+
+func TestNewDetector(t *testing.T) {
+	for _, name := range []string{"", DetectorHeuristic, DetectorRegex, DetectorIdle} {
+		if _, err := newDetector(name, defaultPromptRules(), 0); err != nil {
+			t.Errorf("newDetector(%q) error = %v", name, err)
+		}
+	}
+	if _, err := newDetector("bogus", defaultPromptRules(), 0); err == nil {
+		t.Error("expected error for unknown detector")
+	}
+}
+
+func TestHeuristicDetector(t *testing.T) {
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	t.Run("stable line without marker is waiting", func(t *testing.T) {
+		d, _ := newDetector(DetectorHeuristic, defaultPromptRules(), 0)
+		screen := fakeScreen{current: "$ "}
+		if got := d.Tick(start, screen); got.State != StateRunning {
+			t.Errorf("first tick state = %q, want running", got.State)
+		}
+		if got := d.Tick(start.Add(1500*time.Millisecond), screen); got.State != StateWaiting {
+			t.Errorf("stable tick state = %q, want waiting", got.State)
+		}
+	})
+
+	t.Run("running keyword stays running", func(t *testing.T) {
+		d, _ := newDetector(DetectorHeuristic, defaultPromptRules(), 0)
+		screen := fakeScreen{current: "⠙ Thinking..."}
+		d.Tick(start, screen)
+		got := d.Tick(start.Add(5*time.Second), screen)
+		if got.State != StateRunning || got.Reason != "running keyword" {
+			t.Errorf("got %+v, want running keyword", got)
+		}
+	})
+
+	t.Run("marker scrolled out is running", func(t *testing.T) {
+		d, _ := newDetector(DetectorHeuristic, defaultPromptRules(), 0)
+		d.Tick(start, fakeScreen{current: "> ", lines: []string{"Ask a question or describe a task"}})
+		screen := fakeScreen{current: "reading files", lines: []string{"a", "b", "c"}}
+		d.Output([]byte("reading files"), start.Add(time.Second))
+		d.Tick(start.Add(time.Second), screen)
+		if got := d.Tick(start.Add(3*time.Second), screen); got.State != StateRunning {
+			t.Errorf("state = %q, want running while marker is off screen", got.State)
+		}
+	})
+
+	t.Run("marker on screen is waiting", func(t *testing.T) {
+		d, _ := newDetector(DetectorHeuristic, defaultPromptRules(), 0)
+		screen := fakeScreen{current: "> ", lines: []string{"done", "Ask a question or describe a task"}}
+		d.Tick(start, screen)
+		got := d.Tick(start.Add(2*time.Second), screen)
+		if got.State != StateWaiting || got.Confidence < 0.9 {
+			t.Errorf("got %+v, want confident waiting", got)
+		}
+	})
+}
+
+func TestHeuristicDetectorIgnoresEcho(t *testing.T) {
+	d, _ := newDetector(DetectorHeuristic, defaultPromptRules(), 0)
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	d.Tick(start, fakeScreen{current: "$"})
+	if got := d.Tick(start.Add(2*time.Second), fakeScreen{current: "$"}); got.State != StateWaiting {
+		t.Fatalf("state = %q, want waiting", got.State)
+	}
+
+	// The user types: the line changes only through echo
+	d.Input(start.Add(2100 * time.Millisecond))
+	d.Output([]byte("l"), start.Add(2110*time.Millisecond))
+	if got := d.Tick(start.Add(2500*time.Millisecond), fakeScreen{current: "$ l"}); got.State != StateWaiting {
+		t.Errorf("state after echo = %q, want waiting", got.State)
+	}
+
+	// Real output changes the line again
+	d.Output([]byte("file.txt"), start.Add(3*time.Second))
+	if got := d.Tick(start.Add(3*time.Second), fakeScreen{current: "file.txt"}); got.State != StateRunning {
+		t.Errorf("state after output = %q, want running", got.State)
+	}
+}
+
+func TestRegexDetector(t *testing.T) {
+	rules, _ := newPromptRules(`^>>> ?$`, []string{}, 0)
+	d, _ := newDetector(DetectorRegex, rules, 0)
+	now := time.Now()
+
+	if got := d.Tick(now, fakeScreen{current: ">>>"}); got.State != StateWaiting {
+		t.Errorf("prompt line state = %q, want waiting", got.State)
+	}
+	if got := d.Tick(now, fakeScreen{current: "computing"}); got.State != StateRunning {
+		t.Errorf("output line state = %q, want running", got.State)
+	}
+}
+
+func TestIdleDetector(t *testing.T) {
+	d, _ := newDetector(DetectorIdle, nil, 2*time.Second)
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	if got := d.Tick(start, fakeScreen{}); got.State != StateRunning {
+		t.Errorf("no output state = %q, want running", got.State)
+	}
+
+	d.Output([]byte("hello"), start)
+	if got := d.Tick(start.Add(time.Second), fakeScreen{}); got.State != StateRunning {
+		t.Errorf("recent output state = %q, want running", got.State)
+	}
+	if got := d.Tick(start.Add(3*time.Second), fakeScreen{}); got.State != StateWaiting {
+		t.Errorf("idle state = %q, want waiting", got.State)
+	}
+
+	// Echo of a keystroke does not count as output
+	d.Input(start.Add(4 * time.Second))
+	d.Output([]byte("y"), start.Add(4*time.Second+10*time.Millisecond))
+	if got := d.Tick(start.Add(4*time.Second+100*time.Millisecond), fakeScreen{}); got.State != StateWaiting {
+		t.Errorf("echo state = %q, want waiting", got.State)
+	}
+}
@@ -0,0 +1,231 @@
+package kiromon
+
+import (
+	"bufio"
+	"encoding/json"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// eventClientBuffer is how many events may queue for a slow subscriber before it is dropped
+const eventClientBuffer = 64
+
+// eventWriteTimeout bounds a single write to a subscriber
+const eventWriteTimeout = 2 * time.Second
+
+// StateEvent is one line of the wrapper's event stream
+type StateEvent struct {
+	State     string    `json:"state"`
+	PrevState string    `json:"prev_state,omitempty"`
+	Substate  string    `json:"substate,omitempty"`   // declared state, if any
+	StateIcon string    `json:"state_icon,omitempty"` // icon of the declared state
+	PID       int       `json:"pid"`
+	Command   string    `json:"command"`
+	LastLine  string    `json:"last_line"`
+	Reason    string    `json:"reason,omitempty"`
+	Time      time.Time `json:"time"`
+	ExitCode  *int      `json:"exit_code,omitempty"` // set with the stopped state
+	Signal    string    `json:"signal,omitempty"`
+
+	TaskFailed bool   `json:"task_failed,omitempty"` // the last task printed an error line
+	ErrorLine  string `json:"error_line,omitempty"`
+	Transcript string `json:"transcript,omitempty"` // output of the current or last task, when enabled
+	Stuck      string `json:"stuck,omitempty"`      // while running: why the watchdog raised an alert
+}
+
+// status converts the event to the Status fields used for notifications
+func (e *StateEvent) status() *Status {
+	return &Status{
+		State:     e.State,
+		Substate:  e.Substate,
+		StateIcon: e.StateIcon,
+		Command:   e.Command,
+		PID:       e.PID,
+		UpdatedAt: e.Time,
+		LastLine:  e.LastLine,
+		ExitCode:  e.ExitCode,
+		Signal:    e.Signal,
+
+		TaskFailed: e.TaskFailed,
+		ErrorLine:  e.ErrorLine,
+		Transcript: e.Transcript,
+		Stuck:      e.Stuck,
+	}
+}
+
+// getSocketPath returns the event socket path next to a status file
+func getSocketPath(statusPath string) string {
+	return strings.TrimSuffix(statusPath, ".json") + ".sock"
+}
+
+// eventServer streams newline-delimited JSON state events over a Unix socket.
+// New subscribers receive the latest event first.
+type eventServer struct {
+	path     string
+	listener net.Listener
+
+	mu      sync.Mutex
+	clients map[*eventClient]struct{}
+	last    []byte
+	closed  bool
+	writers sync.WaitGroup
+}
+
+// eventClient is one connected subscriber
+type eventClient struct {
+	conn net.Conn
+	ch   chan []byte
+}
+
+// newEventServer listens on path, replacing a stale socket left by a crashed wrapper
+func newEventServer(path string) (*eventServer, error) {
+	os.Remove(path)
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	os.Chmod(path, 0600)
+
+	s := &eventServer{
+		path:     path,
+		listener: listener,
+		clients:  make(map[*eventClient]struct{}),
+	}
+	go s.acceptLoop()
+	return s, nil
+}
+
+// acceptLoop registers subscribers until the listener is closed
+func (s *eventServer) acceptLoop() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+
+		c := &eventClient{conn: conn, ch: make(chan []byte, eventClientBuffer)}
+		s.mu.Lock()
+		if s.closed {
+			s.mu.Unlock()
+			conn.Close()
+			return
+		}
+		if s.last != nil {
+			c.ch <- s.last
+		}
+		s.clients[c] = struct{}{}
+		s.writers.Add(1)
+		s.mu.Unlock()
+
+		go s.writeLoop(c)
+	}
+}
+
+// writeLoop sends queued events to one subscriber
+func (s *eventServer) writeLoop(c *eventClient) {
+	defer s.writers.Done()
+	defer c.conn.Close()
+	for line := range c.ch {
+		c.conn.SetWriteDeadline(time.Now().Add(eventWriteTimeout))
+		if _, err := c.conn.Write(line); err != nil {
+			s.drop(c)
+			return
+		}
+	}
+}
+
+// drop disconnects a subscriber
+func (s *eventServer) drop(c *eventClient) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.clients[c]; ok {
+		delete(s.clients, c)
+		close(c.ch)
+	}
+}
+
+// Publish sends an event to every subscriber; subscribers that fall behind are dropped
+func (s *eventServer) Publish(ev StateEvent) {
+	data, err := json.Marshal(ev)
+	if err != nil {
+		return
+	}
+	line := append(data, '\n')
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return
+	}
+	s.last = line
+	for c := range s.clients {
+		select {
+		case c.ch <- line:
+		default:
+			delete(s.clients, c)
+			close(c.ch)
+		}
+	}
+}
+
+// Close stops accepting subscribers, flushes queued events and removes the socket
+func (s *eventServer) Close() {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return
+	}
+	s.closed = true
+	for c := range s.clients {
+		delete(s.clients, c)
+		close(c.ch)
+	}
+	s.mu.Unlock()
+
+	s.listener.Close()
+	os.Remove(s.path)
+
+	// Give subscribers a chance to receive the final events
+	done := make(chan struct{})
+	go func() {
+		s.writers.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(eventWriteTimeout):
+	}
+}
+
+// socketMessage is delivered by a subscription; a nil event means it disconnected
+type socketMessage struct {
+	pid   int
+	event *StateEvent
+}
+
+// subscribeEvents connects to a wrapper's event socket and forwards its events
+// to ch until the connection closes
+func subscribeEvents(path string, pid int, ch chan<- socketMessage) error {
+	conn, err := net.Dial("unix", path)
+	if err != nil {
+		return err
+	}
+
+	go func() {
+		defer conn.Close()
+		scanner := bufio.NewScanner(conn)
+		scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+		for scanner.Scan() {
+			var ev StateEvent
+			if err := json.Unmarshal(scanner.Bytes(), &ev); err != nil {
+				continue
+			}
+			ch <- socketMessage{pid: pid, event: &ev}
+		}
+		ch <- socketMessage{pid: pid}
+	}()
+	return nil
+}
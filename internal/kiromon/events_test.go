@@ -0,0 +1,267 @@
+package kiromon
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// receive waits for the next message from a subscription
+func receive(t *testing.T, ch <-chan socketMessage) socketMessage {
+	t.Helper()
+	select {
+	case msg := <-ch:
+		return msg
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for event")
+		return socketMessage{}
+	}
+}
+
+func TestGetSocketPath(t *testing.T) {
+	if got := getSocketPath("/run/kiromon/kiro-cli-123.json"); got != "/run/kiromon/kiro-cli-123.sock" {
+		t.Errorf("getSocketPath() = %q", got)
+	}
+}
+
+func TestEventServer(t *testing.T) {
+	// Unix socket paths are length-limited, so avoid the long t.TempDir()
+	dir, err := os.MkdirTemp("", "km")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "test-1.sock")
+
+	server, err := newEventServer(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server.Publish(StateEvent{State: StateRunning, PID: 1, Command: "kiro-cli"})
+
+	// A late subscriber first receives the latest event
+	ch := make(chan socketMessage, 4)
+	if err := subscribeEvents(path, 1, ch); err != nil {
+		t.Fatal(err)
+	}
+	msg := receive(t, ch)
+	if msg.event == nil || msg.event.State != StateRunning || msg.pid != 1 {
+		t.Fatalf("first message = %+v", msg)
+	}
+
+	server.Publish(StateEvent{State: StateWaiting, PrevState: StateRunning, PID: 1, LastLine: "> "})
+	msg = receive(t, ch)
+	if msg.event == nil || msg.event.State != StateWaiting || msg.event.PrevState != StateRunning || msg.event.LastLine != "> " {
+		t.Fatalf("second message = %+v", msg.event)
+	}
+
+	// Events queued before Close are still delivered, then the stream ends
+	server.Publish(StateEvent{State: StateStopped, PID: 1})
+	server.Close()
+	if msg = receive(t, ch); msg.event == nil || msg.event.State != StateStopped {
+		t.Fatalf("final message = %+v", msg.event)
+	}
+	if msg = receive(t, ch); msg.event != nil {
+		t.Fatalf("expected disconnect, got %+v", msg.event)
+	}
+
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Error("socket file not removed on Close")
+	}
+	if err := subscribeEvents(path, 1, ch); err == nil {
+		t.Error("expected error subscribing to a closed server")
+	}
+}
+
+func TestStateEventStatus(t *testing.T) {
+	now := time.Now()
+	ev := StateEvent{State: StateWaiting, PID: 7, Command: "kiro-cli chat", LastLine: "> ", Time: now}
+	status := ev.status()
+	if status.State != StateWaiting || status.PID != 7 || status.Command != "kiro-cli chat" || status.LastLine != "> " || !status.UpdatedAt.Equal(now) {
+		t.Errorf("status() = %+v", status)
+	}
+
+	// Daemons notify from these without reading the status file
+	ev = StateEvent{State: StateWaiting, Substate: "errored", StateIcon: "❌", TaskFailed: true, ErrorLine: "Error: boom", Transcript: "/tmp/t/1.log"}
+	status = ev.status()
+	if status.Substate != "errored" || status.StateIcon != "❌" || !status.TaskFailed || status.ErrorLine != "Error: boom" || status.Transcript != "/tmp/t/1.log" {
+		t.Errorf("status() = %+v", status)
+	}
+}
+
+func TestDaemonFailedOverSocket(t *testing.T) {
+	dir, err := os.MkdirTemp("", "km")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	server, err := newEventServer(filepath.Join(dir, "test-7.sock"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+
+	savedStream, savedState, savedShown, savedError := eventStream, publishedState, publishedShown, statusTaskError
+	defer func() {
+		eventStream, publishedState, publishedShown, statusTaskError = savedStream, savedState, savedShown, savedError
+	}()
+	eventStream, publishedState, publishedShown, statusTaskError = server, "", "", ""
+
+	publishState(StateRunning, "kiro-cli", 7, "thinking", "output changing")
+	ch := make(chan socketMessage, 4)
+	if err := subscribeEvents(server.path, 7, ch); err != nil {
+		t.Fatal(err)
+	}
+	rec := &recordNotifier{}
+	sinks := []*notifySink{{name: "rec", notifier: rec, events: failedSinkEvents(defaultSinkEvents, "失敗")}}
+	lastStates := make(map[int]string)
+	lastShown := make(map[int]string)
+	taskStarts := make(map[int]time.Time)
+	msg := receive(t, ch)
+	checkAndNotify(msg.event.status(), nil, lastStates, lastShown, taskStarts, sinks, "開始", "完了", "失敗: {error_line}")
+
+	// The task ends after printing an error line
+	statusTaskError = "Error: boom"
+	publishState(StateWaiting, "kiro-cli", 7, "> ", "prompt on screen")
+	msg = receive(t, ch)
+	if !msg.event.TaskFailed || msg.event.ErrorLine != "Error: boom" {
+		t.Fatalf("event = %+v", msg.event)
+	}
+	checkAndNotify(msg.event.status(), nil, lastStates, lastShown, taskStarts, sinks, "開始", "完了", "失敗: {error_line}")
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		rec.mu.Lock()
+		events := append([]NotifyEvent(nil), rec.events...)
+		rec.mu.Unlock()
+		if len(events) > 0 {
+			if ev := events[0]; len(events) != 1 || ev.Event != EventFailed || ev.Message != "失敗: Error: boom" {
+				t.Errorf("events = %+v", events)
+			}
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("failed task was not notified")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestDaemonDeclaredStateOverSocket(t *testing.T) {
+	dir, err := os.MkdirTemp("", "km")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	server, err := newEventServer(filepath.Join(dir, "test-7.sock"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+
+	savedStream, savedState, savedShown, savedSubstate, savedIcon := eventStream, publishedState, publishedShown, statusSubstate, statusStateIcon
+	defer func() {
+		eventStream, publishedState, publishedShown, statusSubstate, statusStateIcon = savedStream, savedState, savedShown, savedSubstate, savedIcon
+	}()
+	eventStream, publishedState, publishedShown, statusSubstate, statusStateIcon = server, "", "", "", ""
+
+	publishState(StateRunning, "kiro-cli", 7, "thinking", "output changing")
+	ch := make(chan socketMessage, 4)
+	if err := subscribeEvents(server.path, 7, ch); err != nil {
+		t.Fatal(err)
+	}
+	rec := &recordNotifier{}
+	sinks := []*notifySink{{name: "rec", notifier: rec, transitions: []string{"*->rate-limited"}}}
+	lastStates := make(map[int]string)
+	lastShown := make(map[int]string)
+	taskStarts := make(map[int]time.Time)
+	msg := receive(t, ch)
+	checkAndNotify(msg.event.status(), nil, lastStates, lastShown, taskStarts, sinks, "", "", "")
+
+	// A declared state is published although the base state stays running
+	statusSubstate, statusStateIcon = "rate-limited", "🚦"
+	publishState(StateRunning, "kiro-cli", 7, "rate limit", "output changing")
+	msg = receive(t, ch)
+	if msg.event.State != StateRunning || msg.event.Substate != "rate-limited" || msg.event.StateIcon != "🚦" {
+		t.Fatalf("event = %+v", msg.event)
+	}
+	checkAndNotify(msg.event.status(), nil, lastStates, lastShown, taskStarts, sinks, "", "", "")
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		rec.mu.Lock()
+		events := append([]NotifyEvent(nil), rec.events...)
+		rec.mu.Unlock()
+		if len(events) > 0 {
+			if ev := events[0]; len(events) != 1 || ev.PrevState != StateRunning || ev.State != "rate-limited" {
+				t.Errorf("events = %+v", events)
+			}
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("transition was not notified")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestDaemonStuckOverSocket(t *testing.T) {
+	dir, err := os.MkdirTemp("", "km")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	server, err := newEventServer(filepath.Join(dir, "test-7.sock"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+
+	savedStream, savedState, savedShown, savedStuck, savedWatchdog := eventStream, publishedState, publishedShown, publishedStuck, watchdog
+	defer func() {
+		eventStream, publishedState, publishedShown, publishedStuck, watchdog = savedStream, savedState, savedShown, savedStuck, savedWatchdog
+	}()
+	stuck := &taskWatchdog{}
+	eventStream, publishedState, publishedShown, publishedStuck, watchdog = server, "", "", "", stuck
+
+	publishState(StateRunning, "kiro-cli", 7, "thinking", "output changing")
+	ch := make(chan socketMessage, 4)
+	if err := subscribeEvents(server.path, 7, ch); err != nil {
+		t.Fatal(err)
+	}
+	rec := &recordNotifier{}
+	sinks := []*notifySink{{name: "rec", notifier: rec, events: []string{EventStuck}}}
+	lastStuck := make(map[int]string)
+	taskStarts := make(map[int]time.Time)
+	msg := receive(t, ch)
+	notifyStuck(msg.event.status(), lastStuck, taskStarts, sinks, "")
+
+	// The alert is published although the state stays running, and notified once
+	stuck.reason = StuckSilent
+	publishState(StateRunning, "kiro-cli", 7, "thinking", "output changing")
+	msg = receive(t, ch)
+	if msg.event.Stuck != StuckSilent {
+		t.Fatalf("event = %+v", msg.event)
+	}
+	notifyStuck(msg.event.status(), lastStuck, taskStarts, sinks, "")
+	notifyStuck(msg.event.status(), lastStuck, taskStarts, sinks, "")
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		rec.mu.Lock()
+		events := append([]NotifyEvent(nil), rec.events...)
+		rec.mu.Unlock()
+		if len(events) > 0 {
+			if ev := events[0]; len(events) != 1 || ev.Event != EventStuck || !strings.Contains(ev.Message, "出力が止まっています") {
+				t.Errorf("events = %+v", events)
+			}
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("stuck was not notified")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,421 @@
+package kiromon
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// Task outcomes recorded in the history
+const (
+	TaskCompleted = "completed" // the command returned to waiting
+	TaskExited    = "exited"    // the command exited while the task was running
+)
+
+// historyLastLines is how many trailing screen lines are kept per task
+const historyLastLines = 5
+
+// TaskRecord is one line of the task history file
+type TaskRecord struct {
+	Command         string    `json:"command"`
+	PID             int       `json:"pid"`
+	Cwd             string    `json:"cwd,omitempty"`
+	Hostname        string    `json:"hostname,omitempty"`
+	Start           time.Time `json:"start"`
+	End             time.Time `json:"end"`
+	DurationSeconds float64   `json:"duration_seconds"`
+	PromptLine      string    `json:"prompt_line"` // the line on screen when the task started, i.e. the prompt typed; not task output
+	LastLines       []string  `json:"last_lines"`
+	Status          string    `json:"status"` // TaskCompleted or TaskExited
+	ExitCode        *int      `json:"exit_code,omitempty"`
+	Signal          string    `json:"signal,omitempty"`
+	Transcript      string    `json:"transcript,omitempty"` // full output of the task, when transcripts are enabled
+}
+
+// Duration returns how long the task ran
+func (r *TaskRecord) Duration() time.Duration {
+	return time.Duration(r.DurationSeconds * float64(time.Second))
+}
+
+// getHistoryPath returns the task history file, honouring history_path in the config
+func getHistoryPath() string {
+	if config := loadConfig(); config != nil && config.HistoryPath != "" {
+		return expandHome(config.HistoryPath)
+	}
+	if dir := os.Getenv("XDG_STATE_HOME"); dir != "" {
+		return filepath.Join(dir, "kiromon", "history.jsonl")
+	}
+	home, _ := os.UserHomeDir()
+	return filepath.Join(home, ".local", "state", "kiromon", "history.jsonl")
+}
+
+// historyEnabled reports whether wrappers record task history
+func historyEnabled() bool {
+	config := loadConfig()
+	return config == nil || config.History == nil || *config.History
+}
+
+// appendTaskRecord appends one record to the history file under an exclusive lock
+func appendTaskRecord(path string, rec TaskRecord) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX); err != nil {
+		return err
+	}
+	defer syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(append(data, '\n'))
+	return err
+}
+
+// historyFilter selects records for kiromon history
+type historyFilter struct {
+	Command     string // substring of the command line
+	Since       time.Time
+	Until       time.Time
+	MinDuration time.Duration
+}
+
+// match reports whether a record passes the filter
+func (f *historyFilter) match(r *TaskRecord) bool {
+	if f.Command != "" && !strings.Contains(r.Command, f.Command) {
+		return false
+	}
+	if !f.Since.IsZero() && r.Start.Before(f.Since) {
+		return false
+	}
+	if !f.Until.IsZero() && !r.Start.Before(f.Until) {
+		return false
+	}
+	return r.Duration() >= f.MinDuration
+}
+
+// readTaskRecords reads the records passing filter, oldest first.
+// Lines that cannot be parsed (e.g. a torn write) are skipped.
+func readTaskRecords(r io.Reader, filter *historyFilter) ([]TaskRecord, error) {
+	var records []TaskRecord
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var rec TaskRecord
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			continue
+		}
+		if filter.match(&rec) {
+			records = append(records, rec)
+		}
+	}
+	return records, scanner.Err()
+}
+
+// taskTracker turns the wrapper's state transitions into history records.
+// A task starts on waiting -> running and ends when the command is
+// waiting again or exits.
+type taskTracker struct {
+	path     string
+	command  string
+	pid      int
+	cwd      string
+	hostname string
+
+	state       string
+	start       time.Time
+	promptLine  string
+	waitingLine string
+	transcript  *transcriptRecorder
+	logf        logFunc
+}
+
+// Observe feeds the state seen on one status tick
+func (t *taskTracker) Observe(state string, now time.Time, lastLine string, lines []string) {
+	prev := t.state
+	t.state = state
+	switch {
+	case state == StateRunning && prev == StateWaiting:
+		t.start = now
+		t.promptLine = t.waitingLine
+	case state == StateWaiting && prev == StateRunning && !t.start.IsZero():
+		t.record(now, lines, TaskCompleted, nil, "")
+	}
+	if state == StateWaiting && lastLine != "" {
+		t.waitingLine = lastLine
+	}
+}
+
+// Finish records the running task, if any, when the command exits
+func (t *taskTracker) Finish(now time.Time, lines []string, exitCode *int, signal string) {
+	if t.state == StateRunning && !t.start.IsZero() {
+		t.record(now, lines, TaskExited, exitCode, signal)
+	}
+	t.state = StateStopped
+}
+
+// record appends the finished task to the history file
+func (t *taskTracker) record(now time.Time, lines []string, status string, exitCode *int, signal string) {
+	if len(lines) > historyLastLines {
+		lines = lines[len(lines)-historyLastLines:]
+	}
+	rec := TaskRecord{
+		Command:         t.command,
+		PID:             t.pid,
+		Cwd:             t.cwd,
+		Hostname:        t.hostname,
+		Start:           t.start,
+		End:             now,
+		DurationSeconds: now.Sub(t.start).Seconds(),
+		PromptLine:      t.promptLine,
+		LastLines:       append([]string{}, lines...),
+		Status:          status,
+		ExitCode:        exitCode,
+		Signal:          signal,
+	}
+	if t.transcript != nil {
+		rec.Transcript = t.transcript.LastPath()
+	}
+	t.start = time.Time{}
+	if err := appendTaskRecord(t.path, rec); err != nil && t.logf != nil {
+		t.logf("History error: %v", err)
+	}
+}
+
+// historySummary aggregates durations of a set of tasks
+type historySummary struct {
+	Count          int                       `json:"count"`
+	TotalSeconds   float64                   `json:"total_seconds"`
+	AverageSeconds float64                   `json:"average_seconds"`
+	MedianSeconds  float64                   `json:"median_seconds"`
+	LongestSeconds float64                   `json:"longest_seconds"`
+	Exited         int                       `json:"exited"` // tasks interrupted by the command exiting
+	ByCommand      map[string]historySummary `json:"by_command,omitempty"`
+}
+
+// summarizeTasks computes overall and per-command statistics
+func summarizeTasks(records []TaskRecord) historySummary {
+	summary := summarizeDurations(records)
+	groups := make(map[string][]TaskRecord)
+	for _, r := range records {
+		name := r.Command
+		if fields := strings.Fields(name); len(fields) > 0 {
+			name = filepath.Base(fields[0])
+		}
+		groups[name] = append(groups[name], r)
+	}
+	if len(groups) > 0 {
+		summary.ByCommand = make(map[string]historySummary, len(groups))
+		for name, group := range groups {
+			summary.ByCommand[name] = summarizeDurations(group)
+		}
+	}
+	return summary
+}
+
+// summarizeDurations computes statistics without the per-command breakdown
+func summarizeDurations(records []TaskRecord) historySummary {
+	s := historySummary{Count: len(records)}
+	if len(records) == 0 {
+		return s
+	}
+	durations := make([]float64, len(records))
+	for i, r := range records {
+		durations[i] = r.DurationSeconds
+		s.TotalSeconds += r.DurationSeconds
+		if r.Status == TaskExited {
+			s.Exited++
+		}
+	}
+	sort.Float64s(durations)
+	s.AverageSeconds = s.TotalSeconds / float64(len(records))
+	s.LongestSeconds = durations[len(durations)-1]
+	if mid := len(durations) / 2; len(durations)%2 == 1 {
+		s.MedianSeconds = durations[mid]
+	} else {
+		s.MedianSeconds = (durations[mid-1] + durations[mid]) / 2
+	}
+	return s
+}
+
+// parseHistoryTime parses a -since/-until value: a date, a date and time,
+// or a duration before now such as 36h or 7d
+func parseHistoryTime(s string, now time.Time) (time.Time, error) {
+	if strings.HasSuffix(s, "d") {
+		if days, err := strconv.Atoi(strings.TrimSuffix(s, "d")); err == nil {
+			return now.AddDate(0, 0, -days), nil
+		}
+	}
+	if d, err := time.ParseDuration(s); err == nil {
+		return now.Add(-d), nil
+	}
+	for _, layout := range []string{time.RFC3339, "2006-01-02 15:04", "2006-01-02T15:04", "2006-01-02"} {
+		if t, err := time.ParseInLocation(layout, s, now.Location()); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid time %q (want YYYY-MM-DD, YYYY-MM-DD HH:MM, or a duration such as 24h or 7d)", s)
+}
+
+// historyReport is the document printed by kiromon history --json
+type historyReport struct {
+	SchemaVersion int            `json:"schema_version"`
+	Tasks         []TaskRecord   `json:"tasks"`
+	Summary       historySummary `json:"summary"`
+}
+
+// runHistory handles "kiromon history [options]"
+func runHistory(args []string) {
+	filter := &historyFilter{}
+	format := ""
+	limit := 20
+	statsOnly := false
+	now := time.Now()
+
+	for i := 0; i < len(args); i++ {
+		needValue := func() string {
+			if i+1 >= len(args) {
+				fmt.Fprintf(os.Stderr, "Error: %s requires a value\n", args[i])
+				os.Exit(1)
+			}
+			i++
+			return args[i]
+		}
+		switch args[i] {
+		case "-cmd":
+			filter.Command = needValue()
+		case "-since", "-until":
+			flag := args[i]
+			t, err := parseHistoryTime(needValue(), now)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %s: %v\n", flag, err)
+				os.Exit(1)
+			}
+			if flag == "-since" {
+				filter.Since = t
+			} else {
+				filter.Until = t
+			}
+		case "-min":
+			d, err := time.ParseDuration(needValue())
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Invalid duration: %s\n", args[i])
+				os.Exit(1)
+			}
+			filter.MinDuration = d
+		case "-n":
+			if _, err := fmt.Sscanf(needValue(), "%d", &limit); err != nil {
+				fmt.Fprintf(os.Stderr, "Invalid count: %s\n", args[i])
+				os.Exit(1)
+			}
+		case "-stats":
+			statsOnly = true
+		case "--json":
+			format = FormatJSON
+		case "--ndjson":
+			format = FormatNDJSON
+		default:
+			fmt.Fprintf(os.Stderr, "Unknown history option: %s\n", args[i])
+			printWrapHint("history")
+			os.Exit(1)
+		}
+	}
+
+	var records []TaskRecord
+	f, err := os.Open(getHistoryPath())
+	if err == nil {
+		records, err = readTaskRecords(f, filter)
+		f.Close()
+	}
+	if err != nil && !os.IsNotExist(err) {
+		fmt.Fprintf(os.Stderr, "Error reading history: %v\n", err)
+		os.Exit(1)
+	}
+
+	// Statistics cover every match; the listing shows the newest -n tasks
+	summary := summarizeTasks(records)
+	shown := records
+	if limit > 0 && len(shown) > limit {
+		shown = shown[len(shown)-limit:]
+	}
+	if statsOnly {
+		shown = nil
+	}
+
+	switch format {
+	case FormatJSON:
+		if shown == nil {
+			shown = []TaskRecord{}
+		}
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetEscapeHTML(false)
+		enc.SetIndent("", "  ")
+		enc.Encode(historyReport{SchemaVersion: OutputSchemaVersion, Tasks: shown, Summary: summary})
+	case FormatNDJSON:
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetEscapeHTML(false)
+		for _, r := range shown {
+			enc.Encode(r)
+		}
+	default:
+		printHistory(os.Stdout, shown, summary)
+	}
+}
+
+// printHistory prints tasks and their summary as text
+func printHistory(w io.Writer, records []TaskRecord, summary historySummary) {
+	if summary.Count == 0 {
+		fmt.Fprintln(w, "No tasks recorded")
+		return
+	}
+
+	for _, r := range records {
+		mark := "✅"
+		if r.Status == TaskExited {
+			mark = "⏹"
+		}
+		fmt.Fprintf(w, "%s %s  %-12s %-20s %s\n", mark, r.Start.Local().Format("2006-01-02 15:04:05"), formatDuration(r.Duration()), r.Command, r.PromptLine)
+	}
+	if len(records) > 0 {
+		fmt.Fprintln(w, strings.Repeat("-", 70))
+	}
+
+	fmt.Fprintf(w, "Tasks: %d  Total: %s  Average: %s  Median: %s  Longest: %s\n",
+		summary.Count,
+		formatDuration(time.Duration(summary.TotalSeconds*float64(time.Second))),
+		formatDuration(time.Duration(summary.AverageSeconds*float64(time.Second))),
+		formatDuration(time.Duration(summary.MedianSeconds*float64(time.Second))),
+		formatDuration(time.Duration(summary.LongestSeconds*float64(time.Second))))
+	if summary.Exited > 0 {
+		fmt.Fprintf(w, "Interrupted by exit: %d\n", summary.Exited)
+	}
+
+	if len(summary.ByCommand) > 1 {
+		names := make([]string, 0, len(summary.ByCommand))
+		for name := range summary.ByCommand {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			s := summary.ByCommand[name]
+			fmt.Fprintf(w, "  %-20s %4d tasks  total %s  average %s\n", name, s.Count,
+				formatDuration(time.Duration(s.TotalSeconds*float64(time.Second))),
+				formatDuration(time.Duration(s.AverageSeconds*float64(time.Second))))
+		}
+	}
+}
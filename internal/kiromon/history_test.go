@@ -0,0 +1,135 @@
+package kiromon
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTaskTracker(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state", "history.jsonl")
+	tracker := &taskTracker{path: path, command: "kiro-cli chat", pid: 7, cwd: "/work"}
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	// Start-up output is not a task
+	tracker.Observe(StateRunning, start, "", nil)
+	tracker.Observe(StateWaiting, start.Add(time.Second), "> fix the tests", nil)
+
+	// waiting -> running -> waiting is one completed task
+	tracker.Observe(StateRunning, start.Add(2*time.Second), "Thinking...", nil)
+	tracker.Observe(StateRunning, start.Add(10*time.Second), "Thinking...", nil)
+	lines := []string{"a", "b", "c", "d", "e", "f", "done"}
+	tracker.Observe(StateWaiting, start.Add(62*time.Second), "> ", lines)
+
+	// A task cut short by the command exiting
+	tracker.Observe(StateRunning, start.Add(70*time.Second), "", nil)
+	code := 130
+	tracker.Finish(start.Add(75*time.Second), []string{"^C"}, &code, "")
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	records, err := readTaskRecords(f, &historyFilter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 2 {
+		t.Fatalf("got %d records: %+v", len(records), records)
+	}
+
+	first := records[0]
+	if first.Command != "kiro-cli chat" || first.PID != 7 || first.Cwd != "/work" || first.Status != TaskCompleted {
+		t.Errorf("first record = %+v", first)
+	}
+	if first.DurationSeconds != 60 || first.PromptLine != "> fix the tests" {
+		t.Errorf("first record duration/prompt line = %v %q", first.DurationSeconds, first.PromptLine)
+	}
+	if strings.Join(first.LastLines, ",") != "c,d,e,f,done" {
+		t.Errorf("LastLines = %q", first.LastLines)
+	}
+
+	second := records[1]
+	if second.Status != TaskExited || second.ExitCode == nil || *second.ExitCode != 130 || second.DurationSeconds != 5 {
+		t.Errorf("second record = %+v", second)
+	}
+}
+
+func TestReadTaskRecordsFilter(t *testing.T) {
+	data := strings.Join([]string{
+		`{"command":"kiro-cli chat","start":"2024-01-01T10:00:00Z","duration_seconds":30}`,
+		`not json`,
+		`{"command":"python app.py","start":"2024-01-02T10:00:00Z","duration_seconds":300}`,
+		`{"command":"kiro-cli chat -a","start":"2024-01-03T10:00:00Z","duration_seconds":600}`,
+	}, "\n")
+
+	tests := []struct {
+		name   string
+		filter historyFilter
+		want   int
+	}{
+		{"all", historyFilter{}, 3},
+		{"command", historyFilter{Command: "kiro-cli"}, 2},
+		{"since", historyFilter{Since: time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)}, 2},
+		{"until", historyFilter{Until: time.Date(2024, 1, 2, 10, 0, 0, 0, time.UTC)}, 1},
+		{"min duration", historyFilter{MinDuration: 5 * time.Minute}, 2},
+		{"combined", historyFilter{Command: "kiro-cli", MinDuration: time.Minute}, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			records, err := readTaskRecords(strings.NewReader(data), &tt.filter)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(records) != tt.want {
+				t.Errorf("got %d records, want %d", len(records), tt.want)
+			}
+		})
+	}
+}
+
+func TestSummarizeTasks(t *testing.T) {
+	records := []TaskRecord{
+		{Command: "kiro-cli chat", DurationSeconds: 10},
+		{Command: "kiro-cli chat -a", DurationSeconds: 30, Status: TaskExited},
+		{Command: "/usr/bin/python app.py", DurationSeconds: 20},
+		{Command: "kiro-cli", DurationSeconds: 100},
+	}
+	s := summarizeTasks(records)
+	if s.Count != 4 || s.TotalSeconds != 160 || s.AverageSeconds != 40 || s.MedianSeconds != 25 || s.LongestSeconds != 100 || s.Exited != 1 {
+		t.Errorf("summary = %+v", s)
+	}
+	if len(s.ByCommand) != 2 || s.ByCommand["kiro-cli"].Count != 3 || s.ByCommand["python"].TotalSeconds != 20 {
+		t.Errorf("ByCommand = %+v", s.ByCommand)
+	}
+
+	if empty := summarizeTasks(nil); empty.Count != 0 || empty.ByCommand != nil {
+		t.Errorf("empty summary = %+v", empty)
+	}
+}
+
+func TestParseHistoryTime(t *testing.T) {
+	now := time.Date(2024, 3, 10, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		in   string
+		want time.Time
+	}{
+		{"7d", now.AddDate(0, 0, -7)},
+		{"36h", now.Add(-36 * time.Hour)},
+		{"2024-03-01", time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)},
+		{"2024-03-01 09:30", time.Date(2024, 3, 1, 9, 30, 0, 0, time.UTC)},
+		{"2024-03-01T09:30:00Z", time.Date(2024, 3, 1, 9, 30, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		got, err := parseHistoryTime(tt.in, now)
+		if err != nil || !got.Equal(tt.want) {
+			t.Errorf("parseHistoryTime(%q) = %v, %v; want %v", tt.in, got, err, tt.want)
+		}
+	}
+	if _, err := parseHistoryTime("yesterday", now); err == nil {
+		t.Error("expected error for invalid time")
+	}
+}
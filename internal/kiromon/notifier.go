@@ -0,0 +1,356 @@
+package kiromon
+
+import (
+	"fmt"
+	"log/syslog"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Notification events
+const (
+	EventStart   = "start"   // waiting -> running
+	EventEnd     = "end"     // running -> waiting
+	EventStopped = "stopped" // the monitored command exited
+	EventError   = "error"   // the monitored command failed
+	EventFailed  = "failed"  // running -> waiting after output matching an error pattern
+	EventStuck   = "stuck"   // a task ran longer than the watchdog allows
+	EventRemind  = "remind"  // still waiting for input after a reminder interval
+
+	EventTransition = "transition" // any change of the displayed state, including declared states
+
+	EventDigest = "digest" // summary of the notifications held while quiet
+)
+
+// Notification sink types
+const (
+	SinkExec    = "exec"
+	SinkWebhook = "webhook"
+	SinkBell    = "bell"
+	SinkFile    = "file"
+	SinkSyslog  = "syslog"
+)
+
+// defaultSinkEvents are delivered to sinks without an explicit events list
+var defaultSinkEvents = []string{EventStart, EventEnd}
+
+// notifyWaitTimeout bounds how long exit notifications may delay shutdown
+const notifyWaitTimeout = 15 * time.Second
+
+// Notifier delivers a notification event to one destination
+type Notifier interface {
+	Notify(ev NotifyEvent) error
+}
+
+// SinkConfig configures one entry of a preset's notifiers list
+type SinkConfig struct {
+	Type        string          `yaml:"type"`        // exec, webhook, bell, file or syslog
+	Events      []string        `yaml:"events"`      // events to deliver (default: start, end, unless transitions is set)
+	Transitions []string        `yaml:"transitions"` // from->to patterns, either side may be *
+	Message     string          `yaml:"message"`     // message template (default: the event's message)
+	Command     CommandTemplate `yaml:"command"`     // exec: command template
+	Path        string          `yaml:"path"`        // file: file to append to
+	Priority    string          `yaml:"priority"`    // syslog: info (default), notice, warning, err, crit
+	Silent      bool            `yaml:"silent"`      // still delivered while quiet with the silent policy
+
+	WebhookConfig `yaml:",inline"` // webhook: url, format, body, ...
+}
+
+// notifySink pairs a Notifier with its event filter and message template
+type notifySink struct {
+	name        string
+	notifier    Notifier
+	events      []string
+	transitions []string
+	message     string
+	silent      bool
+}
+
+// accepts reports whether the sink wants the event
+func (s *notifySink) accepts(event string) bool {
+	for _, e := range s.events {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+// acceptsTransition reports whether the sink wants a transition event
+func (s *notifySink) acceptsTransition(from, to string) bool {
+	if s.accepts(EventTransition) {
+		return true
+	}
+	for _, pattern := range s.transitions {
+		if matchTransition(pattern, from, to) {
+			return true
+		}
+	}
+	return false
+}
+
+// logFunc is the signature of per-sink error loggers
+type logFunc func(format string, args ...interface{})
+
+// buildSinks creates the notification sinks for a command: the -c command and
+// -w webhook (or their preset/default equivalents), which receive events,
+// plus the preset's notifiers list
+func buildSinks(command CommandTemplate, webhook *WebhookConfig, events []string, configs []SinkConfig, logf logFunc) ([]*notifySink, error) {
+	var sinks []*notifySink
+	if len(command) > 0 {
+		sinks = append(sinks, &notifySink{name: SinkExec, notifier: &execNotifier{command: command, logf: logf}, events: events})
+	}
+	if webhook != nil {
+		if err := webhook.validate(); err != nil {
+			return nil, err
+		}
+		sinks = append(sinks, &notifySink{name: SinkWebhook, notifier: &webhookNotifier{config: webhook}, events: events})
+	}
+	for i := range configs {
+		sink, err := newSink(&configs[i], logf)
+		if err != nil {
+			return nil, fmt.Errorf("notifiers[%d]: %w", i, err)
+		}
+		sinks = append(sinks, sink)
+	}
+	return sinks, nil
+}
+
+// newSink creates a sink from its configuration
+func newSink(c *SinkConfig, logf logFunc) (*notifySink, error) {
+	events := c.Events
+	if len(events) == 0 && len(c.Transitions) == 0 {
+		events = defaultSinkEvents
+	}
+	for _, e := range events {
+		if !isKnownEvent(e) {
+			return nil, fmt.Errorf("unknown event %q", e)
+		}
+	}
+	for _, t := range c.Transitions {
+		if err := validTransition(t); err != nil {
+			return nil, err
+		}
+	}
+
+	var notifier Notifier
+	switch c.Type {
+	case SinkExec:
+		if len(c.Command) == 0 {
+			return nil, fmt.Errorf("exec notifier requires command")
+		}
+		notifier = &execNotifier{command: c.Command, logf: logf}
+	case SinkWebhook:
+		webhook := c.WebhookConfig
+		if err := webhook.validate(); err != nil {
+			return nil, err
+		}
+		notifier = &webhookNotifier{config: &webhook}
+	case SinkBell:
+		notifier = &bellNotifier{tty: "/dev/tty"}
+	case SinkFile:
+		if c.Path == "" {
+			return nil, fmt.Errorf("file notifier requires path")
+		}
+		notifier = &fileNotifier{path: expandHome(c.Path)}
+	case SinkSyslog:
+		priority, err := parseSyslogPriority(c.Priority)
+		if err != nil {
+			return nil, err
+		}
+		notifier = &syslogNotifier{priority: priority}
+	default:
+		return nil, fmt.Errorf("unknown notifier type %q (want %s, %s, %s, %s or %s)", c.Type, SinkExec, SinkWebhook, SinkBell, SinkFile, SinkSyslog)
+	}
+
+	return &notifySink{name: c.Type, notifier: notifier, events: events, transitions: c.Transitions, message: c.Message, silent: c.Silent}, nil
+}
+
+// isKnownEvent reports whether name is a notification event
+func isKnownEvent(name string) bool {
+	switch name {
+	case EventStart, EventEnd, EventStopped, EventError, EventFailed, EventStuck, EventRemind, EventTransition:
+		return true
+	}
+	return false
+}
+
+// dispatchNotification fans an event out concurrently to every sink that
+// accepts it and logs per-sink errors. Sinks without a message template are
+// skipped when the event has no message. A failed event reaches sinks that
+// do not subscribe to it as an end event. While quiet hours or do not
+// disturb are in effect, events are handled by the quiet policy.
+func dispatchNotification(sinks []*notifySink, ev NotifyEvent, logf logFunc) *sync.WaitGroup {
+	return dispatchQuiet(getQuietGate(), sinks, ev, logf)
+}
+
+// dispatchQuiet is dispatchNotification with the given quiet gate
+func dispatchQuiet(gate *quietGate, sinks []*notifySink, ev NotifyEvent, logf logFunc) *sync.WaitGroup {
+	var wg sync.WaitGroup
+	now := ev.Time
+	if now.IsZero() {
+		now = time.Now()
+	}
+	quiet, reason := gate.Quiet(now)
+	if quiet && gate.allows(ev.Event) {
+		quiet = false
+	}
+	if quiet && gate.policy == QuietDrop {
+		logf("Notification %s suppressed (%s)", ev.Event, reason)
+		return &wg
+	}
+	for _, sink := range sinks {
+		sinkEv := ev
+		if ev.Event == EventTransition {
+			if !sink.acceptsTransition(ev.PrevState, ev.State) {
+				continue
+			}
+		} else if !sink.accepts(ev.Event) {
+			if ev.Event != EventFailed || !sink.accepts(EventEnd) {
+				continue
+			}
+			sinkEv.Event = EventEnd
+		}
+		if sink.message != "" {
+			sinkEv.Message = sinkEv.expand(sink.message)
+		}
+		if sinkEv.Message == "" {
+			continue
+		}
+		if quiet && !(gate.policy == QuietSilent && sink.silent) {
+			if gate.policy == QuietDigest {
+				gate.hold(sink, sinkEv)
+			}
+			logf("Notification %s to %s suppressed (%s)", ev.Event, sink.name, reason)
+			continue
+		}
+
+		wg.Add(1)
+		go func(sink *notifySink, ev NotifyEvent) {
+			defer wg.Done()
+			if err := sink.notifier.Notify(ev); err != nil {
+				logf("Notifier %s error: %v", sink.name, err)
+			}
+		}(sink, sinkEv)
+	}
+	return &wg
+}
+
+// waitNotifications waits for dispatched notifications, giving up after timeout
+func waitNotifications(wg *sync.WaitGroup, timeout time.Duration) {
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(timeout):
+	}
+}
+
+// execNotifier runs a command template
+type execNotifier struct {
+	command CommandTemplate
+	logf    logFunc
+}
+
+func (n *execNotifier) Notify(ev NotifyEvent) error {
+	output, err := runNotifyCommand(n.command, ev)
+	if len(output) > 0 && n.logf != nil {
+		n.logf("Command output: %s", strings.TrimSpace(string(output)))
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %w", n.command, err)
+	}
+	return nil
+}
+
+// webhookNotifier POSTs the event to an HTTP endpoint
+type webhookNotifier struct {
+	config *WebhookConfig
+}
+
+func (n *webhookNotifier) Notify(ev NotifyEvent) error {
+	return sendWebhook(n.config, ev)
+}
+
+// bellNotifier rings the terminal bell. It writes to the controlling
+// terminal rather than stdout, which carries the wrapped command's output,
+// and falls back to stderr without one.
+type bellNotifier struct {
+	tty string
+}
+
+func (n *bellNotifier) Notify(ev NotifyEvent) error {
+	f, err := os.OpenFile(n.tty, os.O_WRONLY, 0)
+	if err != nil {
+		_, err = os.Stderr.Write([]byte("\a"))
+		return err
+	}
+	defer f.Close()
+	_, err = f.Write([]byte("\a"))
+	return err
+}
+
+// fileNotifier appends one line per event to a file
+type fileNotifier struct {
+	mu   sync.Mutex
+	path string
+}
+
+func (n *fileNotifier) Notify(ev NotifyEvent) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	f, err := os.OpenFile(n.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = fmt.Fprintf(f, "[%s] PID %d %s: %s\n", ev.Time.Format("2006-01-02 15:04:05"), ev.PID, ev.Event, ev.Message)
+	return err
+}
+
+// syslogNotifier writes the message to syslog at a fixed priority
+type syslogNotifier struct {
+	priority syslog.Priority
+}
+
+func (n *syslogNotifier) Notify(ev NotifyEvent) error {
+	w, err := syslog.New(n.priority|syslog.LOG_USER, "kiromon")
+	if err != nil {
+		return err
+	}
+	defer w.Close()
+	_, err = w.Write([]byte(ev.Message))
+	return err
+}
+
+// parseSyslogPriority converts a priority name to a syslog severity
+func parseSyslogPriority(name string) (syslog.Priority, error) {
+	switch name {
+	case "", "info":
+		return syslog.LOG_INFO, nil
+	case "notice":
+		return syslog.LOG_NOTICE, nil
+	case "warning":
+		return syslog.LOG_WARNING, nil
+	case "err", "error":
+		return syslog.LOG_ERR, nil
+	case "crit":
+		return syslog.LOG_CRIT, nil
+	}
+	return 0, fmt.Errorf("unknown syslog priority %q", name)
+}
+
+// expandHome replaces a leading ~/ with the user's home directory
+func expandHome(path string) string {
+	if strings.HasPrefix(path, "~/") {
+		if home, err := os.UserHomeDir(); err == nil {
+			return home + path[1:]
+		}
+	}
+	return path
+}
@@ -0,0 +1,149 @@
+package kiromon
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// recordNotifier remembers the events it receives
+type recordNotifier struct {
+	mu     sync.Mutex
+	events []NotifyEvent
+}
+
+func (n *recordNotifier) Notify(ev NotifyEvent) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.events = append(n.events, ev)
+	return nil
+}
+
+func TestNewSink(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  SinkConfig
+		wantErr bool
+	}{
+		{"exec", SinkConfig{Type: SinkExec, Command: CommandTemplate{"true"}}, false},
+		{"exec without command", SinkConfig{Type: SinkExec}, true},
+		{"webhook", SinkConfig{Type: SinkWebhook, WebhookConfig: WebhookConfig{URL: "https://example.com"}}, false},
+		{"webhook without url", SinkConfig{Type: SinkWebhook}, true},
+		{"bell", SinkConfig{Type: SinkBell}, false},
+		{"file", SinkConfig{Type: SinkFile, Path: "/tmp/kiromon.txt"}, false},
+		{"file without path", SinkConfig{Type: SinkFile}, true},
+		{"syslog", SinkConfig{Type: SinkSyslog, Priority: "warning"}, false},
+		{"syslog bad priority", SinkConfig{Type: SinkSyslog, Priority: "loud"}, true},
+		{"unknown type", SinkConfig{Type: "pager"}, true},
+		{"unknown event", SinkConfig{Type: SinkBell, Events: []string{"finish"}}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := newSink(&tt.config, nil)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("newSink() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSinkConfigYAML(t *testing.T) {
+	var preset PresetConfig
+	data := `
+notifiers:
+  - type: webhook
+    url: https://ntfy.sh/topic
+    format: ntfy
+    events: [end, error]
+  - type: file
+    path: /tmp/events.log
+    message: "{event} {command}"
+`
+	if err := yaml.Unmarshal([]byte(data), &preset); err != nil {
+		t.Fatal(err)
+	}
+	if len(preset.Notifiers) != 2 {
+		t.Fatalf("got %d notifiers, want 2", len(preset.Notifiers))
+	}
+	if got := preset.Notifiers[0]; got.URL != "https://ntfy.sh/topic" || got.Format != WebhookNtfy || len(got.Events) != 2 {
+		t.Errorf("webhook notifier = %+v", got)
+	}
+
+	sinks, err := buildSinks(CommandTemplate{"notify-send"}, nil, defaultSinkEvents, preset.Notifiers, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sinks) != 3 {
+		t.Fatalf("got %d sinks, want 3", len(sinks))
+	}
+	if !sinks[0].accepts(EventStart) || sinks[0].accepts(EventStopped) {
+		t.Errorf("exec sink events = %v, want defaults", sinks[0].events)
+	}
+	if sinks[1].accepts(EventStart) || !sinks[1].accepts(EventError) {
+		t.Errorf("webhook sink events = %v", sinks[1].events)
+	}
+}
+
+func TestDispatchNotification(t *testing.T) {
+	all := &recordNotifier{}
+	endOnly := &recordNotifier{}
+	templated := &recordNotifier{}
+	sinks := []*notifySink{
+		{name: "all", notifier: all, events: []string{EventStart, EventEnd, EventStopped}},
+		{name: "end", notifier: endOnly, events: []string{EventEnd}},
+		{name: "templated", notifier: templated, events: []string{EventStart}, message: "{command} {event}"},
+	}
+	logf := func(format string, args ...interface{}) { t.Errorf(format, args...) }
+
+	waitNotifications(dispatchNotification(sinks, NotifyEvent{Event: EventEnd, Message: "done"}, logf), time.Second)
+	// No message: only the sink with its own template fires
+	waitNotifications(dispatchNotification(sinks, NotifyEvent{Event: EventStart, Command: "kiro-cli"}, logf), time.Second)
+
+	if len(all.events) != 1 || all.events[0].Message != "done" {
+		t.Errorf("all sink got %+v", all.events)
+	}
+	if len(endOnly.events) != 1 {
+		t.Errorf("end sink got %d events, want 1", len(endOnly.events))
+	}
+	if len(templated.events) != 1 || templated.events[0].Message != "kiro-cli start" {
+		t.Errorf("templated sink got %+v", templated.events)
+	}
+}
+
+func TestFileNotifier(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.log")
+	n := &fileNotifier{path: path}
+	ev := NotifyEvent{Event: EventEnd, PID: 42, Message: "完了", Time: time.Date(2024, 1, 1, 12, 0, 0, 0, time.Local)}
+	for i := 0; i < 2; i++ {
+		if err := n.Notify(ev); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "[2024-01-01 12:00:00] PID 42 end: 完了\n"
+	if string(data) != strings.Repeat(want, 2) {
+		t.Errorf("file contents = %q", data)
+	}
+}
+
+func TestBellNotifier(t *testing.T) {
+	// The bell goes to the terminal, not to stdout shared with the command's output
+	tty := filepath.Join(t.TempDir(), "tty")
+	os.WriteFile(tty, nil, 0600)
+	if err := (&bellNotifier{tty: tty}).Notify(NotifyEvent{Event: EventEnd}); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(tty); string(data) != "\a" {
+		t.Errorf("tty contents = %q", data)
+	}
+}
@@ -2,12 +2,226 @@ package kiromon
 
 import (
 	"fmt"
+	"os"
 	"os/exec"
 	"regexp"
+	"strconv"
 	"strings"
 	"time"
+
+	"gopkg.in/yaml.v3"
 )
 
+// CommandTemplate is a notifier argv whose elements may contain placeholders.
+// In the config file it is either a YAML list or a shell-quoted string.
+type CommandTemplate []string
+
+// UnmarshalYAML accepts a sequence of arguments or a shell-quoted scalar
+func (c *CommandTemplate) UnmarshalYAML(value *yaml.Node) error {
+	switch value.Kind {
+	case yaml.ScalarNode:
+		argv, err := parseCommandTemplate(value.Value)
+		if err != nil {
+			return fmt.Errorf("line %d: %w", value.Line, err)
+		}
+		*c = argv
+	case yaml.SequenceNode:
+		var argv []string
+		if err := value.Decode(&argv); err != nil {
+			return err
+		}
+		*c = argv
+	default:
+		return fmt.Errorf("line %d: command must be a string or a list", value.Line)
+	}
+	return nil
+}
+
+// String returns the template as a shell-quoted command line
+func (c CommandTemplate) String() string {
+	quoted := make([]string, len(c))
+	for i, arg := range c {
+		if arg != "" && !strings.ContainsAny(arg, " \t\n'\"\\$`") {
+			quoted[i] = arg
+		} else {
+			quoted[i] = "'" + strings.ReplaceAll(arg, "'", `'\''`) + "'"
+		}
+	}
+	return strings.Join(quoted, " ")
+}
+
+// parseCommandTemplate splits a shell-quoted command string into a template
+func parseCommandTemplate(s string) (CommandTemplate, error) {
+	var argv []string
+	var word strings.Builder
+	inWord := false
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n':
+			if inWord {
+				argv = append(argv, word.String())
+				word.Reset()
+				inWord = false
+			}
+		case c == '\'':
+			end := strings.IndexByte(s[i+1:], '\'')
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated single quote in %q", s)
+			}
+			word.WriteString(s[i+1 : i+1+end])
+			i += end + 1
+			inWord = true
+		case c == '"':
+			i++
+			for ; i < len(s) && s[i] != '"'; i++ {
+				if s[i] == '\\' && i+1 < len(s) && strings.IndexByte("\"\\$`", s[i+1]) >= 0 {
+					i++
+				}
+				word.WriteByte(s[i])
+			}
+			if i >= len(s) {
+				return nil, fmt.Errorf("unterminated double quote in %q", s)
+			}
+			inWord = true
+		case c == '\\':
+			if i+1 < len(s) {
+				i++
+				word.WriteByte(s[i])
+			}
+			inWord = true
+		default:
+			word.WriteByte(c)
+			inWord = true
+		}
+	}
+	if inWord {
+		argv = append(argv, word.String())
+	}
+	return argv, nil
+}
+
+// NotifyEvent describes a state change delivered to a notifier
+type NotifyEvent struct {
+	Event      string    // EventStart, EventEnd, EventFailed, EventStuck, EventRemind, EventStopped, EventError or EventTransition
+	State      string    // new state (the declared state, for transition events)
+	PrevState  string    // state before a transition event
+	PID        int       // PID of the monitored process
+	Command    string    // monitored command line
+	Message    string    // message after placeholder expansion
+	LastLine   string    // current screen line
+	TaskStart  time.Time // start of the task that just ran
+	Time       time.Time // when the change was detected
+	ExitCode   *int      // exit code, for stopped and error events
+	Signal     string    // terminating signal name (e.g. SIGKILL), if any
+	Transcript string    // transcript of the task that just ran, if enabled
+	ErrorLine  string    // output line that marked the task as failed
+}
+
+// Duration returns how long the task has been running at the time of the event
+func (e NotifyEvent) Duration() time.Duration {
+	if e.TaskStart.IsZero() {
+		return 0
+	}
+	return e.Time.Sub(e.TaskStart)
+}
+
+// placeholderNames are the placeholders replaced by expand
+var placeholderNames = []string{
+	"message", "event", "state", "prev_state", "pid", "command", "last_line",
+	"time", "duration", "exit_code", "signal", "transcript", "error_line",
+}
+
+// placeholderRe matches the known {name} placeholders in templates, so other
+// braces such as awk '{print}' do not count
+var placeholderRe = regexp.MustCompile(`\{(` + strings.Join(placeholderNames, "|") + `)\}`)
+
+// exitCodeString returns the exit code as text, or "" while the command runs
+func (e NotifyEvent) exitCodeString() string {
+	if e.ExitCode == nil {
+		return ""
+	}
+	return strconv.Itoa(*e.ExitCode)
+}
+
+// expand replaces event placeholders in a template string
+func (e NotifyEvent) expand(s string) string {
+	return strings.NewReplacer(
+		"{message}", e.Message,
+		"{event}", e.Event,
+		"{state}", e.State,
+		"{prev_state}", e.PrevState,
+		"{pid}", strconv.Itoa(e.PID),
+		"{command}", e.Command,
+		"{last_line}", e.LastLine,
+		"{time}", formatTimeJapanese(e.Time),
+		"{duration}", formatDuration(e.Duration()),
+		"{exit_code}", e.exitCodeString(),
+		"{signal}", e.Signal,
+		"{transcript}", e.Transcript,
+		"{error_line}", e.ErrorLine,
+	).Replace(s)
+}
+
+// environ returns the KIROMON_* variables exported to notifier processes
+func (e NotifyEvent) environ() []string {
+	env := []string{
+		"KIROMON_EVENT=" + e.Event,
+		"KIROMON_STATE=" + e.State,
+		"KIROMON_PID=" + strconv.Itoa(e.PID),
+		"KIROMON_COMMAND=" + e.Command,
+		"KIROMON_MESSAGE=" + e.Message,
+		"KIROMON_LAST_LINE=" + e.LastLine,
+		"KIROMON_TIME=" + e.Time.Format(time.RFC3339),
+		"KIROMON_DURATION_SECONDS=" + strconv.Itoa(int(e.Duration().Seconds())),
+	}
+	if !e.TaskStart.IsZero() {
+		env = append(env, "KIROMON_TASK_START="+e.TaskStart.Format(time.RFC3339))
+	}
+	if e.ExitCode != nil {
+		env = append(env, "KIROMON_EXIT_CODE="+e.exitCodeString(), "KIROMON_SIGNAL="+e.Signal)
+	}
+	if e.Transcript != "" {
+		env = append(env, "KIROMON_TRANSCRIPT="+e.Transcript)
+	}
+	if e.PrevState != "" {
+		env = append(env, "KIROMON_PREV_STATE="+e.PrevState)
+	}
+	if e.ErrorLine != "" {
+		env = append(env, "KIROMON_ERROR_LINE="+e.ErrorLine)
+	}
+	return env
+}
+
+// buildNotifyCommand expands a command template for an event. When the
+// template has no placeholders the message is appended as the last argument,
+// so a bare command such as "notify-send" keeps working.
+func buildNotifyCommand(tmpl CommandTemplate, ev NotifyEvent) *exec.Cmd {
+	args := make([]string, len(tmpl))
+	hasPlaceholder := false
+	for i, arg := range tmpl {
+		if placeholderRe.MatchString(arg) {
+			hasPlaceholder = true
+		}
+		args[i] = ev.expand(arg)
+	}
+	if !hasPlaceholder && ev.Message != "" {
+		args = append(args, ev.Message)
+	}
+
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Env = append(os.Environ(), ev.environ()...)
+	return cmd
+}
+
+// runNotifyCommand runs the notifier for an event and returns its combined output
+func runNotifyCommand(tmpl CommandTemplate, ev NotifyEvent) ([]byte, error) {
+	if len(tmpl) == 0 {
+		return nil, nil
+	}
+	return buildNotifyCommand(tmpl, ev).CombinedOutput()
+}
+
 // replacePlaceholders replaces {time} and {duration} in message
 func replacePlaceholders(msg string, taskStart time.Time) string {
 	now := time.Now()
@@ -77,8 +291,112 @@ func logToFile(config *StandaloneConfig, format string, args ...interface{}) {
 	}
 }
 
+// daemonLog prints a timestamped daemon message
+func daemonLog(format string, args ...interface{}) {
+	fmt.Fprintf(daemonOutput(), "[%s] %s\n", time.Now().Format("15:04:05"), fmt.Sprintf(format, args...))
+}
+
+// notifyTerminated sends the stopped event for a process that exited or
+// disappeared, the error event when it is known to have failed, and the
+// transition from prevShown, the last displayed state, if it was seen
+func notifyTerminated(status *Status, prevShown string, sinks []*notifySink, exitMsg string) {
+	ev := NotifyEvent{
+		Event:      EventStopped,
+		State:      StateStopped,
+		PID:        status.PID,
+		Command:    status.Command,
+		Message:    fmt.Sprintf("PID %d (%s) が終了しました", status.PID, status.Command),
+		LastLine:   status.LastLine,
+		TaskStart:  status.TaskStartTime,
+		Time:       time.Now(),
+		ExitCode:   status.ExitCode,
+		Signal:     status.Signal,
+		Transcript: status.Transcript,
+	}
+	if status.ExitCode != nil {
+		ev.Message = fmt.Sprintf("PID %d (%s) が終了しました (exit %d)", status.PID, status.Command, *status.ExitCode)
+	}
+	if exitMsg != "" {
+		ev.Message = ev.expand(exitMsg)
+	}
+	dispatchNotification(sinks, ev, daemonLog)
+	if status.ExitCode != nil && *status.ExitCode != 0 {
+		ev.Event = EventError
+		dispatchNotification(sinks, ev, daemonLog)
+	}
+	if prevShown != "" {
+		ev.Event, ev.PrevState = EventTransition, prevShown
+		ev.Message = fmt.Sprintf("PID %d (%s): %s → %s", status.PID, status.Command, prevShown, StateStopped)
+		dispatchNotification(sinks, ev, daemonLog)
+	}
+}
+
+// exitSinkEvents returns the events for the -c command and -w webhook:
+// stopped is added when an exit message is configured
+func exitSinkEvents(exitMsg string) []string {
+	if exitMsg == "" {
+		return defaultSinkEvents
+	}
+	return append(append([]string{}, defaultSinkEvents...), EventStopped)
+}
+
+// failedSinkEvents adds failed to the events of the -c command and -w
+// webhook when an error message is configured
+func failedSinkEvents(events []string, errMsg string) []string {
+	if errMsg == "" {
+		return events
+	}
+	return addSinkEvent(events, EventFailed)
+}
+
+// addSinkEvent returns a copy of events with event appended
+func addSinkEvent(events []string, event string) []string {
+	return append(append([]string{}, events...), event)
+}
+
+// notifyStuck sends the stuck event when the wrapper's watchdog raises an
+// alert for the running task, once per alert reason
+func notifyStuck(status *Status, lastStuck map[int]string, taskStartTimes map[int]time.Time, sinks []*notifySink, stuckMsg string) {
+	prev := lastStuck[status.PID]
+	lastStuck[status.PID] = status.Stuck
+	if status.Stuck == "" || status.Stuck == prev {
+		return
+	}
+	taskStart := taskStartTimes[status.PID]
+	if status.TaskStartTime.After(taskStart) {
+		taskStart = status.TaskStartTime
+	}
+	ev := NotifyEvent{
+		Event:     EventStuck,
+		State:     status.State,
+		PID:       status.PID,
+		Command:   status.Command,
+		LastLine:  status.LastLine,
+		TaskStart: taskStart,
+		Time:      time.Now(),
+	}
+	if status.Stuck == StuckSilent {
+		ev.Message = fmt.Sprintf("PID %d (%s) の出力が止まっています（実行中 %s）", status.PID, status.Command, formatDuration(ev.Duration()))
+	} else {
+		ev.Message = fmt.Sprintf("PID %d (%s) のタスクが%s実行中です", status.PID, status.Command, formatDuration(ev.Duration()))
+	}
+	if stuckMsg != "" {
+		ev.Message = ev.expand(stuckMsg)
+	}
+	logDaemonEvent(DaemonEvent{
+		Event:        DaemonStuck,
+		PID:          status.PID,
+		State:        status.State,
+		Command:      status.Command,
+		LastLine:     status.LastLine,
+		Notification: EventStuck,
+		Message:      ev.Message,
+	}, fmt.Sprintf("PID %d: ⚠ %s", status.PID, ev.Message))
+	dispatchNotification(sinks, ev, daemonLog)
+}
+
 // checkAndNotify checks for state changes and sends notifications
-func checkAndNotify(status *Status, customPromptRe *regexp.Regexp, lastStates map[int]string, taskStartTimes map[int]time.Time, command, startMsg, endMsg string) {
+func checkAndNotify(status *Status, customPromptRe *regexp.Regexp, lastStates, lastShown map[int]string, taskStartTimes map[int]time.Time, sinks []*notifySink, startMsg, endMsg, errMsg string) {
 	// Determine state using custom pattern if provided
 	currentState := status.State
 	if customPromptRe != nil {
@@ -98,6 +416,7 @@ func checkAndNotify(status *Status, customPromptRe *regexp.Regexp, lastStates ma
 
 		if currentState == StateWaiting {
 			message = replacePlaceholders(endMsg, taskStart)
+			message = strings.ReplaceAll(message, "{transcript}", status.Transcript)
 		} else if currentState == StateRunning && lastState == StateWaiting {
 			message = replacePlaceholders(startMsg, taskStart)
 			// Reset task start time for next cycle
@@ -107,25 +426,98 @@ func checkAndNotify(status *Status, customPromptRe *regexp.Regexp, lastStates ma
 			taskStartTimes[status.PID] = time.Now()
 		}
 
-		// Print state change
+		// Notify only on transitions, not when first seeing a PID
+		event := ""
+		if currentState == StateWaiting {
+			event = EventEnd
+			if status.TaskFailed {
+				event = EventFailed
+			}
+		} else if currentState == StateRunning {
+			event = EventStart
+		}
+		notify := lastState != "" && event != ""
+
+		ev := NotifyEvent{
+			Event:      event,
+			State:      currentState,
+			PID:        status.PID,
+			Command:    status.Command,
+			Message:    message,
+			LastLine:   status.LastLine,
+			TaskStart:  taskStart,
+			Time:       time.Now(),
+			Transcript: status.Transcript,
+		}
+		if event == EventFailed {
+			ev.ErrorLine = status.ErrorLine
+			if errMsg != "" {
+				ev.Message = ev.expand(errMsg)
+			}
+		}
+
+		// Log state change
 		stateIcon := "🔄"
 		if currentState == StateWaiting {
 			stateIcon = "⏳"
 		}
-		fmt.Printf("[%s] PID %d: %s %s\n", time.Now().Format("15:04:05"), status.PID, stateIcon, currentState)
-
-		// Only execute command if message is not empty
-		if message != "" && lastState != "" {
-			fmt.Printf("[%s] %s\n", time.Now().Format("15:04:05"), message)
+		logged := DaemonEvent{
+			Event:     DaemonStateChange,
+			PID:       status.PID,
+			State:     currentState,
+			PrevState: lastState,
+			Command:   status.Command,
+			LastLine:  status.LastLine,
+		}
+		if notify {
+			logged.Notification = event
+			logged.Message = ev.Message
+		}
+		logDaemonEvent(logged, fmt.Sprintf("PID %d: %s %s", status.PID, stateIcon, currentState))
 
-			if command != "" {
-				go func(msg string) {
-					cmd := exec.Command(command, msg)
-					cmd.Run()
-				}(message)
+		if notify {
+			if event == EventFailed && daemonFormat == FormatText {
+				daemonLog("PID %d: ❌ task failed: %s", status.PID, status.ErrorLine)
 			}
+			if ev.Message != "" && daemonFormat == FormatText {
+				daemonLog("%s", ev.Message)
+			}
+
+			dispatchNotification(sinks, ev, daemonLog)
 		}
 
 		lastStates[status.PID] = currentState
 	}
+
+	// Transitions of the displayed state, declared states included
+	shown := displayState(currentState, status.Substate)
+	if prev, seen := lastShown[status.PID]; seen && prev != shown {
+		message := fmt.Sprintf("PID %d (%s): %s → %s", status.PID, status.Command, prev, shown)
+		// Changes between built-in states are already logged as state changes
+		if isDeclaredState(prev) || isDeclaredState(shown) {
+			logDaemonEvent(DaemonEvent{
+				Event:        DaemonTransition,
+				PID:          status.PID,
+				State:        shown,
+				PrevState:    prev,
+				Command:      status.Command,
+				LastLine:     status.LastLine,
+				Notification: EventTransition,
+				Message:      message,
+			}, fmt.Sprintf("PID %d: %s %s -> %s", status.PID, statusIcon(status), prev, shown))
+		}
+		dispatchNotification(sinks, NotifyEvent{
+			Event:      EventTransition,
+			State:      shown,
+			PrevState:  prev,
+			PID:        status.PID,
+			Command:    status.Command,
+			Message:    message,
+			LastLine:   status.LastLine,
+			TaskStart:  taskStartTimes[status.PID],
+			Time:       time.Now(),
+			Transcript: status.Transcript,
+		}, daemonLog)
+	}
+	lastShown[status.PID] = shown
 }
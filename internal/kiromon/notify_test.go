@@ -4,6 +4,8 @@ import (
 	"strings"
 	"testing"
 	"time"
+
+	"gopkg.in/yaml.v3"
 )
 
 func TestFormatTimeJapanese(t *testing.T) {
@@ -96,3 +98,149 @@ func TestReplacePlaceholders(t *testing.T) {
 		})
 	}
 }
+
+func TestParseCommandTemplate(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected []string
+		wantErr  bool
+	}{
+		{"bare command", "notify-send", []string{"notify-send"}, false},
+		{"arguments", "notify-send -u critical", []string{"notify-send", "-u", "critical"}, false},
+		{"double quotes", `notify-send -a kiromon "task {state}" "{message}"`, []string{"notify-send", "-a", "kiromon", "task {state}", "{message}"}, false},
+		{"single quotes", `sh -c 'echo "$KIROMON_STATE"'`, []string{"sh", "-c", `echo "$KIROMON_STATE"`}, false},
+		{"escapes", `say a\ b "q\"uote"`, []string{"say", "a b", `q"uote`}, false},
+		{"empty quoted arg", `cmd ""`, []string{"cmd", ""}, false},
+		{"japanese", "voicevox-speak 完了 ", []string{"voicevox-speak", "完了"}, false},
+		{"empty", "", nil, false},
+		{"unterminated", `cmd "oops`, nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := parseCommandTemplate(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseCommandTemplate(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+			}
+			if strings.Join(result, "|") != strings.Join(tt.expected, "|") || len(result) != len(tt.expected) {
+				t.Errorf("parseCommandTemplate(%q) = %q, want %q", tt.input, result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestCommandTemplateYAML(t *testing.T) {
+	var config FileConfig
+	data := `
+default_command: notify-send -u critical
+presets:
+  kiro-cli:
+    command: ["notify-send", "-a", "kiromon", "{message}"]
+`
+	if err := yaml.Unmarshal([]byte(data), &config); err != nil {
+		t.Fatalf("Unmarshal() error = %v", err)
+	}
+	if got := strings.Join(config.DefaultCommand, "|"); got != "notify-send|-u|critical" {
+		t.Errorf("DefaultCommand = %q", config.DefaultCommand)
+	}
+	if got := strings.Join(config.Presets["kiro-cli"].Command, "|"); got != "notify-send|-a|kiromon|{message}" {
+		t.Errorf("preset Command = %q", config.Presets["kiro-cli"].Command)
+	}
+}
+
+func TestBuildNotifyCommand(t *testing.T) {
+	now := time.Date(2024, 1, 1, 14, 30, 0, 0, time.UTC)
+	ev := NotifyEvent{
+		State:     StateWaiting,
+		PID:       4242,
+		Command:   "kiro-cli chat",
+		Message:   "完了",
+		LastLine:  "> ",
+		TaskStart: now.Add(-90 * time.Second),
+		Time:      now,
+	}
+
+	t.Run("bare command appends message", func(t *testing.T) {
+		cmd := buildNotifyCommand(CommandTemplate{"notify-send"}, ev)
+		if got := strings.Join(cmd.Args, "|"); got != "notify-send|完了" {
+			t.Errorf("Args = %q", cmd.Args)
+		}
+	})
+
+	t.Run("placeholders", func(t *testing.T) {
+		tmpl := CommandTemplate{"notify-send", "-u", "critical", "kiromon {state} ({pid})", "{message} {duration}"}
+		cmd := buildNotifyCommand(tmpl, ev)
+		want := "notify-send|-u|critical|kiromon waiting (4242)|完了 1分30秒"
+		if got := strings.Join(cmd.Args, "|"); got != want {
+			t.Errorf("Args = %q, want %q", got, want)
+		}
+	})
+
+	t.Run("other braces are not placeholders", func(t *testing.T) {
+		cmd := buildNotifyCommand(CommandTemplate{"awk", "{print}", "{foo}"}, ev)
+		if got := strings.Join(cmd.Args, "|"); got != "awk|{print}|{foo}|完了" {
+			t.Errorf("Args = %q", cmd.Args)
+		}
+	})
+
+	t.Run("every placeholder is known", func(t *testing.T) {
+		for _, name := range placeholderNames {
+			if got := ev.expand("{" + name + "}"); got == "{"+name+"}" {
+				t.Errorf("expand does not replace {%s}", name)
+			}
+		}
+	})
+
+	t.Run("environment", func(t *testing.T) {
+		cmd := buildNotifyCommand(CommandTemplate{"true"}, ev)
+		env := strings.Join(cmd.Env, "\n")
+		for _, want := range []string{
+			"KIROMON_STATE=waiting",
+			"KIROMON_PID=4242",
+			"KIROMON_COMMAND=kiro-cli chat",
+			"KIROMON_MESSAGE=完了",
+			"KIROMON_LAST_LINE=> ",
+			"KIROMON_DURATION_SECONDS=90",
+		} {
+			if !strings.Contains(env, want+"\n") && !strings.HasSuffix(env, want) {
+				t.Errorf("environment missing %q", want)
+			}
+		}
+	})
+	t.Run("exit code", func(t *testing.T) {
+		code := 137
+		exited := ev
+		exited.Event = EventStopped
+		exited.ExitCode = &code
+		exited.Signal = "SIGKILL"
+		cmd := buildNotifyCommand(CommandTemplate{"notify-send", "{event} {exit_code} {signal}"}, exited)
+		if got := strings.Join(cmd.Args, "|"); got != "notify-send|stopped 137 SIGKILL" {
+			t.Errorf("Args = %q", cmd.Args)
+		}
+		env := strings.Join(cmd.Env, "\n")
+		if !strings.Contains(env, "KIROMON_EXIT_CODE=137") || !strings.Contains(env, "KIROMON_SIGNAL=SIGKILL") {
+			t.Errorf("environment missing exit code: %q", env)
+		}
+
+		// Without an exit code the placeholder is empty and nothing is exported
+		if got := ev.expand("[{exit_code}]"); got != "[]" {
+			t.Errorf("expand() = %q", got)
+		}
+		if env := strings.Join(buildNotifyCommand(CommandTemplate{"true"}, ev).Env, "\n"); strings.Contains(env, "KIROMON_EXIT_CODE") {
+			t.Error("KIROMON_EXIT_CODE set for a running command")
+		}
+	})
+}
+
+func TestExitSinkEvents(t *testing.T) {
+	if got := exitSinkEvents(""); strings.Join(got, ",") != "start,end" {
+		t.Errorf("exitSinkEvents(\"\") = %v", got)
+	}
+	if got := exitSinkEvents("bye"); strings.Join(got, ",") != "start,end,stopped" {
+		t.Errorf("exitSinkEvents(\"bye\") = %v", got)
+	}
+	if len(defaultSinkEvents) != 2 {
+		t.Errorf("defaultSinkEvents modified: %v", defaultSinkEvents)
+	}
+}
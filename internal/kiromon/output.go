@@ -0,0 +1,182 @@
+package kiromon
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// Output formats for -s, -p, -l and the status daemon
+const (
+	FormatText   = "text"
+	FormatJSON   = "json"
+	FormatNDJSON = "ndjson"
+)
+
+// OutputSchemaVersion is the version of the JSON / NDJSON output schema.
+// Fields may be added without a bump; it changes only when existing
+// fields are renamed, removed or change meaning.
+const OutputSchemaVersion = 1
+
+// Daemon log event types
+const (
+	DaemonStateChange = "state_change"
+	DaemonTerminated  = "terminated"
+	DaemonNotFound    = "not_found"
+	DaemonTransition  = "transition" // the displayed state changed, declared states included
+	DaemonRemind      = "remind"     // a reminder was sent for a process still waiting
+	DaemonStuck       = "stuck"      // the wrapper's watchdog raised an alert
+)
+
+// daemonFormat selects how the status daemon logs state changes
+var daemonFormat = FormatText
+
+// ProcessReport describes one monitored process in machine-readable output
+type ProcessReport struct {
+	Name         string    `json:"name"`
+	State        string    `json:"state"`
+	Command      string    `json:"command"`
+	PID          int       `json:"pid"`
+	StartTime    time.Time `json:"start_time"`
+	UpdatedAt    time.Time `json:"updated_at"`
+	LastLine     string    `json:"last_line"`
+	LastLines    []string  `json:"last_lines"`
+	IdleDetected bool      `json:"idle_detected"`
+	IdleSeconds  float64   `json:"idle_seconds"`
+
+	// Added with status schema version 2; empty for older wrappers
+	Cwd            string     `json:"cwd,omitempty"`
+	Hostname       string     `json:"hostname,omitempty"`
+	TTY            string     `json:"tty,omitempty"`
+	KiromonVersion string     `json:"kiromon_version,omitempty"`
+	ExitCode       *int       `json:"exit_code,omitempty"`
+	Signal         string     `json:"signal,omitempty"`
+	EndTime        *time.Time `json:"end_time,omitempty"`
+	TaskCount      int        `json:"task_count"`
+	TaskStartTime  time.Time  `json:"task_start_time"`
+	StateChangedAt time.Time  `json:"state_changed_at"`
+	Reason         string     `json:"reason,omitempty"`
+	Transcript     string     `json:"transcript,omitempty"`
+	WaitingFor     string     `json:"waiting_for,omitempty"`
+	Substate       string     `json:"substate,omitempty"`
+	StateIcon      string     `json:"state_icon,omitempty"`
+	TaskFailed     bool       `json:"task_failed,omitempty"`
+	ErrorLine      string     `json:"error_line,omitempty"`
+	Stuck          string     `json:"stuck,omitempty"`
+	LastInputAt    *time.Time `json:"last_input_at,omitempty"`
+}
+
+// StatusReport is the single document printed by --json
+type StatusReport struct {
+	SchemaVersion int             `json:"schema_version"`
+	Processes     []ProcessReport `json:"processes"`
+}
+
+// ProcessLine is one line printed by --ndjson for -s, -p and -l
+type ProcessLine struct {
+	SchemaVersion int `json:"schema_version"`
+	ProcessReport
+}
+
+// DaemonEvent is one line of the daemon's --ndjson log
+type DaemonEvent struct {
+	SchemaVersion int       `json:"schema_version"`
+	Time          time.Time `json:"time"`
+	Event         string    `json:"event"` // DaemonStateChange, DaemonTransition, DaemonTerminated or DaemonNotFound
+	PID           int       `json:"pid"`
+	State         string    `json:"state,omitempty"`
+	PrevState     string    `json:"prev_state,omitempty"`
+	Command       string    `json:"command,omitempty"`
+	LastLine      string    `json:"last_line,omitempty"`
+	Notification  string    `json:"notification,omitempty"` // EventStart, EventEnd, EventFailed, EventRemind or EventTransition when notifiers were called
+	Message       string    `json:"message,omitempty"`
+	ExitCode      *int      `json:"exit_code,omitempty"` // for DaemonTerminated, when the wrapper recorded it
+	Signal        string    `json:"signal,omitempty"`
+}
+
+// newProcessReport converts a status file to its report form
+func newProcessReport(name string, status *Status) ProcessReport {
+	lines := status.LastLines
+	if lines == nil {
+		lines = []string{}
+	}
+	return ProcessReport{
+		Name:         name,
+		State:        status.State,
+		Command:      status.Command,
+		PID:          status.PID,
+		StartTime:    status.StartTime,
+		UpdatedAt:    status.UpdatedAt,
+		LastLine:     status.LastLine,
+		LastLines:    lines,
+		IdleDetected: status.IdleDetected,
+		IdleSeconds:  status.IdleSeconds,
+
+		Cwd:            status.Cwd,
+		Hostname:       status.Hostname,
+		TTY:            status.TTY,
+		KiromonVersion: status.KiromonVersion,
+		ExitCode:       status.ExitCode,
+		Signal:         status.Signal,
+		EndTime:        status.EndTime,
+		TaskCount:      status.TaskCount,
+		TaskStartTime:  status.TaskStartTime,
+		StateChangedAt: status.StateChangedAt,
+		Reason:         status.Reason,
+		Transcript:     status.Transcript,
+		WaitingFor:     status.WaitingFor,
+		Substate:       status.Substate,
+		StateIcon:      status.StateIcon,
+		TaskFailed:     status.TaskFailed,
+		ErrorLine:      status.ErrorLine,
+		Stuck:          status.Stuck,
+		LastInputAt:    status.LastInputAt,
+	}
+}
+
+// writeReports prints processes as a JSON document or as NDJSON lines
+func writeReports(w io.Writer, format string, processes []ProcessReport) error {
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	if format == FormatNDJSON {
+		for _, p := range processes {
+			if err := enc.Encode(ProcessLine{SchemaVersion: OutputSchemaVersion, ProcessReport: p}); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if processes == nil {
+		processes = []ProcessReport{}
+	}
+	enc.SetIndent("", "  ")
+	return enc.Encode(StatusReport{SchemaVersion: OutputSchemaVersion, Processes: processes})
+}
+
+// daemonOutput is where the daemon prints informational text. In NDJSON
+// mode stdout carries only events, so everything else goes to stderr.
+func daemonOutput() io.Writer {
+	if daemonFormat == FormatText {
+		return os.Stdout
+	}
+	return os.Stderr
+}
+
+// logDaemonEvent records a daemon log entry as text or as an NDJSON line
+func logDaemonEvent(ev DaemonEvent, text string) {
+	if ev.Time.IsZero() {
+		ev.Time = time.Now()
+	}
+	if daemonFormat == FormatText {
+		fmt.Printf("[%s] %s\n", ev.Time.Format("15:04:05"), text)
+		return
+	}
+
+	ev.SchemaVersion = OutputSchemaVersion
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetEscapeHTML(false)
+	enc.Encode(ev)
+}
@@ -0,0 +1,85 @@
+package kiromon
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWriteReportsJSON(t *testing.T) {
+	status := &Status{State: StateWaiting, Command: "kiro-cli chat", PID: 42, LastLine: "> ", UpdatedAt: time.Now()}
+
+	var buf bytes.Buffer
+	if err := writeReports(&buf, FormatJSON, []ProcessReport{newProcessReport("kiro-cli", status)}); err != nil {
+		t.Fatal(err)
+	}
+
+	var doc map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &doc); err != nil {
+		t.Fatalf("invalid JSON %q: %v", buf.String(), err)
+	}
+	if doc["schema_version"] != float64(OutputSchemaVersion) {
+		t.Errorf("schema_version = %v", doc["schema_version"])
+	}
+	processes := doc["processes"].([]interface{})
+	if len(processes) != 1 {
+		t.Fatalf("processes = %v", processes)
+	}
+	p := processes[0].(map[string]interface{})
+	if p["name"] != "kiro-cli" || p["state"] != StateWaiting || p["pid"] != float64(42) || p["last_line"] != "> " {
+		t.Errorf("process = %v", p)
+	}
+	// Missing output is an empty list, not null
+	if lines, ok := p["last_lines"].([]interface{}); !ok || len(lines) != 0 {
+		t.Errorf("last_lines = %v", p["last_lines"])
+	}
+}
+
+func TestWriteReportsEmpty(t *testing.T) {
+	var buf bytes.Buffer
+	writeReports(&buf, FormatJSON, nil)
+	if !strings.Contains(buf.String(), `"processes": []`) {
+		t.Errorf("empty report = %s", buf.String())
+	}
+
+	buf.Reset()
+	writeReports(&buf, FormatNDJSON, nil)
+	if buf.Len() != 0 {
+		t.Errorf("empty NDJSON = %q", buf.String())
+	}
+}
+
+func TestWriteReportsNDJSON(t *testing.T) {
+	reports := []ProcessReport{
+		newProcessReport("kiro-cli", &Status{State: StateRunning, PID: 1, LastLines: []string{"<b>"}}),
+		newProcessReport("vim", &Status{State: StateWaiting, PID: 2}),
+	}
+
+	var buf bytes.Buffer
+	if err := writeReports(&buf, FormatNDJSON, reports); err != nil {
+		t.Fatal(err)
+	}
+
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("got %d lines: %q", len(lines), buf.String())
+	}
+	if !strings.Contains(lines[0], `"<b>"`) {
+		t.Errorf("HTML should not be escaped: %s", lines[0])
+	}
+	for i, line := range lines {
+		var p struct {
+			SchemaVersion int    `json:"schema_version"`
+			Name          string `json:"name"`
+			PID           int    `json:"pid"`
+		}
+		if err := json.Unmarshal([]byte(line), &p); err != nil {
+			t.Fatalf("line %d %q: %v", i, line, err)
+		}
+		if p.SchemaVersion != OutputSchemaVersion || p.Name != reports[i].Name || p.PID != reports[i].PID {
+			t.Errorf("line %d = %+v", i, p)
+		}
+	}
+}
@@ -0,0 +1,13 @@
+//go:build !linux && !darwin
+
+package kiromon
+
+import (
+	"errors"
+	"net"
+)
+
+// peerUID is unavailable on this platform, so attach connections are refused
+func peerUID(conn *net.UnixConn) (int, error) {
+	return -1, errors.New("peer credentials are not supported on this platform")
+}
@@ -1,19 +1,22 @@
 package kiromon
 
 import (
+	"fmt"
 	"regexp"
 	"strings"
+	"unicode/utf8"
 )
 
 var ansiRegex = regexp.MustCompile(`\x1b\[[0-9;?]*[a-zA-Z]|\x1b\][^\x07]*\x07|\x1b\][^\x1b]*\x1b\\|\x1b[PX^_].*?(?:\x1b\\|\x07)|\x1b.|\?[0-9]+[hl]`)
 
-// stripAnsi removes ANSI escape sequences and control characters from a string
+// stripAnsi removes ANSI escape sequences and control characters from a string.
+// Printable Unicode text (CJK, emoji, combining marks) is kept.
 func stripAnsi(s string) string {
 	s = ansiRegex.ReplaceAllString(s, "")
-	// Remove other control characters
+	// Remove other control characters and invalid UTF-8
 	var result strings.Builder
 	for _, r := range s {
-		if r >= 32 && r < 127 {
+		if r != utf8.RuneError && isPrintableRune(r) {
 			result.WriteRune(r)
 		}
 	}
@@ -23,20 +26,86 @@ func stripAnsi(s string) string {
 // runningKeywords are lines that indicate active processing
 var runningKeywords = []string{"Thinking...", "Running...", "Read", "Write", "Shell", "Task"}
 
-// isRunningLine returns true if the line contains a known active-processing keyword
-func isRunningLine(line string) bool {
+// promptMarker is the text shown in kiro-cli's input box when waiting for user input
+const promptMarker = "ask a question or describe a task"
+
+// promptScanLines is how many trailing screen-buffer lines are scanned for the
+// input prompt marker when deciding the waiting state.
+const promptScanLines = 3
+
+// PromptRules holds the patterns used to classify screen lines of a wrapped command
+type PromptRules struct {
+	Prompt    *regexp.Regexp   // matches the input-waiting prompt
+	Running   []*regexp.Regexp // match lines that indicate active processing
+	ScanLines int              // trailing lines scanned for the prompt
+}
+
+// defaultPromptRules returns the built-in rules tuned for kiro-cli
+func defaultPromptRules() *PromptRules {
+	rules := &PromptRules{
+		Prompt:    regexp.MustCompile(`(?i)` + regexp.QuoteMeta(promptMarker)),
+		ScanLines: promptScanLines,
+	}
 	for _, kw := range runningKeywords {
-		if strings.Contains(line, kw) {
+		rules.Running = append(rules.Running, regexp.MustCompile(regexp.QuoteMeta(kw)))
+	}
+	return rules
+}
+
+// newPromptRules compiles prompt rules, falling back to the defaults for unset fields
+func newPromptRules(promptPattern string, runningPatterns []string, scanLines int) (*PromptRules, error) {
+	rules := defaultPromptRules()
+
+	if promptPattern != "" {
+		re, err := regexp.Compile(promptPattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid prompt_pattern: %w", err)
+		}
+		rules.Prompt = re
+	}
+
+	if runningPatterns != nil {
+		rules.Running = nil
+		for _, p := range runningPatterns {
+			re, err := regexp.Compile(p)
+			if err != nil {
+				return nil, fmt.Errorf("invalid running_keywords entry %q: %w", p, err)
+			}
+			rules.Running = append(rules.Running, re)
+		}
+	}
+
+	if scanLines > 0 {
+		rules.ScanLines = scanLines
+	}
+
+	return rules, nil
+}
+
+// isRunningLine returns true if the line matches any active-processing pattern
+func (r *PromptRules) isRunningLine(line string) bool {
+	for _, re := range r.Running {
+		if re.MatchString(line) {
 			return true
 		}
 	}
 	return false
 }
 
-// promptMarker is the text shown in kiro-cli's input box when waiting for user input
-const promptMarker = "ask a question or describe a task"
+// isPromptLine returns true if the line matches the input-waiting prompt pattern
+func (r *PromptRules) isPromptLine(line string) bool {
+	return r.Prompt.MatchString(line)
+}
+
+// defaultRules are the rules used when no preset overrides them
+var defaultRules = defaultPromptRules()
+
+// isRunningLine returns true if the line contains a known active-processing keyword
+func isRunningLine(line string) bool {
+	return defaultRules.isRunningLine(line)
+}
 
 // isPromptLine returns true if the line contains the input-waiting prompt marker
 func isPromptLine(line string) bool {
-	return strings.Contains(strings.ToLower(line), promptMarker)
+	return defaultRules.isPromptLine(line)
 }
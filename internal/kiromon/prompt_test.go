@@ -14,9 +14,15 @@ func TestStripAnsi(t *testing.T) {
 		{"with color", "\x1b[32mgreen\x1b[0m", "green"},
 		{"with bold", "\x1b[1mbold\x1b[0m", "bold"},
 		{"prompt with escape", "\x1b[?2004h> ", ">"},
-		{"complex escapes", "\x1b[0;32m➜\x1b[0m \x1b[36mdir\x1b[0m", "dir"},
+		{"complex escapes", "\x1b[0;32m➜\x1b[0m \x1b[36mdir\x1b[0m", "➜ dir"},
 		{"empty string", "", ""},
 		{"only escapes", "\x1b[0m\x1b[1m", ""},
+		{"japanese", "\x1b[1m日本語>\x1b[0m ", "日本語>"},
+		{"emoji", "\x1b[32m✅ 完了 🎉\x1b[0m", "✅ 完了 🎉"},
+		{"combining marks", "が\u3099 e\u0301", "が\u3099 e\u0301"},
+		{"zwj emoji", "👨\u200d💻 coding", "👨\u200d💻 coding"},
+		{"control characters", "a\tb\x07c\x00d", "abcd"},
+		{"invalid utf8", "ok\xff\xfe!", "ok!"},
 	}
 
 	for _, tt := range tests {
@@ -55,3 +61,62 @@ func TestIsRunningLine(t *testing.T) {
 		})
 	}
 }
+
+func TestNewPromptRules(t *testing.T) {
+	t.Run("defaults", func(t *testing.T) {
+		rules, err := newPromptRules("", nil, 0)
+		if err != nil {
+			t.Fatalf("newPromptRules() error = %v", err)
+		}
+		if !rules.isPromptLine("│ Ask a question or describe a task") {
+			t.Error("default prompt should match kiro-cli input box")
+		}
+		if !rules.isRunningLine("⠙ Thinking...") {
+			t.Error("default running keywords should match Thinking...")
+		}
+		if rules.ScanLines != promptScanLines {
+			t.Errorf("ScanLines = %d, want %d", rules.ScanLines, promptScanLines)
+		}
+	})
+
+	t.Run("preset overrides", func(t *testing.T) {
+		rules, err := newPromptRules(`^>>> ?$`, []string{`^\.\.\. `, `Traceback`}, 5)
+		if err != nil {
+			t.Fatalf("newPromptRules() error = %v", err)
+		}
+		if !rules.isPromptLine(">>> ") {
+			t.Error("custom prompt should match python prompt")
+		}
+		if rules.isPromptLine("ask a question or describe a task") {
+			t.Error("custom prompt should replace the kiro-cli marker")
+		}
+		if !rules.isRunningLine("Traceback (most recent call last):") {
+			t.Error("custom running pattern should match")
+		}
+		if rules.isRunningLine("Thinking...") {
+			t.Error("custom running patterns should replace the defaults")
+		}
+		if rules.ScanLines != 5 {
+			t.Errorf("ScanLines = %d, want 5", rules.ScanLines)
+		}
+	})
+
+	t.Run("empty running list disables keywords", func(t *testing.T) {
+		rules, err := newPromptRules("", []string{}, 0)
+		if err != nil {
+			t.Fatalf("newPromptRules() error = %v", err)
+		}
+		if rules.isRunningLine("Thinking...") {
+			t.Error("empty running_keywords should match nothing")
+		}
+	})
+
+	t.Run("invalid regex", func(t *testing.T) {
+		if _, err := newPromptRules("(", nil, 0); err == nil {
+			t.Error("expected error for invalid prompt_pattern")
+		}
+		if _, err := newPromptRules("", []string{"["}, 0); err == nil {
+			t.Error("expected error for invalid running_keywords")
+		}
+	})
+}
@@ -0,0 +1,281 @@
+package kiromon
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Operations on a wrapper's prompt queue
+const (
+	QueueAdd    = "add"
+	QueueList   = "list"
+	QueueClear  = "clear"
+	QueueResume = "resume"
+)
+
+// queueSettleDelay is how long the command must keep waiting before the next prompt is typed
+const queueSettleDelay = 2 * time.Second
+
+// QueueConfig holds the prompt queue settings of a preset
+type QueueConfig struct {
+	PauseOn []string `yaml:"pause_on"` // regexes; a match in a task's output stops feeding until kiromon queue resume
+}
+
+// promptQueue holds prompts the wrapper types one at a time, each time the
+// command starts waiting for input
+type promptQueue struct {
+	mu      sync.Mutex
+	items   []string
+	pauseOn *errorScanner // finds pause lines in the output of the current task
+	paused  string        // output line that paused the queue, empty while feeding
+
+	waitingSince time.Time // start of the current waiting period, zero while running
+	taskPause    string    // pause line in the output of the task that just ended
+	done         bool      // nothing more to do in this waiting period
+	resumed      bool      // resumed in this waiting period; skip the pause check
+}
+
+// newPromptQueue compiles the pause patterns of c, which may be nil
+func newPromptQueue(c *QueueConfig) (*promptQueue, error) {
+	patterns := []string{}
+	if c != nil {
+		for _, p := range c.PauseOn {
+			if _, err := regexp.Compile(p); err != nil {
+				return nil, fmt.Errorf("invalid queue pause pattern %q: %w", p, err)
+			}
+		}
+		patterns = append(patterns, c.PauseOn...)
+	}
+	pauseOn, err := newErrorScanner(patterns)
+	if err != nil {
+		return nil, err
+	}
+	return &promptQueue{pauseOn: pauseOn}, nil
+}
+
+// Write scans a chunk of PTY output for pause lines
+func (q *promptQueue) Write(p []byte) (int, error) {
+	return q.pauseOn.Write(p)
+}
+
+// Add appends prompts and returns the queue length
+func (q *promptQueue) Add(prompts ...string) int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.items = append(q.items, prompts...)
+	return len(q.items)
+}
+
+// List returns the queued prompts and why the queue is paused, if it is
+func (q *promptQueue) List() ([]string, string) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return append([]string(nil), q.items...), q.paused
+}
+
+// Clear removes all queued prompts and returns how many there were
+func (q *promptQueue) Clear() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	n := len(q.items)
+	q.items = nil
+	return n
+}
+
+// Resume lifts a pause. The output that caused it is not checked again, so
+// the next prompt is typed now if the command is still waiting.
+func (q *promptQueue) Resume() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.paused = ""
+	q.done = false
+	q.resumed = true
+}
+
+// Next is called on every status tick. It returns the prompt to type, if
+// the command has been waiting long enough without the user typing, and
+// the output line that paused the queue when a pause pattern matched the
+// task that just ended. Output shown while waiting, such as the typed
+// prompt, belongs to the next task.
+func (q *promptQueue) Next(state string, now, lastInput time.Time) (prompt, pausedBy string) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if state != StateWaiting {
+		q.waitingSince = time.Time{}
+		q.done = false
+		q.resumed = false
+		return "", ""
+	}
+	if q.waitingSince.IsZero() {
+		q.waitingSince = now
+		q.taskPause = q.pauseOn.EndTask()
+	}
+	if q.done || q.paused != "" || len(q.items) == 0 || now.Sub(q.waitingSince) < queueSettleDelay {
+		return "", ""
+	}
+	// Leave the prompt alone while someone is typing into it
+	if lastInput.After(q.waitingSince) && !q.resumed {
+		q.done = true
+		return "", ""
+	}
+	if q.taskPause != "" && !q.resumed {
+		q.paused = q.taskPause
+		q.done = true
+		return "", q.taskPause
+	}
+
+	prompt = q.items[0]
+	q.items = q.items[1:]
+	q.done = true
+	return prompt, ""
+}
+
+// Status returns the queue length and pause reason for the status file
+func (q *promptQueue) Status() (int, string) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.items), q.paused
+}
+
+// handleQueue answers a queue request on the PTY socket
+func (s *ptyServer) handleQueue(req attachRequest) attachReply {
+	if s.queue == nil {
+		return attachReply{Error: "prompt queue unavailable"}
+	}
+	switch req.Op {
+	case QueueAdd:
+		for _, p := range req.Input {
+			if strings.TrimSpace(p) == "" {
+				return attachReply{Error: "empty prompt"}
+			}
+		}
+		s.queue.Add(req.Input...)
+	case QueueClear:
+		s.queue.Clear()
+	case QueueResume:
+		s.queue.Resume()
+	case QueueList:
+	default:
+		return attachReply{Error: fmt.Sprintf("unknown queue operation %q", req.Op)}
+	}
+	items, paused := s.queue.List()
+	return attachReply{OK: true, Queue: items, Paused: paused}
+}
+
+// readPromptFile reads one prompt per line, skipping blank lines and # comments
+func readPromptFile(path string) ([]string, error) {
+	f, err := os.Open(expandHome(path))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var prompts []string
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		prompts = append(prompts, line)
+	}
+	return prompts, scanner.Err()
+}
+
+// parseQueueArgs parses kiromon queue <op> <pid> [-f <file>] [<text>...]
+func parseQueueArgs(args []string) (pid int, req attachRequest, err error) {
+	if len(args) < 2 {
+		return 0, req, fmt.Errorf("usage: kiromon queue add|list|clear|resume <pid>")
+	}
+	req.Mode = AttachQueue
+	req.Op = args[0]
+	switch req.Op {
+	case QueueAdd, QueueList, QueueClear, QueueResume:
+	default:
+		return 0, req, fmt.Errorf("unknown queue operation: %s", req.Op)
+	}
+	pid, err = strconv.Atoi(args[1])
+	if err != nil || pid <= 0 {
+		return 0, req, fmt.Errorf("invalid PID: %s", args[1])
+	}
+
+	var text []string
+	rest := args[2:]
+	for i := 0; i < len(rest); i++ {
+		switch rest[i] {
+		case "-f":
+			if i+1 >= len(rest) {
+				return 0, req, fmt.Errorf("-f requires a file path")
+			}
+			i++
+			prompts, err := readPromptFile(rest[i])
+			if err != nil {
+				return 0, req, err
+			}
+			req.Input = append(req.Input, prompts...)
+		case "--":
+			text = append(text, rest[i+1:]...)
+			i = len(rest)
+		default:
+			text = append(text, rest[i])
+		}
+	}
+	if len(text) > 0 {
+		req.Input = append(req.Input, strings.Join(text, " "))
+	}
+
+	if req.Op == QueueAdd && len(req.Input) == 0 {
+		return 0, req, fmt.Errorf("nothing to queue")
+	}
+	if req.Op != QueueAdd && len(req.Input) > 0 {
+		return 0, req, fmt.Errorf("queue %s takes no prompts", req.Op)
+	}
+	return pid, req, nil
+}
+
+// runQueue handles kiromon queue and returns the exit code
+func runQueue(args []string) int {
+	pid, req, err := parseQueueArgs(args)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		printWrapHint("queue")
+		return 1
+	}
+
+	filePath, err := findStatusFileByPID(pid)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "No status found for PID %d\n", pid)
+		return 1
+	}
+	conn, _, reply, err := dialAttach(getAttachSocketPath(filePath), req)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: queue for PID %d: %v\n", pid, err)
+		return 1
+	}
+	conn.Close()
+
+	switch req.Op {
+	case QueueAdd:
+		fmt.Printf("Queued %d prompt(s) for PID %d (%d pending)\n", len(req.Input), pid, len(reply.Queue))
+	case QueueClear:
+		fmt.Printf("Cleared the queue of PID %d\n", pid)
+	case QueueResume:
+		fmt.Printf("Resumed the queue of PID %d (%d pending)\n", pid, len(reply.Queue))
+	case QueueList:
+		fmt.Printf("PID %d: %d pending\n", pid, len(reply.Queue))
+		for i, p := range reply.Queue {
+			fmt.Printf("%3d. %s\n", i+1, p)
+		}
+	}
+	if reply.Paused != "" {
+		fmt.Printf("Paused by: %s\n", reply.Paused)
+	}
+	return 0
+}
@@ -0,0 +1,147 @@
+package kiromon
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestPromptQueue(t *testing.T) {
+	q, err := newPromptQueue(&QueueConfig{PauseOn: []string{`(?i)^error`}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	q.Add("first", "second", "third")
+	start := time.Now()
+	var noInput time.Time
+
+	// Nothing is typed while running or before the waiting state settles
+	if p, _ := q.Next(StateRunning, start, noInput); p != "" {
+		t.Errorf("typed %q while running", p)
+	}
+	if p, _ := q.Next(StateWaiting, start, noInput); p != "" {
+		t.Errorf("typed %q before settling", p)
+	}
+	if p, _ := q.Next(StateWaiting, start.Add(queueSettleDelay), noInput); p != "first" {
+		t.Errorf("Next() = %q, want first", p)
+	}
+	// Only one prompt per waiting period
+	if p, _ := q.Next(StateWaiting, start.Add(2*queueSettleDelay), noInput); p != "" {
+		t.Errorf("typed %q twice in one waiting period", p)
+	}
+
+	// The user typing in the waiting period holds the queue back
+	q.Next(StateRunning, start.Add(3*time.Second), noInput)
+	at := start.Add(10 * time.Second)
+	q.Next(StateWaiting, at, noInput)
+	if p, _ := q.Next(StateWaiting, at.Add(queueSettleDelay), at.Add(time.Second)); p != "" {
+		t.Errorf("typed %q over user input", p)
+	}
+
+	// An error in the task's output pauses the queue until it is resumed
+	q.Next(StateRunning, start.Add(20*time.Second), noInput)
+	q.Write([]byte("working\r\nError: quota exceeded\r\n> "))
+	at = start.Add(30 * time.Second)
+	q.Next(StateWaiting, at, noInput)
+	p, pausedBy := q.Next(StateWaiting, at.Add(queueSettleDelay), noInput)
+	if p != "" || pausedBy != "Error: quota exceeded" {
+		t.Errorf("Next() = %q, %q, want a pause", p, pausedBy)
+	}
+	if n, paused := q.Status(); n != 2 || paused == "" {
+		t.Errorf("Status() = %d, %q", n, paused)
+	}
+	q.Resume()
+	if p, _ := q.Next(StateWaiting, at.Add(2*queueSettleDelay), noInput); p != "second" {
+		t.Errorf("Next() after resume = %q, want second", p)
+	}
+
+	// The error still on screen does not pause the next waiting period;
+	// only the output of the task that just ended counts
+	q.Write([]byte("second\r\n"))
+	q.Next(StateRunning, start.Add(40*time.Second), noInput)
+	q.Write([]byte("done\r\n> "))
+	at = start.Add(50 * time.Second)
+	q.Next(StateWaiting, at, noInput)
+	if p, pausedBy := q.Next(StateWaiting, at.Add(queueSettleDelay), noInput); p != "third" || pausedBy != "" {
+		t.Errorf("Next() in the next waiting period = %q, %q, want third", p, pausedBy)
+	}
+
+	q.Add("fourth")
+	if n := q.Clear(); n != 1 {
+		t.Errorf("Clear() = %d, want 1", n)
+	}
+
+	if _, err := newPromptQueue(&QueueConfig{PauseOn: []string{"("}}); err == nil {
+		t.Error("expected error for an invalid pause pattern")
+	}
+}
+
+func TestParseQueueArgs(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "prompts.txt")
+	os.WriteFile(path, []byte("# overnight\nfix the tests\n\n  update the docs  \n"), 0600)
+
+	pid, req, err := parseQueueArgs([]string{"add", "42", "-f", path, "then", "commit"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"fix the tests", "update the docs", "then commit"}
+	if pid != 42 || req.Mode != AttachQueue || req.Op != QueueAdd || !reflect.DeepEqual(req.Input, want) {
+		t.Errorf("pid = %d, req = %+v", pid, req)
+	}
+
+	for _, args := range [][]string{
+		{"add"},
+		{"add", "42"},
+		{"pop", "42"},
+		{"add", "x", "hi"},
+		{"list", "42", "hi"},
+		{"add", "42", "-f", filepath.Join(t.TempDir(), "missing")},
+	} {
+		if _, _, err := parseQueueArgs(args); err == nil {
+			t.Errorf("parseQueueArgs(%q) accepted", args)
+		}
+	}
+}
+
+func TestPTYServerQueue(t *testing.T) {
+	dir, err := os.MkdirTemp("", "km")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "test-1.pty.sock")
+
+	queue, _ := newPromptQueue(nil)
+	server, err := newPTYServer(path, newVTScreen(4, 20, nil), func([]byte) error { return nil }, func() string { return StateRunning }, queue)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+
+	conn, _, reply, err := dialAttach(path, attachRequest{Mode: AttachQueue, Op: QueueAdd, Input: []string{"a", "b"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.Close()
+	if !reflect.DeepEqual(reply.Queue, []string{"a", "b"}) {
+		t.Errorf("queue = %q", reply.Queue)
+	}
+
+	if _, _, _, err := dialAttach(path, attachRequest{Mode: AttachQueue, Op: QueueAdd, Input: []string{" "}}); err == nil {
+		t.Error("empty prompt accepted")
+	}
+	if _, _, _, err := dialAttach(path, attachRequest{Mode: AttachQueue, Op: "pop"}); err == nil {
+		t.Error("unknown operation accepted")
+	}
+
+	conn, _, reply, err = dialAttach(path, attachRequest{Mode: AttachQueue, Op: QueueClear})
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.Close()
+	if len(reply.Queue) != 0 {
+		t.Errorf("queue after clear = %q", reply.Queue)
+	}
+}
@@ -0,0 +1,378 @@
+package kiromon
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// What happens to notifications while quiet
+const (
+	QuietDrop   = "drop"   // discard them
+	QuietSilent = "silent" // deliver them only to sinks marked silent
+	QuietDigest = "digest" // deliver one summary per sink once quiet ends
+)
+
+// focusCheckInterval is how long the result of the focus command is reused
+const focusCheckInterval = 30 * time.Second
+
+// focusCommandTimeout bounds one run of the focus command
+const focusCommandTimeout = 5 * time.Second
+
+// QuietConfig holds the quiet hours and do-not-disturb settings shared by
+// all wrappers and daemons
+type QuietConfig struct {
+	Hours        []string        `yaml:"hours"`         // windows such as "22:00-07:00", local time
+	Policy       string          `yaml:"policy"`        // drop (default), silent or digest
+	Allow        []string        `yaml:"allow"`         // events delivered even while quiet
+	FocusCommand CommandTemplate `yaml:"focus_command"` // quiet while this command exits 0
+}
+
+// dndState is the do-not-disturb flag shared through the status directory
+type dndState struct {
+	Since time.Time  `json:"since"`
+	Until *time.Time `json:"until,omitempty"` // nil until turned off
+}
+
+// getDNDPath returns the do-not-disturb flag file. It has no .json suffix
+// so it is never mistaken for a status file.
+func getDNDPath() string {
+	return filepath.Join(getStatusDir(), "dnd")
+}
+
+// readDND returns the do-not-disturb flag if it is set and has not expired
+func readDND(path string, now time.Time) *dndState {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	var state dndState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil
+	}
+	if state.Until != nil && !now.Before(*state.Until) {
+		return nil
+	}
+	return &state
+}
+
+// quietWindow is a daily time range in minutes after midnight; end may be before start
+type quietWindow struct {
+	text       string
+	start, end int
+}
+
+// parseQuietWindow parses "HH:MM-HH:MM"
+func parseQuietWindow(s string) (quietWindow, error) {
+	from, to, ok := strings.Cut(s, "-")
+	if !ok {
+		return quietWindow{}, fmt.Errorf("quiet hours %q must look like 22:00-07:00", s)
+	}
+	w := quietWindow{text: s}
+	for _, part := range []struct {
+		text string
+		min  *int
+	}{{from, &w.start}, {to, &w.end}} {
+		t, err := time.Parse("15:04", strings.TrimSpace(part.text))
+		if err != nil {
+			return quietWindow{}, fmt.Errorf("quiet hours %q: invalid time %q", s, part.text)
+		}
+		*part.min = t.Hour()*60 + t.Minute()
+	}
+	if w.start == w.end {
+		return quietWindow{}, fmt.Errorf("quiet hours %q: empty window", s)
+	}
+	return w, nil
+}
+
+// contains reports whether t falls in the window
+func (w quietWindow) contains(t time.Time) bool {
+	m := t.Hour()*60 + t.Minute()
+	if w.start < w.end {
+		return m >= w.start && m < w.end
+	}
+	return m >= w.start || m < w.end
+}
+
+// quietGate decides whether notifications are suppressed and keeps the
+// ones held for a digest
+type quietGate struct {
+	dndPath string
+	windows []quietWindow
+	policy  string
+	allow   []string
+	focus   CommandTemplate
+
+	mu           sync.Mutex
+	focusChecked time.Time
+	focusRunning bool
+	focused      bool
+	held         map[*notifySink][]NotifyEvent
+	heldOrder    []*notifySink
+}
+
+// newQuietGate compiles the quiet settings, which may be nil
+func newQuietGate(c *QuietConfig, dndPath string) (*quietGate, error) {
+	g := &quietGate{dndPath: dndPath, policy: QuietDrop, held: make(map[*notifySink][]NotifyEvent)}
+	if c == nil {
+		return g, nil
+	}
+	for _, h := range c.Hours {
+		w, err := parseQuietWindow(h)
+		if err != nil {
+			return nil, err
+		}
+		g.windows = append(g.windows, w)
+	}
+	switch c.Policy {
+	case "":
+	case QuietDrop, QuietSilent, QuietDigest:
+		g.policy = c.Policy
+	default:
+		return nil, fmt.Errorf("unknown quiet policy %q (want %s, %s or %s)", c.Policy, QuietDrop, QuietSilent, QuietDigest)
+	}
+	for _, e := range c.Allow {
+		if !isKnownEvent(e) {
+			return nil, fmt.Errorf("quiet allow: unknown event %q", e)
+		}
+	}
+	g.allow = c.Allow
+	g.focus = c.FocusCommand
+	return g, nil
+}
+
+var (
+	quietOnce  sync.Once
+	quietState *quietGate
+)
+
+// getQuietGate returns the gate for the quiet settings of the config file
+func getQuietGate() *quietGate {
+	quietOnce.Do(func() {
+		var c *QuietConfig
+		if config := loadConfig(); config != nil {
+			c = config.Quiet
+		}
+		g, err := newQuietGate(c, getDNDPath())
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: %v (quiet hours disabled)\n", err)
+			g, _ = newQuietGate(nil, getDNDPath())
+		}
+		quietState = g
+	})
+	return quietState
+}
+
+// Quiet reports whether notifications are suppressed at now, and why
+func (g *quietGate) Quiet(now time.Time) (bool, string) {
+	if g == nil {
+		return false, ""
+	}
+	if state := readDND(g.dndPath, now); state != nil {
+		return true, "do not disturb"
+	}
+	for _, w := range g.windows {
+		if w.contains(now) {
+			return true, "quiet hours " + w.text
+		}
+	}
+	if len(g.focus) > 0 && g.isFocused(now) {
+		return true, "focus"
+	}
+	return false, ""
+}
+
+// isFocused returns the last result of the focus command. When it is older
+// than focusCheckInterval the command is run again in the background, so a
+// slow command never holds up a notification; until the first run finishes
+// the user is taken not to be focused.
+func (g *quietGate) isFocused(now time.Time) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if !g.focusRunning && (g.focusChecked.IsZero() || now.Sub(g.focusChecked) >= focusCheckInterval) {
+		g.focusRunning = true
+		go g.checkFocus()
+	}
+	return g.focused
+}
+
+// checkFocus runs the focus command and records its result
+func (g *quietGate) checkFocus() {
+	ctx, cancel := context.WithTimeout(context.Background(), focusCommandTimeout)
+	defer cancel()
+	focused := exec.CommandContext(ctx, g.focus[0], g.focus[1:]...).Run() == nil
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.focused, g.focusChecked, g.focusRunning = focused, time.Now(), false
+}
+
+// String lists the quiet hours and the focus command
+func (g *quietGate) String() string {
+	var parts []string
+	for _, w := range g.windows {
+		parts = append(parts, w.text)
+	}
+	if len(g.focus) > 0 {
+		parts = append(parts, "focus: "+g.focus.String())
+	}
+	return strings.Join(parts, ", ")
+}
+
+// allows reports whether event is delivered even while quiet
+func (g *quietGate) allows(event string) bool {
+	for _, e := range g.allow {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+// hold keeps an event for the sink's digest
+func (g *quietGate) hold(sink *notifySink, ev NotifyEvent) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if _, ok := g.held[sink]; !ok {
+		g.heldOrder = append(g.heldOrder, sink)
+	}
+	g.held[sink] = append(g.held[sink], ev)
+}
+
+// Flush sends each sink one digest of the events held for it, once it is
+// no longer quiet. It is called periodically by wrappers and daemons.
+func (g *quietGate) Flush(now time.Time, logf logFunc) *sync.WaitGroup {
+	return g.flush(now, logf, false)
+}
+
+// FlushOnExit sends the digests held so far even while still quiet, since
+// they would be lost when the process exits
+func (g *quietGate) FlushOnExit(logf logFunc) *sync.WaitGroup {
+	return g.flush(time.Now(), logf, true)
+}
+
+// flush sends the held digests, unless it is still quiet and force is false
+func (g *quietGate) flush(now time.Time, logf logFunc, force bool) *sync.WaitGroup {
+	var wg sync.WaitGroup
+	if g == nil {
+		return &wg
+	}
+	g.mu.Lock()
+	pending := len(g.heldOrder) > 0
+	g.mu.Unlock()
+	if !pending {
+		return &wg
+	}
+	if quiet, _ := g.Quiet(now); quiet && !force {
+		return &wg
+	}
+
+	g.mu.Lock()
+	held, order := g.held, g.heldOrder
+	g.held, g.heldOrder = make(map[*notifySink][]NotifyEvent), nil
+	g.mu.Unlock()
+
+	for _, sink := range order {
+		digest := digestEvent(held[sink], now)
+		wg.Add(1)
+		go func(sink *notifySink, ev NotifyEvent) {
+			defer wg.Done()
+			if err := sink.notifier.Notify(ev); err != nil {
+				logf("Notifier %s error: %v", sink.name, err)
+			}
+		}(sink, digest)
+	}
+	return &wg
+}
+
+// digestEvent summarizes held events in one notification
+func digestEvent(events []NotifyEvent, now time.Time) NotifyEvent {
+	last := events[len(events)-1]
+	messages := make([]string, len(events))
+	for i, ev := range events {
+		messages[i] = fmt.Sprintf("%s %s", ev.Time.Format("15:04"), ev.Message)
+	}
+	return NotifyEvent{
+		Event:   EventDigest,
+		State:   last.State,
+		PID:     last.PID,
+		Command: last.Command,
+		Message: fmt.Sprintf("通知を控えている間に%d件ありました: %s", len(events), strings.Join(messages, " / ")),
+		Time:    now,
+	}
+}
+
+// parseDNDArgs parses the arguments of kiromon dnd into the flag to write,
+// nil to turn it off, and whether to change it at all
+func parseDNDArgs(args []string, now time.Time) (state *dndState, change bool, err error) {
+	switch {
+	case len(args) == 0 || len(args) == 1 && args[0] == "status":
+		return nil, false, nil
+	case len(args) == 1 && args[0] == "on":
+		return &dndState{Since: now}, true, nil
+	case len(args) == 1 && args[0] == "off":
+		return nil, true, nil
+	case len(args) == 2 && args[0] == "for":
+		d, err := time.ParseDuration(args[1])
+		if err != nil || d <= 0 {
+			return nil, false, fmt.Errorf("invalid duration: %s", args[1])
+		}
+		until := now.Add(d)
+		return &dndState{Since: now, Until: &until}, true, nil
+	}
+	return nil, false, fmt.Errorf("usage: kiromon dnd [on|off|for <duration>|status]")
+}
+
+// runDND handles kiromon dnd and returns the exit code
+func runDND(args []string) int {
+	path := getDNDPath()
+	now := time.Now()
+	state, change, err := parseDNDArgs(args, now)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		printWrapHint("dnd")
+		return 1
+	}
+	if change {
+		if state != nil {
+			err = writeDND(path, *state)
+		} else if err = os.Remove(path); os.IsNotExist(err) {
+			err = nil
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return 1
+		}
+	}
+
+	if state := readDND(path, now); state == nil {
+		fmt.Println("Do not disturb: off")
+	} else if state.Until != nil {
+		fmt.Printf("Do not disturb: on until %s\n", state.Until.Format("15:04:05"))
+	} else {
+		fmt.Printf("Do not disturb: on since %s\n", state.Since.Format("15:04:05"))
+	}
+	gate := getQuietGate()
+	if len(gate.windows) > 0 || len(gate.focus) > 0 {
+		fmt.Printf("Quiet: %s\n", gate)
+	}
+	if quiet, reason := gate.Quiet(now); quiet {
+		fmt.Printf("Notifications are suppressed (%s, policy: %s)\n", reason, gate.policy)
+	}
+	return 0
+}
+
+// writeDND sets the do-not-disturb flag
+func writeDND(path string, state dndState) error {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	return atomicWriteFile(path, data, 0600)
+}
@@ -0,0 +1,184 @@
+package kiromon
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestQuietHours(t *testing.T) {
+	g, err := newQuietGate(&QuietConfig{Hours: []string{"22:00-07:00", "12:00-13:00"}}, filepath.Join(t.TempDir(), "dnd"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	day := time.Date(2024, 5, 1, 0, 0, 0, 0, time.Local)
+	for _, tc := range []struct {
+		at    string
+		quiet bool
+	}{
+		{"21:59", false},
+		{"22:00", true},
+		{"23:30", true},
+		{"03:00", true},
+		{"06:59", true},
+		{"07:00", false},
+		{"12:30", true},
+		{"13:00", false},
+	} {
+		at, _ := time.Parse("15:04", tc.at)
+		now := day.Add(time.Duration(at.Hour())*time.Hour + time.Duration(at.Minute())*time.Minute)
+		if quiet, reason := g.Quiet(now); quiet != tc.quiet {
+			t.Errorf("Quiet(%s) = %v (%s), want %v", tc.at, quiet, reason, tc.quiet)
+		}
+	}
+
+	for _, c := range []QuietConfig{
+		{Hours: []string{"22:00"}},
+		{Hours: []string{"25:00-07:00"}},
+		{Hours: []string{"07:00-07:00"}},
+		{Policy: "later"},
+		{Allow: []string{"nope"}},
+	} {
+		if _, err := newQuietGate(&c, ""); err == nil {
+			t.Errorf("expected error for %+v", c)
+		}
+	}
+}
+
+func TestDND(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dnd")
+	g, _ := newQuietGate(nil, path)
+	now := time.Now()
+	if quiet, _ := g.Quiet(now); quiet {
+		t.Error("quiet without do not disturb")
+	}
+
+	state, change, err := parseDNDArgs([]string{"on"}, now)
+	if err != nil || !change || state == nil || state.Until != nil {
+		t.Fatalf("parseDNDArgs(on) = %+v, %v, %v", state, change, err)
+	}
+	writeDND(path, *state)
+	if quiet, reason := g.Quiet(now.Add(time.Hour)); !quiet || reason != "do not disturb" {
+		t.Errorf("Quiet() after dnd on = %v, %q", quiet, reason)
+	}
+
+	state, _, _ = parseDNDArgs([]string{"for", "30m"}, now)
+	writeDND(path, *state)
+	if quiet, _ := g.Quiet(now.Add(29 * time.Minute)); !quiet {
+		t.Error("not quiet within dnd for 30m")
+	}
+	if quiet, _ := g.Quiet(now.Add(30 * time.Minute)); quiet {
+		t.Error("still quiet after dnd for 30m expired")
+	}
+
+	if state, change, err := parseDNDArgs([]string{"off"}, now); err != nil || !change || state != nil {
+		t.Errorf("parseDNDArgs(off) = %+v, %v, %v", state, change, err)
+	}
+	if _, change, err := parseDNDArgs(nil, now); err != nil || change {
+		t.Errorf("parseDNDArgs() = %v, %v", change, err)
+	}
+	for _, args := range [][]string{{"for"}, {"for", "soon"}, {"for", "-5m"}, {"maybe"}} {
+		if _, _, err := parseDNDArgs(args, now); err == nil {
+			t.Errorf("expected error for %q", args)
+		}
+	}
+}
+
+func TestDispatchQuiet(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dnd")
+	now := time.Now()
+	until := now.Add(time.Hour)
+	writeDND(path, dndState{Since: now, Until: &until})
+	ev := NotifyEvent{Event: EventEnd, Message: "完了", Time: now}
+
+	// drop: nothing is delivered, except allowed events
+	g, _ := newQuietGate(&QuietConfig{Allow: []string{EventStuck}}, path)
+	rec := &recordNotifier{}
+	sinks := []*notifySink{{name: "rec", notifier: rec, events: []string{EventEnd, EventStuck}}}
+	waitNotifications(dispatchQuiet(g, sinks, ev, t.Logf), time.Second)
+	stuck := NotifyEvent{Event: EventStuck, Message: "止まっています", Time: now}
+	waitNotifications(dispatchQuiet(g, sinks, stuck, t.Logf), time.Second)
+	if len(rec.events) != 1 || rec.events[0].Event != EventStuck {
+		t.Errorf("drop: events = %+v", rec.events)
+	}
+
+	// silent: only sinks marked silent hear it
+	g, _ = newQuietGate(&QuietConfig{Policy: QuietSilent}, path)
+	loud, silent := &recordNotifier{}, &recordNotifier{}
+	sinks = []*notifySink{
+		{name: "loud", notifier: loud, events: defaultSinkEvents},
+		{name: "silent", notifier: silent, events: defaultSinkEvents, silent: true},
+	}
+	waitNotifications(dispatchQuiet(g, sinks, ev, t.Logf), time.Second)
+	if len(loud.events) != 0 || len(silent.events) != 1 {
+		t.Errorf("silent: loud = %+v, silent = %+v", loud.events, silent.events)
+	}
+
+	// digest: held until quiet ends, then one summary per sink
+	g, _ = newQuietGate(&QuietConfig{Policy: QuietDigest}, path)
+	rec = &recordNotifier{}
+	sinks = []*notifySink{{name: "rec", notifier: rec, events: defaultSinkEvents, message: "{message}!"}}
+	waitNotifications(dispatchQuiet(g, sinks, ev, t.Logf), time.Second)
+	ev.Event, ev.Message = EventStart, "開始"
+	waitNotifications(dispatchQuiet(g, sinks, ev, t.Logf), time.Second)
+	waitNotifications(g.Flush(now.Add(time.Minute), t.Logf), time.Second)
+	if len(rec.events) != 0 {
+		t.Fatalf("digest sent while quiet: %+v", rec.events)
+	}
+	waitNotifications(g.Flush(until, t.Logf), time.Second)
+	if len(rec.events) != 1 || rec.events[0].Event != EventDigest {
+		t.Fatalf("digest: events = %+v", rec.events)
+	}
+	if msg := rec.events[0].Message; !strings.Contains(msg, "2件") || !strings.Contains(msg, "完了! / ") || !strings.HasSuffix(msg, "開始!") {
+		t.Errorf("digest message = %q", msg)
+	}
+	waitNotifications(g.Flush(until, t.Logf), time.Second)
+	if len(rec.events) != 1 {
+		t.Errorf("digest sent twice: %+v", rec.events)
+	}
+}
+
+func TestQuietFlushOnExit(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dnd")
+	writeDND(path, dndState{Since: time.Now()})
+	g, _ := newQuietGate(&QuietConfig{Policy: QuietDigest}, path)
+	rec := &recordNotifier{}
+	sinks := []*notifySink{{name: "rec", notifier: rec, events: defaultSinkEvents}}
+	waitNotifications(dispatchQuiet(g, sinks, NotifyEvent{Event: EventEnd, Message: "完了", Time: time.Now()}, t.Logf), time.Second)
+
+	// Still quiet, but the process is exiting
+	waitNotifications(g.FlushOnExit(t.Logf), time.Second)
+	if len(rec.events) != 1 || rec.events[0].Event != EventDigest {
+		t.Errorf("events = %+v", rec.events)
+	}
+}
+
+func TestQuietFocus(t *testing.T) {
+	g, _ := newQuietGate(&QuietConfig{FocusCommand: CommandTemplate{"true"}}, filepath.Join(t.TempDir(), "dnd"))
+	// The focus command runs in the background; the first check does not wait for it
+	if quiet, _ := g.Quiet(time.Now()); quiet {
+		t.Error("quiet before the focus command finished")
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		if quiet, reason := g.Quiet(time.Now()); quiet {
+			if reason != "focus" {
+				t.Errorf("reason = %q", reason)
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("focus command result was not used")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// A failing focus command means not focused
+	g, _ = newQuietGate(&QuietConfig{FocusCommand: CommandTemplate{"false"}}, filepath.Join(t.TempDir(), "dnd"))
+	g.Quiet(time.Now())
+	time.Sleep(200 * time.Millisecond)
+	if quiet, _ := g.Quiet(time.Now()); quiet {
+		t.Error("quiet while the focus command fails")
+	}
+}
@@ -0,0 +1,198 @@
+package kiromon
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// RecordOptions holds the session recording settings given with -rec
+type RecordOptions struct {
+	Path  string // asciicast file to write; empty disables recording
+	Input bool   // also record keystrokes (-rec-input)
+}
+
+// recordOptions is set from the command line before the wrapper starts
+var recordOptions RecordOptions
+
+// asciicastHeader is the first line of an asciicast v2 file
+type asciicastHeader struct {
+	Version   int               `json:"version"`
+	Width     int               `json:"width"`
+	Height    int               `json:"height"`
+	Timestamp int64             `json:"timestamp"`
+	Title     string            `json:"title,omitempty"`
+	Env       map[string]string `json:"env,omitempty"`
+}
+
+// Asciicast event codes
+const (
+	castOutput = "o"
+	castInput  = "i"
+	castResize = "r"
+	castMarker = "m"
+)
+
+// asciicastRecorder writes the session as asciicast v2: a JSON header line
+// followed by one [time, code, data] array per event. Events are written
+// as they happen so the file stays playable if kiromon is killed.
+type asciicastRecorder struct {
+	mu     sync.Mutex
+	f      *os.File
+	start  time.Time
+	input  bool
+	cols   int
+	rows   int
+	output []byte // incomplete UTF-8 sequence held until the next chunk
+	keys   []byte
+}
+
+// parseRecordArgs consumes leading -rec <file> and -rec-input options for
+// the bare wrapper and returns the remaining arguments
+func parseRecordArgs(args []string) ([]string, error) {
+	for len(args) > 0 {
+		switch args[0] {
+		case "-rec":
+			if len(args) < 2 {
+				return nil, fmt.Errorf("-rec requires a file path")
+			}
+			recordOptions.Path = args[1]
+			args = args[2:]
+		case "-rec-input":
+			recordOptions.Input = true
+			args = args[1:]
+		case "--":
+			return args[1:], nil
+		default:
+			return args, nil
+		}
+	}
+	return args, nil
+}
+
+// newAsciicastRecorder creates the recording file and writes its header
+func newAsciicastRecorder(path string, cols, rows int, title string, input bool) (*asciicastRecorder, error) {
+	f, err := os.OpenFile(expandHome(path), os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return nil, err
+	}
+	r := &asciicastRecorder{f: f, start: time.Now(), input: input, cols: cols, rows: rows}
+
+	env := make(map[string]string)
+	for _, key := range []string{"SHELL", "TERM"} {
+		if v := os.Getenv(key); v != "" {
+			env[key] = v
+		}
+	}
+	header := asciicastHeader{
+		Version:   2,
+		Width:     cols,
+		Height:    rows,
+		Timestamp: r.start.Unix(),
+		Title:     title,
+		Env:       env,
+	}
+	if err := r.writeLine(header); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return r, nil
+}
+
+// Output records a chunk of PTY output
+func (r *asciicastRecorder) Output(p []byte) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.output = r.writeText(castOutput, r.output, p)
+}
+
+// Input records keystrokes when input recording is enabled
+func (r *asciicastRecorder) Input(p []byte) {
+	if !r.input {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.keys = r.writeText(castInput, r.keys, p)
+}
+
+// Resize records a terminal size change
+func (r *asciicastRecorder) Resize(cols, rows int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if cols <= 0 || rows <= 0 || cols == r.cols && rows == r.rows {
+		return
+	}
+	r.cols, r.rows = cols, rows
+	r.writeEvent(castResize, fmt.Sprintf("%dx%d", cols, rows))
+}
+
+// Marker adds a named marker that players can jump to
+func (r *asciicastRecorder) Marker(label string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.writeEvent(castMarker, label)
+}
+
+// Close flushes any held bytes and closes the file; later events are ignored
+func (r *asciicastRecorder) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.f == nil {
+		return nil
+	}
+	if len(r.output) > 0 {
+		r.writeEvent(castOutput, string(r.output))
+	}
+	err := r.f.Close()
+	r.f = nil
+	return err
+}
+
+// writeText writes held bytes plus p as one event, keeping back a trailing
+// incomplete UTF-8 sequence, and returns the bytes to hold
+func (r *asciicastRecorder) writeText(code string, held, p []byte) []byte {
+	data := append(held, p...)
+	cut := incompleteUTF8(data)
+	if cut > 0 {
+		r.writeEvent(code, string(data[:cut]))
+	}
+	if cut == len(data) {
+		return nil
+	}
+	return append([]byte(nil), data[cut:]...)
+}
+
+// writeEvent appends one event line at the current offset from the start
+func (r *asciicastRecorder) writeEvent(code, data string) {
+	if r.f == nil {
+		return
+	}
+	elapsed := math.Round(time.Since(r.start).Seconds()*1e6) / 1e6
+	r.writeLine([]interface{}{elapsed, code, data})
+}
+
+// writeLine writes v as a single JSON line
+func (r *asciicastRecorder) writeLine(v interface{}) error {
+	enc := json.NewEncoder(r.f)
+	enc.SetEscapeHTML(false)
+	return enc.Encode(v)
+}
+
+// incompleteUTF8 returns the length of p without a trailing, not yet
+// complete UTF-8 sequence
+func incompleteUTF8(p []byte) int {
+	for i := len(p) - 1; i >= 0 && i >= len(p)-utf8.UTFMax; i-- {
+		if utf8.RuneStart(p[i]) {
+			if !utf8.FullRune(p[i:]) {
+				return i
+			}
+			break
+		}
+	}
+	return len(p)
+}
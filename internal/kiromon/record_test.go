@@ -0,0 +1,119 @@
+package kiromon
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestAsciicastRecorder(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "session.cast")
+	r, err := newAsciicastRecorder(path, 80, 24, "kiro-cli chat", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Output([]byte("hi <b>\r\n"))
+	// A character split across reads is written once complete
+	done := []byte("完了")
+	r.Output(done[:4])
+	r.Output(done[4:])
+	r.Input([]byte("ignored"))
+	r.Resize(80, 24) // unchanged
+	r.Resize(0, 0)   // unknown size
+	r.Resize(120, 40)
+	r.Marker("task 1: waiting")
+	r.Output([]byte{0xe5})
+	r.Close()
+	r.Output([]byte("after close"))
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+
+	scanner.Scan()
+	var header asciicastHeader
+	if err := json.Unmarshal(scanner.Bytes(), &header); err != nil {
+		t.Fatal(err)
+	}
+	if header.Version != 2 || header.Width != 80 || header.Height != 24 || header.Title != "kiro-cli chat" || header.Timestamp == 0 {
+		t.Errorf("header = %+v", header)
+	}
+
+	var events [][2]string
+	for scanner.Scan() {
+		var ev []interface{}
+		if err := json.Unmarshal(scanner.Bytes(), &ev); err != nil {
+			t.Fatalf("%s: %v", scanner.Text(), err)
+		}
+		if _, ok := ev[0].(float64); !ok || len(ev) != 3 {
+			t.Fatalf("malformed event %s", scanner.Text())
+		}
+		events = append(events, [2]string{ev[1].(string), ev[2].(string)})
+	}
+	want := [][2]string{
+		{"o", "hi <b>\r\n"},
+		{"o", "完"},
+		{"o", "了"},
+		{"r", "120x40"},
+		{"m", "task 1: waiting"},
+		{"o", "�"},
+	}
+	if !reflect.DeepEqual(events, want) {
+		t.Errorf("events = %q, want %q", events, want)
+	}
+}
+
+func TestAsciicastRecorderInput(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "session.cast")
+	r, err := newAsciicastRecorder(path, 80, 24, "", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Input([]byte("y\r"))
+	r.Close()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ev []interface{}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != 2 || json.Unmarshal([]byte(lines[1]), &ev) != nil || ev[1] != "i" || ev[2] != "y\r" {
+		t.Errorf("recording = %q", data)
+	}
+}
+
+func TestParseRecordArgs(t *testing.T) {
+	recordOptions = RecordOptions{}
+	defer func() { recordOptions = RecordOptions{} }()
+
+	args, err := parseRecordArgs([]string{"-rec", "out.cast", "-rec-input", "--", "kiro-cli", "-rec"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(args, []string{"kiro-cli", "-rec"}) {
+		t.Errorf("args = %q", args)
+	}
+	if recordOptions.Path != "out.cast" || !recordOptions.Input {
+		t.Errorf("recordOptions = %+v", recordOptions)
+	}
+	if _, err := parseRecordArgs([]string{"-rec"}); err == nil {
+		t.Error("expected error for -rec without a path")
+	}
+}
+
+func TestStateMarker(t *testing.T) {
+	if got := stateMarker(StateRunning, 0, "started"); got != "running (started)" {
+		t.Errorf("got %q", got)
+	}
+	if got := stateMarker(StateWaiting, 3, ""); got != "task 3: waiting" {
+		t.Errorf("got %q", got)
+	}
+}
@@ -0,0 +1,116 @@
+package kiromon
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultReminderMax is how many reminders are sent per waiting period unless configured
+const DefaultReminderMax = 3
+
+// ReminderConfig sends reminders while a command keeps waiting for input
+type ReminderConfig struct {
+	Intervals []time.Duration `yaml:"intervals"` // wait before each reminder; the last one repeats
+	Max       int             `yaml:"max"`       // reminders per waiting period (default: 3, negative: unlimited)
+	Message   string          `yaml:"message"`   // message template; {duration} is the time spent waiting
+}
+
+// enabled reports whether c sends reminders
+func (c *ReminderConfig) enabled() bool {
+	return c != nil && len(c.Intervals) > 0
+}
+
+// withDefaults fills the settings not given on the command line from the preset
+func (c ReminderConfig) withDefaults(preset *ReminderConfig) ReminderConfig {
+	if preset == nil {
+		return c
+	}
+	if len(c.Intervals) == 0 {
+		c.Intervals = preset.Intervals
+	}
+	if c.Max == 0 {
+		c.Max = preset.Max
+	}
+	if c.Message == "" {
+		c.Message = preset.Message
+	}
+	return c
+}
+
+// parseReminderIntervals parses a comma-separated list such as "5m,15m,30m"
+func parseReminderIntervals(s string) ([]time.Duration, error) {
+	var intervals []time.Duration
+	for _, part := range strings.Split(s, ",") {
+		d, err := time.ParseDuration(strings.TrimSpace(part))
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("invalid interval: %s", part)
+		}
+		intervals = append(intervals, d)
+	}
+	return intervals, nil
+}
+
+// reminder is one reminder chosen by a waitReminder
+type reminder struct {
+	Count  int           // 1 for the first reminder of the waiting period
+	Waited time.Duration // time spent waiting so far
+}
+
+// String describes the reminder for logs and default messages
+func (r *reminder) String() string {
+	return fmt.Sprintf("%s入力を待っています（%d回目）", formatDuration(r.Waited), r.Count)
+}
+
+// waitReminder decides when to remind about one waiting command
+type waitReminder struct {
+	mu     sync.Mutex
+	config ReminderConfig
+	since  time.Time // start of the waiting period being reminded about
+	sent   int
+	next   time.Time
+}
+
+// newWaitReminder creates a reminder, or returns nil when c sends none.
+// The methods of a nil reminder do nothing.
+func newWaitReminder(c *ReminderConfig) *waitReminder {
+	if !c.enabled() {
+		return nil
+	}
+	config := *c
+	if config.Max == 0 {
+		config.Max = DefaultReminderMax
+	}
+	return &waitReminder{config: config}
+}
+
+// Check is called periodically with the state, when it began and the last
+// input typed into the command. It returns a reminder when one is due.
+// Input during the waiting period cancels its remaining reminders, and any
+// other state starts over.
+func (r *waitReminder) Check(state string, since, lastInput, now time.Time) *reminder {
+	if r == nil {
+		return nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if state != StateWaiting || since.IsZero() {
+		r.since = time.Time{}
+		return nil
+	}
+	if !since.Equal(r.since) {
+		r.since, r.sent, r.next = since, 0, since.Add(r.config.Intervals[0])
+	}
+	if lastInput.After(since) || r.config.Max > 0 && r.sent >= r.config.Max || now.Before(r.next) {
+		return nil
+	}
+
+	r.sent++
+	i := r.sent
+	if i >= len(r.config.Intervals) {
+		i = len(r.config.Intervals) - 1
+	}
+	r.next = now.Add(r.config.Intervals[i])
+	return &reminder{Count: r.sent, Waited: now.Sub(since)}
+}
@@ -0,0 +1,72 @@
+package kiromon
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestWaitReminder(t *testing.T) {
+	r := newWaitReminder(&ReminderConfig{Intervals: []time.Duration{5 * time.Minute, 10 * time.Minute}})
+	since := time.Now()
+	var noInput time.Time
+
+	if d := r.Check(StateWaiting, since, noInput, since.Add(4*time.Minute)); d != nil {
+		t.Errorf("reminder before the first interval: %+v", d)
+	}
+	d := r.Check(StateWaiting, since, noInput, since.Add(5*time.Minute))
+	if d == nil || d.Count != 1 || d.Waited != 5*time.Minute {
+		t.Fatalf("first reminder = %+v", d)
+	}
+	// Intervals escalate and the last one repeats, up to the default maximum
+	if d := r.Check(StateWaiting, since, noInput, since.Add(14*time.Minute)); d != nil {
+		t.Errorf("reminder within the second interval: %+v", d)
+	}
+	if d := r.Check(StateWaiting, since, noInput, since.Add(15*time.Minute)); d == nil || d.Count != 2 {
+		t.Errorf("second reminder = %+v", d)
+	}
+	if d := r.Check(StateWaiting, since, noInput, since.Add(25*time.Minute)); d == nil || d.Count != 3 {
+		t.Errorf("third reminder = %+v", d)
+	}
+	if d := r.Check(StateWaiting, since, noInput, since.Add(time.Hour)); d != nil {
+		t.Errorf("reminder over the maximum: %+v", d)
+	}
+
+	// A new waiting period starts over; typing cancels its reminders
+	since = since.Add(2 * time.Hour)
+	r.Check(StateRunning, since.Add(-time.Minute), noInput, since)
+	if d := r.Check(StateWaiting, since, since.Add(time.Minute), since.Add(5*time.Minute)); d != nil {
+		t.Errorf("reminder after input: %+v", d)
+	}
+	if d := r.Check(StateWaiting, since, noInput, since.Add(5*time.Minute)); d == nil || d.Count != 1 {
+		t.Errorf("reminder of a new waiting period = %+v", d)
+	}
+
+	if newWaitReminder(&ReminderConfig{Max: 2}) != nil {
+		t.Error("reminder without intervals enabled")
+	}
+	var none *waitReminder
+	if none.Check(StateWaiting, since, noInput, since.Add(time.Hour)) != nil {
+		t.Error("nil reminder fired")
+	}
+}
+
+func TestParseReminderIntervals(t *testing.T) {
+	got, err := parseReminderIntervals("5m, 15m,1h")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []time.Duration{5 * time.Minute, 15 * time.Minute, time.Hour}; !reflect.DeepEqual(got, want) {
+		t.Errorf("parseReminderIntervals() = %v, want %v", got, want)
+	}
+	for _, s := range []string{"", "5", "5m,,10m", "-1m"} {
+		if _, err := parseReminderIntervals(s); err == nil {
+			t.Errorf("parseReminderIntervals(%q) accepted", s)
+		}
+	}
+
+	c := ReminderConfig{Max: -1}.withDefaults(&ReminderConfig{Intervals: got, Max: 5, Message: "まだ?"})
+	if !reflect.DeepEqual(c.Intervals, got) || c.Max != -1 || c.Message != "まだ?" {
+		t.Errorf("withDefaults() = %+v", c)
+	}
+}
@@ -1,6 +1,27 @@
 package kiromon
 
-import "os"
+import (
+	"fmt"
+	"os"
+	"os/exec"
+)
+
+// wrapHint returns how to wrap a command that has the name of a kiromon
+// subcommand, or "" when there is no such command on $PATH
+func wrapHint(name string) string {
+	if _, err := exec.LookPath(name); err != nil {
+		return ""
+	}
+	return fmt.Sprintf("Hint: %s is a kiromon subcommand; to wrap the %s command, run: kiromon -- %s ...", name, name, name)
+}
+
+// printWrapHint prints wrapHint after a subcommand rejected its arguments,
+// which is likely when a command of the same name was meant to be wrapped
+func printWrapHint(name string) {
+	if hint := wrapHint(name); hint != "" {
+		fmt.Fprintln(os.Stderr, hint)
+	}
+}
 
 // Run is the main entry point for kiromon
 func Run() int {
@@ -36,17 +57,63 @@ func Run() int {
 		return 1
 	}
 
+	if os.Args[1] == "history" {
+		runHistory(os.Args[2:])
+		return 0
+	}
+
+	if os.Args[1] == "attach" {
+		runAttach(os.Args[2:])
+		return 0
+	}
+
+	if os.Args[1] == "queue" {
+		return runQueue(os.Args[2:])
+	}
+
+	if os.Args[1] == "send" {
+		return runSend(os.Args[2:])
+	}
+
+	if os.Args[1] == "dnd" {
+		return runDND(os.Args[2:])
+	}
+
+	if os.Args[1] == "top" {
+		runTop(os.Args[2:])
+		return 0
+	}
+
 	if os.Args[1] == "-l" {
-		listProcesses()
+		listProcesses(parseMonitorOptions(os.Args[2:]).Format)
 		return 0
 	}
 
-	// Check for standalone mode (-c option before command)
-	if os.Args[1] == "-c" {
+	// Check for standalone mode (-c or -w option before command)
+	if os.Args[1] == "-c" || os.Args[1] == "-w" {
 		runStandalone()
 		return exitCode
 	}
 
+	// Session recording options before the command
+	if os.Args[1] == "-rec" || os.Args[1] == "-rec-input" {
+		args, err := parseRecordArgs(os.Args[1:])
+		if err != nil || len(args) == 0 {
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			}
+			printUsage()
+			return 1
+		}
+		if args[0] == "-c" || args[0] == "-w" {
+			os.Args = append(os.Args[:1], args...)
+			runStandalone()
+			return exitCode
+		}
+		runWrapper(args, nil)
+		return exitCode
+	}
+
 	// Handle "--" as first argument
 	if os.Args[1] == "--" {
 		if len(os.Args) < 3 {
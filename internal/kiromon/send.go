@@ -0,0 +1,139 @@
+package kiromon
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Exit codes of kiromon send
+const (
+	sendExitOK      = 0
+	sendExitError   = 1
+	sendExitSkipped = 3 // --if-waiting and the command was not waiting
+)
+
+// sendKeys maps key names accepted by kiromon send -k to the bytes a
+// terminal would produce
+var sendKeys = map[string]string{
+	"enter":     "\r",
+	"return":    "\r",
+	"tab":       "\t",
+	"esc":       "\x1b",
+	"escape":    "\x1b",
+	"backspace": "\x7f",
+	"space":     " ",
+	"up":        "\x1b[A",
+	"down":      "\x1b[B",
+	"right":     "\x1b[C",
+	"left":      "\x1b[D",
+}
+
+// keyBytes returns the bytes for a key name such as Enter, Esc or Ctrl-C
+func keyBytes(name string) (string, error) {
+	lower := strings.ToLower(name)
+	if b, ok := sendKeys[lower]; ok {
+		return b, nil
+	}
+	for _, prefix := range []string{"ctrl-", "ctrl+", "c-", "^"} {
+		if !strings.HasPrefix(lower, prefix) {
+			continue
+		}
+		rest := lower[len(prefix):]
+		if len(rest) == 1 && rest[0] >= 'a' && rest[0] <= 'z' {
+			return string(rune(rest[0] & 0x1f)), nil
+		}
+		break
+	}
+	return "", fmt.Errorf("unknown key %q", name)
+}
+
+// parseSendArgs parses the arguments after kiromon send. Text arguments
+// are joined with spaces; each -k key becomes a piece of its own so the
+// order of text and keys is kept.
+func parseSendArgs(args []string) (pid int, req attachRequest, err error) {
+	req.Mode = AttachSend
+	var text []string
+	flush := func() {
+		if len(text) > 0 {
+			req.Input = append(req.Input, strings.Join(text, " "))
+			text = nil
+		}
+	}
+
+	literal := false
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if literal || !strings.HasPrefix(arg, "-") || arg == "-" {
+			if pid == 0 {
+				n, err := strconv.Atoi(arg)
+				if err != nil || n <= 0 {
+					return 0, req, fmt.Errorf("invalid PID: %s", arg)
+				}
+				pid = n
+				continue
+			}
+			text = append(text, arg)
+			continue
+		}
+		switch arg {
+		case "--":
+			literal = true
+		case "--if-waiting", "-if-waiting":
+			req.IfState = StateWaiting
+		case "-e", "--enter":
+			flush()
+			req.Input = append(req.Input, sendKeys["enter"])
+		case "-k", "--key":
+			if i+1 >= len(args) {
+				return 0, req, fmt.Errorf("%s requires a key name", arg)
+			}
+			i++
+			key, err := keyBytes(args[i])
+			if err != nil {
+				return 0, req, err
+			}
+			flush()
+			req.Input = append(req.Input, key)
+		default:
+			return 0, req, fmt.Errorf("unknown option: %s", arg)
+		}
+	}
+	flush()
+
+	if pid == 0 {
+		return 0, req, fmt.Errorf("send requires a PID (see kiromon -l)")
+	}
+	if len(req.Input) == 0 {
+		return 0, req, fmt.Errorf("nothing to send")
+	}
+	return pid, req, nil
+}
+
+// runSend handles kiromon send <pid> [options] <text>... and returns the exit code
+func runSend(args []string) int {
+	pid, req, err := parseSendArgs(args)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		printWrapHint("send")
+		return sendExitError
+	}
+
+	filePath, err := findStatusFileByPID(pid)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "No status found for PID %d\n", pid)
+		return sendExitError
+	}
+	conn, _, reply, err := dialAttach(getAttachSocketPath(filePath), req)
+	if err != nil {
+		if reply != nil && req.IfState != "" && reply.State != "" && reply.State != req.IfState {
+			fmt.Fprintf(os.Stderr, "Not sent: PID %d is %s\n", pid, reply.State)
+			return sendExitSkipped
+		}
+		fmt.Fprintf(os.Stderr, "Error: cannot send to PID %d: %v\n", pid, err)
+		return sendExitError
+	}
+	conn.Close()
+	return sendExitOK
+}
@@ -0,0 +1,103 @@
+package kiromon
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestKeyBytes(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"Enter", "\r"},
+		{"esc", "\x1b"},
+		{"Ctrl-C", "\x03"},
+		{"c-d", "\x04"},
+		{"^Z", "\x1a"},
+		{"Up", "\x1b[A"},
+	}
+	for _, tt := range tests {
+		if got, err := keyBytes(tt.name); err != nil || got != tt.want {
+			t.Errorf("keyBytes(%q) = %q, %v, want %q", tt.name, got, err, tt.want)
+		}
+	}
+	for _, name := range []string{"F13", "Ctrl-1", "Ctrl-"} {
+		if _, err := keyBytes(name); err == nil {
+			t.Errorf("keyBytes(%q) accepted", name)
+		}
+	}
+}
+
+func TestParseSendArgs(t *testing.T) {
+	pid, req, err := parseSendArgs([]string{"123", "--if-waiting", "fix", "the", "tests", "-e", "-k", "Ctrl-C", "--", "-x"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pid != 123 || req.Mode != AttachSend || req.IfState != StateWaiting {
+		t.Errorf("pid = %d, req = %+v", pid, req)
+	}
+	if want := []string{"fix the tests", "\r", "\x03", "-x"}; !reflect.DeepEqual(req.Input, want) {
+		t.Errorf("input = %q, want %q", req.Input, want)
+	}
+
+	for _, args := range [][]string{
+		{},
+		{"abc", "hi"},
+		{"123"},
+		{"123", "-k"},
+		{"123", "-k", "Hyper"},
+		{"123", "-z", "hi"},
+	} {
+		if _, _, err := parseSendArgs(args); err == nil {
+			t.Errorf("parseSendArgs(%q) accepted", args)
+		}
+	}
+}
+
+func TestPTYServerSend(t *testing.T) {
+	dir, err := os.MkdirTemp("", "km")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "test-1.pty.sock")
+
+	state := StateRunning
+	var got []string
+	server, err := newPTYServer(path, newVTScreen(4, 20, nil), func(p []byte) error {
+		got = append(got, string(p))
+		return nil
+	}, func() string { return state }, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+
+	// The guard refuses while the command is running and nothing is typed
+	req := attachRequest{Mode: AttachSend, Input: []string{"next", "\r"}, IfState: StateWaiting}
+	_, _, reply, err := dialAttach(path, req)
+	if err == nil || !strings.Contains(err.Error(), "not waiting") || reply == nil || reply.State != StateRunning {
+		t.Errorf("guarded send while running: reply = %+v, err = %v", reply, err)
+	}
+	if len(got) != 0 {
+		t.Errorf("input typed despite guard: %q", got)
+	}
+
+	// Once waiting, the pieces are typed in order before the reply
+	state = StateWaiting
+	conn, _, reply, err := dialAttach(path, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.Close()
+	if !reply.OK || reply.State != StateWaiting {
+		t.Errorf("reply = %+v", reply)
+	}
+	if !reflect.DeepEqual(got, req.Input) {
+		t.Errorf("input = %q, want %q", got, req.Input)
+	}
+}
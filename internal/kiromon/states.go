@@ -0,0 +1,144 @@
+package kiromon
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// DefaultStateLines is how many of the last visible lines a state rule looks at
+const DefaultStateLines = 5
+
+// stateNameRe restricts declared state names so they can be used in transition patterns
+var stateNameRe = regexp.MustCompile(`^[A-Za-z0-9_.-]+$`)
+
+// StateConfig declares a named state recognized from the screen, on top of
+// the running or waiting state chosen by the detector
+type StateConfig struct {
+	Name     string `yaml:"name"`
+	Match    string `yaml:"match"`    // regex on the last lines of the screen
+	When     string `yaml:"when"`     // running or waiting; empty for both
+	Priority int    `yaml:"priority"` // the highest matching priority wins
+	Icon     string `yaml:"icon"`     // shown in listings instead of the base state's icon
+	Lines    int    `yaml:"lines"`    // lines to look at (default: DefaultStateLines)
+}
+
+// stateRule is a compiled StateConfig
+type stateRule struct {
+	name     string
+	match    *regexp.Regexp
+	when     string
+	priority int
+	icon     string
+	lines    int
+}
+
+// stateClassifier picks the declared state that describes the screen
+type stateClassifier struct {
+	rules []*stateRule // by priority, highest first
+}
+
+// newStateClassifier compiles a preset's declared states
+func newStateClassifier(configs []StateConfig) (*stateClassifier, error) {
+	c := &stateClassifier{}
+	seen := make(map[string]bool)
+	for i, sc := range configs {
+		if !stateNameRe.MatchString(sc.Name) {
+			return nil, fmt.Errorf("states[%d]: invalid name %q", i, sc.Name)
+		}
+		switch sc.Name {
+		case StateRunning, StateWaiting, StateStopped:
+			return nil, fmt.Errorf("states[%d]: %s is a built-in state", i, sc.Name)
+		}
+		if seen[sc.Name] {
+			return nil, fmt.Errorf("states[%d]: duplicate state %s", i, sc.Name)
+		}
+		seen[sc.Name] = true
+
+		switch sc.When {
+		case "", StateRunning, StateWaiting:
+		default:
+			return nil, fmt.Errorf("state %s: when must be %s or %s", sc.Name, StateRunning, StateWaiting)
+		}
+		if sc.Match == "" {
+			return nil, fmt.Errorf("state %s: match is required", sc.Name)
+		}
+		re, err := regexp.Compile(sc.Match)
+		if err != nil {
+			return nil, fmt.Errorf("state %s: invalid match: %w", sc.Name, err)
+		}
+		lines := sc.Lines
+		if lines <= 0 {
+			lines = DefaultStateLines
+		}
+		c.rules = append(c.rules, &stateRule{
+			name:     sc.Name,
+			match:    re,
+			when:     sc.When,
+			priority: sc.Priority,
+			icon:     sc.Icon,
+			lines:    lines,
+		})
+	}
+	sort.SliceStable(c.rules, func(i, j int) bool { return c.rules[i].priority > c.rules[j].priority })
+	return c, nil
+}
+
+// Classify returns the declared state and its icon for a running or waiting
+// screen, or empty strings when no rule matches
+func (c *stateClassifier) Classify(state string, screen []string) (name, icon string) {
+	if c == nil || state == StateStopped {
+		return "", ""
+	}
+	for _, rule := range c.rules {
+		if rule.when != "" && rule.when != state {
+			continue
+		}
+		if _, ok := matchLine(rule.match, lastLines(screen, rule.lines)); ok {
+			return rule.name, rule.icon
+		}
+	}
+	return "", ""
+}
+
+// displayState returns the declared state when there is one, else the base state
+func displayState(state, substate string) string {
+	if substate != "" {
+		return substate
+	}
+	return state
+}
+
+// isDeclaredState reports whether name is a state declared in a preset rather than a built-in one
+func isDeclaredState(name string) bool {
+	switch name {
+	case StateRunning, StateWaiting, StateStopped:
+		return false
+	}
+	return name != ""
+}
+
+// validTransition checks a sink's transition pattern such as "running->rate-limited" or "*->waiting"
+func validTransition(pattern string) error {
+	from, to, ok := strings.Cut(pattern, "->")
+	if !ok {
+		return fmt.Errorf("transition %q must look like from->to", pattern)
+	}
+	for _, name := range []string{strings.TrimSpace(from), strings.TrimSpace(to)} {
+		if name != "*" && !stateNameRe.MatchString(name) {
+			return fmt.Errorf("transition %q: invalid state %q", pattern, name)
+		}
+	}
+	return nil
+}
+
+// matchTransition reports whether a from->to pattern, where either side may be *, covers a transition
+func matchTransition(pattern, from, to string) bool {
+	pf, pt, ok := strings.Cut(pattern, "->")
+	if !ok {
+		return false
+	}
+	pf, pt = strings.TrimSpace(pf), strings.TrimSpace(pt)
+	return (pf == "*" || pf == from) && (pt == "*" || pt == to)
+}
@@ -0,0 +1,168 @@
+package kiromon
+
+import (
+	"testing"
+	"time"
+)
+
+func TestStateClassifier(t *testing.T) {
+	c, err := newStateClassifier([]StateConfig{
+		{Name: "thinking", Match: `Thinking\.\.\.`, When: StateRunning, Icon: "💭"},
+		{Name: "errored", Match: `(?i)^error`, Priority: 10, Icon: "❌"},
+		{Name: "rate-limited", Match: `(?i)rate limit`, Priority: 5, Lines: 1},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		state  string
+		screen []string
+		want   string
+		icon   string
+	}{
+		{"running rule", StateRunning, []string{"Thinking..."}, "thinking", "💭"},
+		{"wrong base state", StateWaiting, []string{"Thinking..."}, "", ""},
+		{"priority", StateRunning, []string{"Error: 500", "Thinking..."}, "errored", "❌"},
+		{"lines", StateWaiting, []string{"rate limit exceeded", "> "}, "", ""},
+		{"last line", StateWaiting, []string{"retrying", "rate limit exceeded"}, "rate-limited", ""},
+		{"stopped", StateStopped, []string{"Error: 500"}, "", ""},
+		{"no match", StateWaiting, []string{"> "}, "", ""},
+	}
+	for _, tt := range tests {
+		name, icon := c.Classify(tt.state, tt.screen)
+		if name != tt.want || icon != tt.icon {
+			t.Errorf("%s: Classify() = %q, %q, want %q, %q", tt.name, name, icon, tt.want, tt.icon)
+		}
+	}
+
+	var none *stateClassifier
+	if name, _ := none.Classify(StateRunning, []string{"x"}); name != "" {
+		t.Errorf("nil classifier returned %q", name)
+	}
+}
+
+func TestNewStateClassifierErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		config StateConfig
+	}{
+		{"built-in name", StateConfig{Name: StateWaiting, Match: "x"}},
+		{"invalid name", StateConfig{Name: "rate limited", Match: "x"}},
+		{"no match", StateConfig{Name: "a"}},
+		{"bad match", StateConfig{Name: "a", Match: "("}},
+		{"bad when", StateConfig{Name: "a", Match: "x", When: StateStopped}},
+	}
+	for _, tt := range tests {
+		if _, err := newStateClassifier([]StateConfig{tt.config}); err == nil {
+			t.Errorf("%s: expected an error", tt.name)
+		}
+	}
+	if _, err := newStateClassifier([]StateConfig{{Name: "a", Match: "x"}, {Name: "a", Match: "y"}}); err == nil {
+		t.Error("duplicate state accepted")
+	}
+}
+
+func TestTransitionSinks(t *testing.T) {
+	for _, pattern := range []string{"running", "a->b c", "->waiting"} {
+		if validTransition(pattern) == nil {
+			t.Errorf("validTransition(%q) accepted", pattern)
+		}
+	}
+
+	sink, err := newSink(&SinkConfig{Type: SinkBell, Transitions: []string{"*->rate-limited", "errored->waiting"}}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Transitions alone do not subscribe to start and end
+	if sink.accepts(EventStart) || sink.accepts(EventEnd) {
+		t.Errorf("events = %v, want none", sink.events)
+	}
+
+	tests := []struct {
+		from, to string
+		want     bool
+	}{
+		{"running", "rate-limited", true},
+		{"errored", "waiting", true},
+		{"errored", "running", false},
+		{"running", "waiting", false},
+	}
+	for _, tt := range tests {
+		if got := sink.acceptsTransition(tt.from, tt.to); got != tt.want {
+			t.Errorf("acceptsTransition(%s, %s) = %v", tt.from, tt.to, got)
+		}
+	}
+
+	rec := &recordNotifier{}
+	all := &recordNotifier{}
+	sinks := []*notifySink{
+		{name: "rec", notifier: rec, transitions: []string{"*->errored"}},
+		{name: "all", notifier: all, events: []string{EventTransition}},
+	}
+	logf := func(format string, args ...interface{}) { t.Errorf(format, args...) }
+	for _, to := range []string{"errored", "waiting"} {
+		ev := NotifyEvent{Event: EventTransition, PrevState: StateRunning, State: to, Message: "changed"}
+		waitNotifications(dispatchNotification(sinks, ev, logf), time.Second)
+	}
+	if len(rec.events) != 1 || rec.events[0].State != "errored" {
+		t.Errorf("pattern sink got %+v", rec.events)
+	}
+	if len(all.events) != 2 {
+		t.Errorf("transition sink got %d events, want 2", len(all.events))
+	}
+}
+
+func TestCheckAndNotifyTransition(t *testing.T) {
+	rec := &recordNotifier{}
+	sinks := []*notifySink{{name: "rec", notifier: rec, transitions: []string{"running->rate-limited"}}}
+	lastStates := make(map[int]string)
+	lastShown := make(map[int]string)
+	taskStarts := make(map[int]time.Time)
+
+	status := &Status{PID: 7, State: StateRunning, Command: "kiro-cli"}
+	checkAndNotify(status, nil, lastStates, lastShown, taskStarts, sinks, "", "", "")
+	status.Substate = "rate-limited"
+	checkAndNotify(status, nil, lastStates, lastShown, taskStarts, sinks, "", "", "")
+	// Notifications are delivered in the background
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		rec.mu.Lock()
+		events := append([]NotifyEvent(nil), rec.events...)
+		rec.mu.Unlock()
+		if len(events) > 0 {
+			if ev := events[0]; len(events) != 1 || ev.Event != EventTransition || ev.PrevState != StateRunning || ev.State != "rate-limited" {
+				t.Errorf("events = %+v", events)
+			}
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("transition was not notified")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestNotifyTerminatedTransition(t *testing.T) {
+	rec := &recordNotifier{}
+	sinks := []*notifySink{{name: "rec", notifier: rec, transitions: []string{"rate-limited->stopped"}}}
+	notifyTerminated(&Status{PID: 7, State: StateStopped, Command: "kiro-cli"}, "rate-limited", sinks, "")
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		rec.mu.Lock()
+		events := append([]NotifyEvent(nil), rec.events...)
+		rec.mu.Unlock()
+		if len(events) > 0 {
+			if ev := events[0]; len(events) != 1 || ev.Event != EventTransition || ev.PrevState != "rate-limited" || ev.State != StateStopped {
+				t.Errorf("events = %+v", events)
+			}
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("transition to stopped was not notified")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
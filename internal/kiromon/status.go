@@ -6,22 +6,58 @@ import (
 	"io"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"syscall"
 	"time"
 )
 
+// StatusSchemaVersion is the version of the status file format written by
+// this build. Files without a schema_version are the original format (1),
+// which lacks the fields added in version 2.
+const StatusSchemaVersion = 2
+
 // Status represents the current state of a monitored process
 type Status struct {
-	State         string    `json:"state"`
-	Command       string    `json:"command"`
-	PID           int       `json:"pid"`
-	StartTime     time.Time `json:"start_time"`
-	UpdatedAt     time.Time `json:"updated_at"`
-	LastLines     []string  `json:"last_lines"`
-	LastLine      string    `json:"last_line"`
-	IdleDetected  bool      `json:"idle_detected"`
-	IdleSeconds   float64   `json:"idle_seconds"`
+	SchemaVersion  int        `json:"schema_version"`
+	State          string     `json:"state"`
+	Command        string     `json:"command"`
+	PID            int        `json:"pid"`
+	StartTime      time.Time  `json:"start_time"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+	LastLines      []string   `json:"last_lines"`
+	LastLine       string     `json:"last_line"`
+	IdleDetected   bool       `json:"idle_detected"`
+	IdleSeconds    float64    `json:"idle_seconds"`
+	Cwd            string     `json:"cwd,omitempty"`
+	Hostname       string     `json:"hostname,omitempty"`
+	TTY            string     `json:"tty,omitempty"`
+	KiromonVersion string     `json:"kiromon_version,omitempty"`
+	ExitCode       *int       `json:"exit_code,omitempty"` // set once the command has stopped
+	Signal         string     `json:"signal,omitempty"`    // signal that killed the command, if any
+	EndTime        *time.Time `json:"end_time,omitempty"`  // when the command stopped
+	TaskCount      int        `json:"task_count"`          // tasks started (transitions into running)
+	TaskStartTime  time.Time  `json:"task_start_time"`     // start of the current or last task
+	StateChangedAt time.Time  `json:"state_changed_at"`
+	Reason         string     `json:"reason,omitempty"`         // why the detector chose the state
+	Transcript     string     `json:"transcript,omitempty"`     // output of the current or last task, when enabled
+	QueueLength    int        `json:"queue_length,omitempty"`   // prompts waiting in kiromon queue
+	QueuePaused    string     `json:"queue_paused,omitempty"`   // output line that paused the queue
+	WaitingFor     string     `json:"waiting_for,omitempty"`    // while waiting: "approval" or "task"
+	AutoResponses  int        `json:"auto_responses,omitempty"` // keystrokes typed by auto-respond rules
+	Substate       string     `json:"substate,omitempty"`       // declared state matching the screen, if any
+	StateIcon      string     `json:"state_icon,omitempty"`     // icon of the declared state
+	TaskFailed     bool       `json:"task_failed,omitempty"`    // the last task printed a line matching an error pattern
+	ErrorLine      string     `json:"error_line,omitempty"`     // that line
+	Stuck          string     `json:"stuck,omitempty"`          // while running: why the watchdog raised an alert
+	LastInputAt    *time.Time `json:"last_input_at,omitempty"`  // last keystroke typed into the command
+}
+
+// watchEvent is a change to a file in the status directory.
+// An empty Name means events were lost and the directory should be rescanned.
+type watchEvent struct {
+	Name    string
+	Removed bool
 }
 
 // getStatusDir returns the directory for status files
@@ -40,7 +76,8 @@ func getStatusDir() string {
 	return dir
 }
 
-// cleanupStaleFiles removes status files older than 24 hours or with dead processes
+// cleanupStaleFiles removes status files older than 24 hours, stopped
+// tombstones past their retention, and files of dead processes
 func cleanupStaleFiles() {
 	dir := getStatusDir()
 	entries, err := os.ReadDir(dir)
@@ -50,6 +87,14 @@ func cleanupStaleFiles() {
 
 	now := time.Now()
 	for _, entry := range entries {
+		// Remove event and attach sockets of dead processes
+		if strings.HasSuffix(entry.Name(), ".sock") {
+			base := strings.TrimSuffix(strings.TrimSuffix(entry.Name(), ".sock"), ".pty")
+			if pid := pidFromStatusFile(base + ".json"); pid > 0 && syscall.Kill(pid, 0) == syscall.ESRCH {
+				os.Remove(filepath.Join(dir, entry.Name()))
+			}
+			continue
+		}
 		if !strings.HasSuffix(entry.Name(), ".json") {
 			continue
 		}
@@ -78,6 +123,14 @@ func cleanupStaleFiles() {
 			continue
 		}
 
+		// Keep the stopped state around for the retention period
+		if status.State == StateStopped {
+			if status.expired(now, tombstoneRetention()) {
+				os.Remove(filePath)
+			}
+			continue
+		}
+
 		// Check if process is still running
 		if err := syscall.Kill(status.PID, 0); err != nil {
 			os.Remove(filePath)
@@ -85,11 +138,34 @@ func cleanupStaleFiles() {
 	}
 }
 
+// expired reports whether a stopped status is older than the retention period
+func (s *Status) expired(now time.Time, retention time.Duration) bool {
+	ended := s.UpdatedAt
+	if s.EndTime != nil {
+		ended = *s.EndTime
+	}
+	return now.Sub(ended) > retention
+}
+
 // getStatusFileWithPID returns status file path with PID for unique identification
 func getStatusFileWithPID(name string, pid int) string {
 	return filepath.Join(getStatusDir(), fmt.Sprintf("%s-%d.json", name, pid))
 }
 
+// pidFromStatusFile extracts the PID from a "<name>-<pid>.json" file name, or returns 0
+func pidFromStatusFile(fileName string) int {
+	name := strings.TrimSuffix(fileName, ".json")
+	idx := strings.LastIndex(name, "-")
+	if idx <= 0 || name == fileName {
+		return 0
+	}
+	pid, err := strconv.Atoi(name[idx+1:])
+	if err != nil || pid <= 0 {
+		return 0
+	}
+	return pid
+}
+
 // findStatusFileByPID searches for a status file by PID
 func findStatusFileByPID(pid int) (string, error) {
 	dir := getStatusDir()
@@ -128,11 +204,26 @@ func readStatusWithLock(filename string) (*Status, error) {
 		return nil, err
 	}
 
+	return decodeStatus(data)
+}
+
+// decodeStatus parses a status file of any schema version. Fields that older
+// writers did not record are filled in from what they did record.
+func decodeStatus(data []byte) (*Status, error) {
 	var status Status
 	if err := json.Unmarshal(data, &status); err != nil {
 		return nil, err
 	}
 
+	if status.SchemaVersion == 0 {
+		status.SchemaVersion = 1
+	}
+	if status.TaskStartTime.IsZero() {
+		status.TaskStartTime = status.StartTime
+	}
+	if status.StateChangedAt.IsZero() {
+		status.StateChangedAt = status.StartTime
+	}
 	return &status, nil
 }
 
@@ -183,3 +274,14 @@ func atomicWriteFile(filename string, data []byte, perm os.FileMode) error {
 	tmpName = "" // Prevent cleanup since rename succeeded
 	return nil
 }
+
+// exitDescription describes how a stopped process ended, e.g. "exit 1" or "SIGKILL"
+func exitDescription(s *Status) string {
+	if s.Signal != "" {
+		return s.Signal
+	}
+	if s.ExitCode != nil {
+		return fmt.Sprintf("exit %d", *s.ExitCode)
+	}
+	return "unknown"
+}
@@ -2,6 +2,7 @@ package kiromon
 
 import (
 	"encoding/json"
+	"fmt"
 	"os"
 	"path/filepath"
 	"testing"
@@ -143,3 +144,166 @@ func TestStatusRoundTrip(t *testing.T) {
 		t.Errorf("Command = %q, want %q", status.Command, original.Command)
 	}
 }
+
+func TestPidFromStatusFile(t *testing.T) {
+	tests := []struct {
+		name string
+		want int
+	}{
+		{"kiro-cli-12345.json", 12345},
+		{"my-tool-7.json", 7},
+		{"vim.json", 0},
+		{"kiro-cli-abc.json", 0},
+		{"kiro-cli-12345.sock", 0},
+		{"-12.json", 0},
+	}
+	for _, tt := range tests {
+		if got := pidFromStatusFile(tt.name); got != tt.want {
+			t.Errorf("pidFromStatusFile(%q) = %d, want %d", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestDecodeStatusLegacy(t *testing.T) {
+	// Written before schema_version existed
+	data := []byte(`{"state":"running","command":"kiro-cli","pid":1,"start_time":"2024-01-01T12:00:00Z"}`)
+	status, err := decodeStatus(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.SchemaVersion != 1 {
+		t.Errorf("SchemaVersion = %d, want 1", status.SchemaVersion)
+	}
+	if !status.TaskStartTime.Equal(status.StartTime) || !status.StateChangedAt.Equal(status.StartTime) {
+		t.Errorf("TaskStartTime = %v, StateChangedAt = %v, want start time", status.TaskStartTime, status.StateChangedAt)
+	}
+	if status.ExitCode != nil {
+		t.Errorf("ExitCode = %d, want nil", *status.ExitCode)
+	}
+}
+
+func TestDecodeStatusCurrent(t *testing.T) {
+	code := 2
+	original := Status{
+		SchemaVersion:  StatusSchemaVersion,
+		State:          StateStopped,
+		PID:            5,
+		Cwd:            "/work",
+		Hostname:       "host",
+		KiromonVersion: "v1.0.0",
+		ExitCode:       &code,
+		TaskCount:      3,
+		TaskStartTime:  time.Now().Truncate(time.Second),
+		StateChangedAt: time.Now().Truncate(time.Second),
+		Reason:         "exited",
+	}
+	data, _ := json.Marshal(original)
+	status, err := decodeStatus(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.SchemaVersion != StatusSchemaVersion || status.Cwd != "/work" || status.TaskCount != 3 || status.Reason != "exited" {
+		t.Errorf("decodeStatus() = %+v", status)
+	}
+	if status.ExitCode == nil || *status.ExitCode != 2 {
+		t.Errorf("ExitCode = %v, want 2", status.ExitCode)
+	}
+	if !status.TaskStartTime.Equal(original.TaskStartTime) {
+		t.Errorf("TaskStartTime = %v, want %v", status.TaskStartTime, original.TaskStartTime)
+	}
+}
+
+func TestCleanupStaleFilesTombstones(t *testing.T) {
+	t.Setenv("XDG_RUNTIME_DIR", t.TempDir())
+	globalConfig = &FileConfig{}
+	defer func() { globalConfig = nil }()
+	dir := getStatusDir()
+
+	// PIDs this large are never in use
+	const deadPID = 0x7ffffff0
+	write := func(name string, status Status) string {
+		t.Helper()
+		path := filepath.Join(dir, name)
+		data, _ := json.Marshal(status)
+		if err := os.WriteFile(path, data, 0600); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	code := 1
+	recent := time.Now().Add(-time.Minute)
+	old := time.Now().Add(-DefaultTombstoneRetention - time.Minute)
+
+	kept := write("tool-1.json", Status{State: StateStopped, PID: deadPID, ExitCode: &code, EndTime: &recent})
+	expired := write("tool-2.json", Status{State: StateStopped, PID: deadPID, ExitCode: &code, EndTime: &old})
+	dead := write("tool-3.json", Status{State: StateRunning, PID: deadPID})
+
+	cleanupStaleFiles()
+
+	if _, err := os.Stat(kept); err != nil {
+		t.Error("recent tombstone removed")
+	}
+	if _, err := os.Stat(expired); !os.IsNotExist(err) {
+		t.Error("expired tombstone kept")
+	}
+	if _, err := os.Stat(dead); !os.IsNotExist(err) {
+		t.Error("running status of a dead process kept")
+	}
+
+	// A configured retention of zero drops tombstones at once
+	zero := time.Duration(0)
+	globalConfig.TombstoneRetention = &zero
+	cleanupStaleFiles()
+	if _, err := os.Stat(kept); !os.IsNotExist(err) {
+		t.Error("tombstone kept with zero retention")
+	}
+}
+
+func TestCleanupStaleSockets(t *testing.T) {
+	t.Setenv("XDG_RUNTIME_DIR", t.TempDir())
+	dir := getStatusDir()
+
+	// Sockets are judged by the PID in their name, without connecting
+	const deadPID = 0x7ffffff0
+	paths := map[string]bool{
+		fmt.Sprintf("tool-%d.sock", deadPID):         false,
+		fmt.Sprintf("tool-%d.pty.sock", deadPID):     false,
+		fmt.Sprintf("tool-%d.sock", os.Getpid()):     true,
+		fmt.Sprintf("tool-%d.pty.sock", os.Getpid()): true,
+	}
+	for name := range paths {
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cleanupStaleFiles()
+
+	for name, keep := range paths {
+		_, err := os.Stat(filepath.Join(dir, name))
+		if keep && err != nil {
+			t.Errorf("%s of a live process removed", name)
+		}
+		if !keep && !os.IsNotExist(err) {
+			t.Errorf("%s of a dead process kept", name)
+		}
+	}
+}
+
+func TestExitDescription(t *testing.T) {
+	code := 2
+	killed := 137
+	tests := []struct {
+		status Status
+		want   string
+	}{
+		{Status{ExitCode: &code}, "exit 2"},
+		{Status{ExitCode: &killed, Signal: "SIGKILL"}, "SIGKILL"},
+		{Status{}, "unknown"},
+	}
+	for _, tt := range tests {
+		if got := exitDescription(&tt.status); got != tt.want {
+			t.Errorf("exitDescription(%+v) = %q, want %q", tt.status, got, tt.want)
+		}
+	}
+}
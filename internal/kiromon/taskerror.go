@@ -0,0 +1,121 @@
+package kiromon
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// DefaultErrorPatterns recognize error output such as "Error: ...",
+// "ValueError: ...", "error[E0308]: ...", Python tracebacks and API errors
+var DefaultErrorPatterns = []string{
+	`^(\w+\.)*\w*(Error|Exception):`,
+	`^(?i:error)(\[\w+\])?:`,
+	`^Traceback \(most recent call last\)`,
+	`(?i)\bapi error\b`,
+}
+
+// maxErrorLineLength bounds an unterminated line kept by the error scanner
+const maxErrorLineLength = 4096
+
+// errorScanner looks for error lines in the output of the current task
+type errorScanner struct {
+	mu    sync.Mutex
+	strip ansiStripper // writes to lines
+	lines *errorLines
+}
+
+// errorLines splits stripped output into lines and remembers the last error line
+type errorLines struct {
+	patterns []*regexp.Regexp
+	partial  []byte
+	cr       bool   // a carriage return moved back to the start of the line
+	found    string // last error line of the current task
+}
+
+// newErrorScanner compiles error patterns. Nil patterns use
+// DefaultErrorPatterns; an empty list disables error detection.
+func newErrorScanner(patterns []string) (*errorScanner, error) {
+	if patterns == nil {
+		patterns = DefaultErrorPatterns
+	}
+	lines := &errorLines{}
+	for _, p := range patterns {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return nil, fmt.Errorf("invalid error pattern %q: %w", p, err)
+		}
+		lines.patterns = append(lines.patterns, re)
+	}
+	return &errorScanner{strip: ansiStripper{w: lines}, lines: lines}, nil
+}
+
+// Write scans a chunk of PTY output
+func (s *errorScanner) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := len(p)
+	if len(s.lines.patterns) == 0 {
+		return n, nil
+	}
+	// The stripper drops carriage returns, so text redrawn over a line is
+	// split off here and the line restarts with it
+	for len(p) > 0 {
+		i := bytes.IndexByte(p, '\r')
+		if i < 0 {
+			s.strip.Write(p)
+			break
+		}
+		s.strip.Write(p[:i])
+		s.lines.cr = true
+		p = p[i+1:]
+	}
+	return n, nil
+}
+
+// EndTask returns the last error line of the task that just ended, counting
+// an unterminated last line, and starts over for the next task
+func (s *errorScanner) EndTask() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lines.check()
+	found := s.lines.found
+	s.lines.found = ""
+	return found
+}
+
+// Write collects complete lines and checks each one
+func (l *errorLines) Write(p []byte) (int, error) {
+	for _, b := range p {
+		if b == '\n' {
+			l.check()
+			continue
+		}
+		if l.cr {
+			l.partial = l.partial[:0]
+			l.cr = false
+		}
+		if len(l.partial) < maxErrorLineLength {
+			l.partial = append(l.partial, b)
+		}
+	}
+	return len(p), nil
+}
+
+// check matches the pending line against the patterns and clears it
+func (l *errorLines) check() {
+	line := strings.TrimSpace(string(l.partial))
+	l.partial = l.partial[:0]
+	l.cr = false
+	if line == "" {
+		return
+	}
+	for _, re := range l.patterns {
+		if re.MatchString(line) {
+			l.found = line
+			return
+		}
+	}
+}
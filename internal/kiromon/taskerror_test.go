@@ -0,0 +1,91 @@
+package kiromon
+
+import (
+	"testing"
+	"time"
+)
+
+func TestErrorScanner(t *testing.T) {
+	s, err := newErrorScanner(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Escape sequences are stripped and a line redrawn after \r starts over
+	s.Write([]byte("> fix it\r\n\x1b[31mError: first\x1b[0m\r\nthinking...\rValueError: bad \x1b[1mvalue"))
+	s.Write([]byte("\r\nTraceback? no\r\n> "))
+	if got := s.EndTask(); got != "ValueError: bad value" {
+		t.Errorf("EndTask() = %q", got)
+	}
+	// The next task starts clean
+	s.Write([]byte("all good\r\n> "))
+	if got := s.EndTask(); got != "" {
+		t.Errorf("EndTask() after a clean task = %q", got)
+	}
+	// An unterminated last line counts
+	s.Write([]byte("API Error: 529 overloaded"))
+	if got := s.EndTask(); got != "API Error: 529 overloaded" {
+		t.Errorf("EndTask() = %q", got)
+	}
+
+	disabled, _ := newErrorScanner([]string{})
+	disabled.Write([]byte("Error: ignored\n"))
+	if got := disabled.EndTask(); got != "" {
+		t.Errorf("disabled scanner found %q", got)
+	}
+
+	if _, err := newErrorScanner([]string{"("}); err == nil {
+		t.Error("expected error for an invalid pattern")
+	}
+}
+
+func TestDispatchFailed(t *testing.T) {
+	failed, end := &recordNotifier{}, &recordNotifier{}
+	sinks := []*notifySink{
+		{name: "failed", notifier: failed, events: failedSinkEvents(defaultSinkEvents, "失敗")},
+		{name: "end", notifier: end, events: defaultSinkEvents},
+	}
+	ev := NotifyEvent{Event: EventFailed, Message: "失敗: {error_line}", ErrorLine: "Error: boom"}
+	waitNotifications(dispatchNotification(sinks, ev, t.Logf), time.Second)
+
+	if len(failed.events) != 1 || failed.events[0].Event != EventFailed {
+		t.Errorf("failed sink got %+v", failed.events)
+	}
+	// Sinks without failed still hear that the task ended
+	if len(end.events) != 1 || end.events[0].Event != EventEnd || end.events[0].ErrorLine != "Error: boom" {
+		t.Errorf("end sink got %+v", end.events)
+	}
+	if got := ev.expand(ev.Message); got != "失敗: Error: boom" {
+		t.Errorf("expand() = %q", got)
+	}
+}
+
+func TestCheckAndNotifyFailed(t *testing.T) {
+	rec := &recordNotifier{}
+	sinks := []*notifySink{{name: "rec", notifier: rec, events: []string{EventFailed}}}
+	lastStates := make(map[int]string)
+	lastShown := make(map[int]string)
+	taskStarts := make(map[int]time.Time)
+
+	status := &Status{PID: 7, State: StateRunning, Command: "kiro-cli"}
+	checkAndNotify(status, nil, lastStates, lastShown, taskStarts, sinks, "", "完了", "失敗: {error_line}")
+	status.State, status.TaskFailed, status.ErrorLine = StateWaiting, true, "Error: boom"
+	checkAndNotify(status, nil, lastStates, lastShown, taskStarts, sinks, "", "完了", "失敗: {error_line}")
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		rec.mu.Lock()
+		events := append([]NotifyEvent(nil), rec.events...)
+		rec.mu.Unlock()
+		if len(events) > 0 {
+			if ev := events[0]; len(events) != 1 || ev.Message != "失敗: Error: boom" || ev.ErrorLine != "Error: boom" {
+				t.Errorf("events = %+v", events)
+			}
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("failed task was not notified")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,489 @@
+package kiromon
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"golang.org/x/term"
+)
+
+// Sort orders for kiromon top
+const (
+	TopSortState = "state" // waiting first, then running, then stopped
+	TopSortName  = "name"
+	TopSortIdle  = "idle"
+	TopSortTask  = "task" // longest current task first
+	TopSortPID   = "pid"
+)
+
+// topSortKeys is the order the s key cycles through
+var topSortKeys = []string{TopSortState, TopSortName, TopSortIdle, TopSortTask, TopSortPID}
+
+// DefaultTopInterval is how often kiromon top redraws without file changes
+const DefaultTopInterval = time.Second
+
+// Terminal control sequences used by the dashboard
+const (
+	ansiAltScreenOn  = "\x1b[?1049h\x1b[?25l"
+	ansiAltScreenOff = "\x1b[?25h\x1b[?1049l"
+	ansiHome         = "\x1b[H"
+	ansiClearLine    = "\x1b[K"
+	ansiClearBelow   = "\x1b[J"
+	ansiReverse      = "\x1b[7m"
+	ansiBold         = "\x1b[1m"
+	ansiReset        = "\x1b[0m"
+	ansiDefaultFg    = "\x1b[39m"
+)
+
+// topView is the interactive state of the dashboard
+type topView struct {
+	sortKey     string
+	reverse     bool
+	filter      string
+	selectedPID int
+	detail      bool
+	editing     bool   // typing a filter after /
+	input       string // filter being typed
+}
+
+// runTop runs the live dashboard of all monitored processes
+func runTop(args []string) {
+	view := &topView{sortKey: TopSortState, detail: true}
+	interval := DefaultTopInterval
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "-sort":
+			if i+1 >= len(args) || !validTopSort(args[i+1]) {
+				fmt.Fprintf(os.Stderr, "Error: -sort requires one of %s\n", strings.Join(topSortKeys, ", "))
+				os.Exit(1)
+			}
+			i++
+			view.sortKey = args[i]
+		case "-f":
+			if i+1 >= len(args) {
+				fmt.Fprintln(os.Stderr, "Error: -f requires a filter text")
+				os.Exit(1)
+			}
+			i++
+			view.filter = args[i]
+		case "-i":
+			if i+1 >= len(args) {
+				fmt.Fprintln(os.Stderr, "Error: -i requires seconds")
+				os.Exit(1)
+			}
+			i++
+			sec, err := strconv.ParseFloat(args[i], 64)
+			if err != nil || sec <= 0 {
+				fmt.Fprintf(os.Stderr, "Invalid interval: %s\n", args[i])
+				os.Exit(1)
+			}
+			interval = time.Duration(sec * float64(time.Second))
+		default:
+			fmt.Fprintf(os.Stderr, "Unknown option: %s\n", args[i])
+			printWrapHint("top")
+			os.Exit(1)
+		}
+	}
+
+	inFd, outFd := int(os.Stdin.Fd()), int(os.Stdout.Fd())
+	if !term.IsTerminal(inFd) || !term.IsTerminal(outFd) {
+		fmt.Fprintln(os.Stderr, "Error: kiromon top requires a terminal (use kiromon -l for a snapshot)")
+		os.Exit(1)
+	}
+	oldState, err := term.MakeRaw(inFd)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	defer term.Restore(inFd, oldState)
+	fmt.Print(ansiAltScreenOn)
+	defer fmt.Print(ansiAltScreenOff)
+
+	// Redraw as soon as a status file changes; the ticker keeps durations current
+	var watchEvents chan watchEvent
+	if watcher, err := newDirWatcher(getStatusDir()); err == nil {
+		defer watcher.Close()
+		watchEvents = watcher.Events
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, syscall.SIGWINCH, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
+	defer signal.Stop(sigCh)
+
+	keys := make(chan []byte)
+	go func() {
+		buf := make([]byte, 64)
+		for {
+			n, err := os.Stdin.Read(buf)
+			if err != nil {
+				close(keys)
+				return
+			}
+			keys <- append([]byte(nil), buf[:n]...)
+		}
+	}()
+
+	procs := readMonitoredProcesses()
+	for {
+		width, height, err := term.GetSize(outFd)
+		if err != nil {
+			width, height = DefaultCols, DefaultRows
+		}
+		os.Stdout.WriteString(ansiHome + strings.Join(view.render(procs, width, height, time.Now()), ansiClearLine+"\r\n") + ansiClearLine + ansiClearBelow)
+
+		select {
+		case key, ok := <-keys:
+			if !ok || view.handleKey(key, view.visible(procs, time.Now())) {
+				return
+			}
+		case _, ok := <-watchEvents:
+			if !ok {
+				watchEvents = nil
+			}
+			procs = readMonitoredProcesses()
+		case <-ticker.C:
+			procs = readMonitoredProcesses()
+		case sig := <-sigCh:
+			if sig != syscall.SIGWINCH {
+				return
+			}
+		}
+	}
+}
+
+// validTopSort reports whether key is a known sort order
+func validTopSort(key string) bool {
+	for _, k := range topSortKeys {
+		if k == key {
+			return true
+		}
+	}
+	return false
+}
+
+// visible returns the processes matching the filter in display order
+func (v *topView) visible(procs []monitoredProcess, now time.Time) []monitoredProcess {
+	var shown []monitoredProcess
+	filter := strings.ToLower(v.filter)
+	for _, p := range procs {
+		if filter == "" || strings.Contains(strings.ToLower(topSearchText(p)), filter) {
+			shown = append(shown, p)
+		}
+	}
+	sortProcesses(shown, v.sortKey, now)
+	if v.reverse {
+		for i, j := 0, len(shown)-1; i < j; i, j = i+1, j-1 {
+			shown[i], shown[j] = shown[j], shown[i]
+		}
+	}
+	return shown
+}
+
+// topSearchText is the text the filter is matched against
+func topSearchText(p monitoredProcess) string {
+	s := p.Status
+	return strings.Join([]string{p.Name, strconv.Itoa(s.PID), s.State, s.Command, s.Cwd, s.Hostname, s.LastLine}, "\n")
+}
+
+// sortProcesses orders processes by key, breaking ties by name and PID
+func sortProcesses(procs []monitoredProcess, key string, now time.Time) {
+	stateRank := map[string]int{StateWaiting: 0, StateRunning: 1, StateStopped: 2}
+	sort.SliceStable(procs, func(i, j int) bool {
+		a, b := procs[i].Status, procs[j].Status
+		switch key {
+		case TopSortState:
+			if stateRank[a.State] != stateRank[b.State] {
+				return stateRank[a.State] < stateRank[b.State]
+			}
+		case TopSortIdle:
+			if ia, ib := idleFor(a, now), idleFor(b, now); ia != ib {
+				return ia > ib
+			}
+		case TopSortTask:
+			if ta, tb := taskDuration(a, now), taskDuration(b, now); ta != tb {
+				return ta > tb
+			}
+		case TopSortPID:
+			return a.PID < b.PID
+		}
+		if procs[i].Name != procs[j].Name {
+			return procs[i].Name < procs[j].Name
+		}
+		return a.PID < b.PID
+	})
+}
+
+// idleFor returns how long a live process has produced no I/O
+func idleFor(s *Status, now time.Time) time.Duration {
+	if s.State == StateStopped {
+		return 0
+	}
+	idle := time.Duration(s.IdleSeconds * float64(time.Second))
+	if !s.UpdatedAt.IsZero() && now.After(s.UpdatedAt) {
+		idle += now.Sub(s.UpdatedAt)
+	}
+	return idle
+}
+
+// taskDuration returns how long the current task has run, or how long the
+// last one took once the process is waiting or stopped
+func taskDuration(s *Status, now time.Time) time.Duration {
+	if s.TaskStartTime.IsZero() {
+		return 0
+	}
+	if s.State == StateRunning {
+		return now.Sub(s.TaskStartTime)
+	}
+	if s.StateChangedAt.After(s.TaskStartTime) {
+		return s.StateChangedAt.Sub(s.TaskStartTime)
+	}
+	return 0
+}
+
+// shortDuration formats a duration compactly, e.g. 45s, 3m12s, 1h05m
+func shortDuration(d time.Duration) string {
+	if d < 0 {
+		d = 0
+	}
+	sec := int(d.Seconds())
+	switch {
+	case sec < 60:
+		return fmt.Sprintf("%ds", sec)
+	case sec < 3600:
+		return fmt.Sprintf("%dm%02ds", sec/60, sec%60)
+	default:
+		return fmt.Sprintf("%dh%02dm", sec/3600, sec%3600/60)
+	}
+}
+
+// handleKey applies one key press to the view and reports whether to quit.
+// shown is the current process list in display order.
+func (v *topView) handleKey(key []byte, shown []monitoredProcess) bool {
+	k := string(key)
+	if v.editing {
+		switch {
+		case k == "\r" || k == "\n":
+			v.filter = v.input
+			v.editing = false
+		case k == "\x1b" || k == "\x03":
+			v.editing = false
+		case k == "\x7f" || k == "\b":
+			if r := []rune(v.input); len(r) > 0 {
+				v.input = string(r[:len(r)-1])
+			}
+		case !strings.HasPrefix(k, "\x1b") && key[0] >= 0x20:
+			v.input += k
+		}
+		return false
+	}
+
+	switch k {
+	case "q", "\x03", "\x04":
+		return true
+	case "j", "\x1b[B", "\x1bOB":
+		v.moveSelection(shown, 1)
+	case "k", "\x1b[A", "\x1bOA":
+		v.moveSelection(shown, -1)
+	case "g", "\x1b[H":
+		v.moveSelection(shown, -len(shown))
+	case "G", "\x1b[F":
+		v.moveSelection(shown, len(shown))
+	case "s":
+		for i, sk := range topSortKeys {
+			if sk == v.sortKey {
+				v.sortKey = topSortKeys[(i+1)%len(topSortKeys)]
+				break
+			}
+		}
+	case "r":
+		v.reverse = !v.reverse
+	case "/":
+		v.editing = true
+		v.input = v.filter
+	case "\x1b":
+		v.filter = ""
+	case "d", "\r":
+		v.detail = !v.detail
+	}
+	return false
+}
+
+// moveSelection moves the selected row by delta within shown
+func (v *topView) moveSelection(shown []monitoredProcess, delta int) {
+	if len(shown) == 0 {
+		return
+	}
+	idx := v.selectedIndex(shown) + delta
+	idx = clamp(idx, 0, len(shown)-1)
+	v.selectedPID = shown[idx].Status.PID
+}
+
+// selectedIndex returns the row of the selected PID, or 0 when it is gone
+func (v *topView) selectedIndex(shown []monitoredProcess) int {
+	for i, p := range shown {
+		if p.Status.PID == v.selectedPID {
+			return i
+		}
+	}
+	return 0
+}
+
+// render lays out the dashboard as exactly height lines of width columns
+func (v *topView) render(procs []monitoredProcess, width, height int, now time.Time) []string {
+	shown := v.visible(procs, now)
+	if len(shown) > 0 {
+		v.selectedPID = shown[v.selectedIndex(shown)].Status.PID
+	}
+
+	counts := make(map[string]int)
+	for _, p := range procs {
+		counts[p.Status.State]++
+	}
+	title := fmt.Sprintf("kiromon top  %d processes (%d waiting, %d running, %d stopped)  sort: %s",
+		len(procs), counts[StateWaiting], counts[StateRunning], counts[StateStopped], v.sortKey)
+	if v.reverse {
+		title += " (reversed)"
+	}
+	if v.filter != "" {
+		title += fmt.Sprintf("  filter: %q", v.filter)
+	}
+	clock := now.Format("15:04:05")
+	lines := []string{ansiBold + fitWidth(title, width-len(clock)-1) + " " + clock + ansiReset}
+
+	// Columns after the fixed ones share the rest: last line, then cwd on wide terminals
+	const fixed = 16 + 1 + 8 + 1 + 8 + 1 + 7 + 1 + 7 + 1 + 7 + 1
+	rest := width - fixed
+	cwdWidth := 0
+	if rest >= 80 {
+		cwdWidth = rest / 3
+		rest -= cwdWidth + 1
+	}
+	header := fmt.Sprintf("%s %s %s %s %s %s %s", fitWidth("NAME", 16), fitWidth("PID", 8), fitWidth("STATE", 8),
+		fitWidth("FOR", 7), fitWidth("TASK", 7), fitWidth("IDLE", 7), fitWidth("LAST LINE", rest))
+	if cwdWidth > 0 {
+		header += " " + fitWidth("CWD", cwdWidth)
+	}
+	lines = append(lines, ansiReverse+fitWidth(header, width)+ansiReset)
+
+	// Rows above the detail pane and the help line
+	footer := 1
+	detailHeight := 0
+	if v.detail && len(shown) > 0 {
+		detailHeight = clamp(height*2/5, 4, height)
+	}
+	listHeight := height - len(lines) - detailHeight - footer
+	if listHeight < 1 {
+		listHeight = 1
+		detailHeight = clamp(height-len(lines)-listHeight-footer, 0, height)
+	}
+
+	selected := v.selectedIndex(shown)
+	first := 0
+	if selected >= listHeight {
+		first = selected - listHeight + 1
+	}
+	for i := first; i < len(shown) && i < first+listHeight; i++ {
+		lines = append(lines, topLine(shown[i], i == selected, rest, cwdWidth, width, now))
+	}
+	if len(shown) == 0 {
+		msg := "No monitored processes found"
+		if len(procs) > 0 {
+			msg = "No processes match the filter"
+		}
+		lines = append(lines, msg)
+	}
+	for len(lines) < height-detailHeight-footer {
+		lines = append(lines, "")
+	}
+
+	if detailHeight > 0 {
+		lines = append(lines, topDetail(shown[selected], width, detailHeight, now)...)
+	}
+
+	help := "q quit  ↑↓/jk select  s sort  r reverse  / filter  Esc clear filter  d detail"
+	if v.editing {
+		help = "filter: " + v.input + "_  (Enter apply, Esc cancel)"
+	}
+	lines = append(lines, fitWidth(help, width))
+	if len(lines) > height {
+		lines = lines[len(lines)-height:]
+	}
+	return lines
+}
+
+// topLine formats one process row
+func topLine(p monitoredProcess, selected bool, lastWidth, cwdWidth, width int, now time.Time) string {
+	s := p.Status
+	idle := shortDuration(idleFor(s, now))
+	if s.State == StateStopped {
+		idle = exitDescription(s)
+	}
+	task := "-"
+	if d := taskDuration(s, now); d > 0 {
+		task = shortDuration(d)
+	}
+	state := fitWidth(displayState(s.State, s.Substate), 8)
+	switch s.State {
+	case StateWaiting:
+		state = "\x1b[33m" + state + ansiDefaultFg
+	case StateRunning:
+		state = "\x1b[32m" + state + ansiDefaultFg
+	default:
+		state = "\x1b[90m" + state + ansiDefaultFg
+	}
+	line := fmt.Sprintf("%s %s %s %s %s %s %s", fitWidth(p.Name, 16), fitWidth(strconv.Itoa(s.PID), 8), state,
+		fitWidth(shortDuration(now.Sub(s.StateChangedAt)), 7), fitWidth(task, 7), fitWidth(idle, 7), fitWidth(s.LastLine, lastWidth))
+	if cwdWidth > 0 {
+		line += " " + fitWidth(s.Cwd, cwdWidth)
+	}
+	if selected {
+		return ansiReverse + line + ansiReset
+	}
+	return line
+}
+
+// topDetail formats the detail pane for the selected process
+func topDetail(p monitoredProcess, width, height int, now time.Time) []string {
+	s := p.Status
+	title := fmt.Sprintf("── %s (PID %d) %s ", p.Name, s.PID, s.Command)
+	if pad := width - stringWidth(title); pad > 0 {
+		title += strings.Repeat("─", pad)
+	}
+	lines := []string{ansiBold + fitWidth(title, width) + ansiReset}
+
+	info := fmt.Sprintf("%s since %s", s.State, s.StateChangedAt.Format("15:04:05"))
+	if s.Reason != "" {
+		info += " (" + s.Reason + ")"
+	}
+	info += fmt.Sprintf("  tasks: %d", s.TaskCount)
+	if s.State == StateStopped {
+		info += "  " + exitDescription(s)
+	}
+	if s.Cwd != "" {
+		info += "  " + s.Cwd
+	}
+	lines = append(lines, fitWidth(info, width))
+	if s.Transcript != "" && height > 3 {
+		lines = append(lines, fitWidth("transcript: "+s.Transcript, width))
+	}
+
+	output := s.LastLines
+	if room := clamp(height-len(lines), 0, height); len(output) > room {
+		output = output[len(output)-room:]
+	}
+	for _, l := range output {
+		lines = append(lines, fitWidth(l, width))
+	}
+	for len(lines) < height {
+		lines = append(lines, "")
+	}
+	return lines[:height]
+}
@@ -0,0 +1,158 @@
+package kiromon
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func topTestProcesses(now time.Time) []monitoredProcess {
+	return []monitoredProcess{
+		{Name: "kiro-cli", Status: &Status{State: StateRunning, PID: 30, Cwd: "/work/api", LastLine: "Thinking...",
+			UpdatedAt: now, IdleSeconds: 1, TaskStartTime: now.Add(-5 * time.Minute), StateChangedAt: now.Add(-5 * time.Minute)}},
+		{Name: "kiro-cli", Status: &Status{State: StateWaiting, PID: 10, Cwd: "/work/web", LastLine: "> ",
+			UpdatedAt: now, IdleSeconds: 120, TaskStartTime: now.Add(-10 * time.Minute), StateChangedAt: now.Add(-2 * time.Minute),
+			TaskCount: 2, LastLines: []string{"done", "> "}}},
+		{Name: "bash", Status: &Status{State: StateStopped, PID: 20, UpdatedAt: now, StateChangedAt: now}},
+	}
+}
+
+func topPIDs(procs []monitoredProcess) []int {
+	var pids []int
+	for _, p := range procs {
+		pids = append(pids, p.Status.PID)
+	}
+	return pids
+}
+
+func TestTopVisible(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	procs := topTestProcesses(now)
+
+	tests := []struct {
+		name string
+		view topView
+		want []int
+	}{
+		{"state", topView{sortKey: TopSortState}, []int{10, 30, 20}},
+		{"name", topView{sortKey: TopSortName}, []int{20, 10, 30}},
+		{"idle", topView{sortKey: TopSortIdle}, []int{10, 30, 20}},
+		{"task", topView{sortKey: TopSortTask}, []int{10, 30, 20}},
+		{"pid reversed", topView{sortKey: TopSortPID, reverse: true}, []int{30, 20, 10}},
+		{"filter cwd", topView{sortKey: TopSortState, filter: "WEB"}, []int{10}},
+		{"filter state", topView{sortKey: TopSortState, filter: "stopped"}, []int{20}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := topPIDs(tt.view.visible(procs, now))
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Fatalf("got %v, want %v", got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestTopHandleKey(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	v := &topView{sortKey: TopSortState, detail: true}
+	shown := v.visible(topTestProcesses(now), now)
+
+	v.handleKey([]byte("j"), shown)
+	if v.selectedPID != 30 {
+		t.Errorf("after j selected %d", v.selectedPID)
+	}
+	v.handleKey([]byte("\x1b[B"), shown)
+	v.handleKey([]byte("\x1b[B"), shown)
+	if v.selectedPID != 20 {
+		t.Errorf("selection should stop at the last row, got %d", v.selectedPID)
+	}
+	v.handleKey([]byte("g"), shown)
+	if v.selectedPID != 10 {
+		t.Errorf("after g selected %d", v.selectedPID)
+	}
+
+	v.handleKey([]byte("s"), shown)
+	if v.sortKey != TopSortName {
+		t.Errorf("sort = %s", v.sortKey)
+	}
+
+	// Typing a filter does not trigger other keys
+	for _, k := range []string{"/", "q", "x", "\x7f", "a", "p", "i", "\r"} {
+		if v.handleKey([]byte(k), shown) {
+			t.Fatalf("quit while editing on %q", k)
+		}
+	}
+	if v.filter != "qapi" || v.editing {
+		t.Errorf("filter = %q editing = %v", v.filter, v.editing)
+	}
+	v.handleKey([]byte("\x1b"), shown)
+	if v.filter != "" {
+		t.Errorf("Esc did not clear the filter: %q", v.filter)
+	}
+
+	if !v.handleKey([]byte("q"), shown) || !v.handleKey([]byte("\x03"), shown) {
+		t.Error("q and Ctrl-C should quit")
+	}
+}
+
+func TestTopRender(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	v := &topView{sortKey: TopSortState, detail: true}
+	lines := v.render(topTestProcesses(now), 100, 20, now)
+	if len(lines) != 20 {
+		t.Fatalf("got %d lines", len(lines))
+	}
+	text := strings.Join(lines, "\n")
+	for _, want := range []string{"3 processes (1 waiting, 1 running, 1 stopped)", "2m00s", "5m00s", "unknown", "PID 10", "tasks: 2", "done"} {
+		if !strings.Contains(text, want) {
+			t.Errorf("render missing %q:\n%s", want, text)
+		}
+	}
+
+	// A tiny terminal still gets exactly its height
+	if lines := v.render(topTestProcesses(now), 30, 3, now); len(lines) != 3 {
+		t.Errorf("got %d lines for height 3", len(lines))
+	}
+	empty := (&topView{sortKey: TopSortState}).render(nil, 80, 10, now)
+	if !strings.Contains(strings.Join(empty, "\n"), "No monitored processes found") {
+		t.Error("empty dashboard has no message")
+	}
+}
+
+func TestFitWidth(t *testing.T) {
+	tests := []struct {
+		s     string
+		width int
+		want  string
+	}{
+		{"abc", 5, "abc  "},
+		{"abcdef", 4, "abc…"},
+		{"完了です", 5, "完了…"},
+		{"完了です", 6, "完了… "},
+		{"abc", 0, ""},
+	}
+	for _, tt := range tests {
+		if got := fitWidth(tt.s, tt.width); got != tt.want {
+			t.Errorf("fitWidth(%q, %d) = %q, want %q", tt.s, tt.width, got, tt.want)
+		}
+	}
+}
+
+func TestShortDuration(t *testing.T) {
+	tests := map[time.Duration]string{
+		-time.Second:                  "0s",
+		45 * time.Second:              "45s",
+		3*time.Minute + 2*time.Second: "3m02s",
+		time.Hour + 5*time.Minute + 9: "1h05m",
+	}
+	for d, want := range tests {
+		if got := shortDuration(d); got != want {
+			t.Errorf("shortDuration(%v) = %q, want %q", d, got, want)
+		}
+	}
+}
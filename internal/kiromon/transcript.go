@@ -0,0 +1,330 @@
+package kiromon
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultTranscriptKeep is how many task transcripts are kept per command
+const DefaultTranscriptKeep = 50
+
+// TranscriptConfig enables per-task output transcripts for a preset
+type TranscriptConfig struct {
+	Enabled bool   `yaml:"enabled"`
+	Dir     string `yaml:"dir"`  // default: transcripts/ next to the task history
+	Raw     bool   `yaml:"raw"`  // also keep the output with escape sequences as .raw
+	Keep    int    `yaml:"keep"` // transcripts kept per command (default: 50)
+}
+
+// getTranscriptDir returns the directory for transcripts
+func (c *TranscriptConfig) getTranscriptDir() string {
+	if c.Dir != "" {
+		return expandHome(c.Dir)
+	}
+	return filepath.Join(filepath.Dir(getHistoryPath()), "transcripts")
+}
+
+// ansiStripper removes escape sequences and control characters from a byte
+// stream. Sequences may be split across writes.
+type ansiStripper struct {
+	w     io.Writer
+	state int
+}
+
+// ansiStripper states
+const (
+	stripText   = iota
+	stripEscape // after ESC
+	stripCharset
+	stripCSI    // ESC [ ... final byte
+	stripString // OSC, DCS, SOS, PM, APC: until BEL or ESC \
+	stripStringEscape
+)
+
+// Write filters p and writes the remaining text
+func (s *ansiStripper) Write(p []byte) (int, error) {
+	out := make([]byte, 0, len(p))
+	for _, b := range p {
+		switch s.state {
+		case stripText:
+			switch {
+			case b == 0x1b:
+				s.state = stripEscape
+			case b == '\n' || b == '\t' || b >= 0x20 && b != 0x7f:
+				out = append(out, b)
+			}
+		case stripEscape:
+			switch b {
+			case '[':
+				s.state = stripCSI
+			case ']', 'P', 'X', '^', '_':
+				s.state = stripString
+			case '(', ')', '*', '+', '#', '%':
+				s.state = stripCharset
+			default:
+				s.state = stripText
+			}
+		case stripCharset:
+			s.state = stripText
+		case stripCSI:
+			if b >= 0x40 && b <= 0x7e {
+				s.state = stripText
+			}
+		case stripString:
+			if b == 0x07 {
+				s.state = stripText
+			} else if b == 0x1b {
+				s.state = stripStringEscape
+			}
+		case stripStringEscape:
+			if b == '\\' {
+				s.state = stripText
+			} else {
+				s.state = stripString
+			}
+		}
+	}
+	if _, err := s.w.Write(out); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// transcriptLines writes stripped text line by line. A line redrawn after a
+// carriage return, such as a spinner or progress bar, keeps only its last
+// content.
+type transcriptLines struct {
+	w       io.Writer
+	partial []byte
+	cr      bool // a carriage return moved back to the start of the line
+}
+
+// Write buffers the current line and writes complete ones
+func (l *transcriptLines) Write(p []byte) (int, error) {
+	for _, b := range p {
+		if b == '\n' {
+			l.partial = append(l.partial, b)
+			if err := l.flush(); err != nil {
+				return 0, err
+			}
+			continue
+		}
+		if l.cr {
+			l.partial = l.partial[:0]
+			l.cr = false
+		}
+		l.partial = append(l.partial, b)
+	}
+	return len(p), nil
+}
+
+// flush writes the buffered line, which may be unterminated
+func (l *transcriptLines) flush() error {
+	_, err := l.w.Write(l.partial)
+	l.partial = l.partial[:0]
+	l.cr = false
+	return err
+}
+
+// transcriptRecorder writes PTY output to one file per running -> waiting
+// cycle. A file is opened on the first output after the previous cycle ended,
+// so it also contains the prompt the user typed.
+type transcriptRecorder struct {
+	dir    string
+	prefix string // <name>-<pid>
+	name   string
+	raw    bool
+	keep   int
+
+	mu      sync.Mutex
+	seq     int
+	strip   ansiStripper // writes to lines
+	lines   transcriptLines
+	text    *os.File
+	rawFile *os.File
+	current string // transcript being written
+	last    string // most recently completed transcript
+}
+
+// newTranscriptRecorder prepares the transcript directory for a wrapped command
+func newTranscriptRecorder(c *TranscriptConfig, name string, pid int) (*transcriptRecorder, error) {
+	dir := c.getTranscriptDir()
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	keep := c.Keep
+	if keep <= 0 {
+		keep = DefaultTranscriptKeep
+	}
+	return &transcriptRecorder{
+		dir:    dir,
+		prefix: fmt.Sprintf("%s-%d", name, pid),
+		name:   name,
+		raw:    c.Raw,
+		keep:   keep,
+	}, nil
+}
+
+// Write records a chunk of PTY output
+func (r *transcriptRecorder) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.text == nil {
+		if err := r.open(); err != nil {
+			return 0, err
+		}
+	}
+	if r.rawFile != nil {
+		r.rawFile.Write(p)
+	}
+	// The stripper drops carriage returns, so they are passed to the line
+	// buffer here and the line restarts with the text redrawn over it
+	n := len(p)
+	for len(p) > 0 {
+		i := bytes.IndexByte(p, '\r')
+		if i < 0 {
+			if _, err := r.strip.Write(p); err != nil {
+				return 0, err
+			}
+			break
+		}
+		if _, err := r.strip.Write(p[:i]); err != nil {
+			return 0, err
+		}
+		r.lines.cr = true
+		p = p[i+1:]
+	}
+	return n, nil
+}
+
+// open starts the next transcript file
+func (r *transcriptRecorder) open() error {
+	r.seq++
+	base := fmt.Sprintf("%s-%s-%03d", r.prefix, time.Now().Format("20060102-150405"), r.seq)
+	path := filepath.Join(r.dir, base+".log")
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	r.text = f
+	r.lines = transcriptLines{w: f}
+	r.strip.w = &r.lines
+	r.current = path
+	if r.raw {
+		if rf, err := os.OpenFile(filepath.Join(r.dir, base+".raw"), os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600); err == nil {
+			r.rawFile = rf
+		}
+	}
+	return nil
+}
+
+// EndTask closes the current transcript so the next output starts a new one,
+// then removes the oldest transcripts beyond the keep limit
+func (r *transcriptRecorder) EndTask() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.text == nil {
+		return
+	}
+	r.closeFiles()
+	r.last = r.current
+	r.current = ""
+	r.rotate()
+}
+
+// Discard closes and removes the transcript being written, for output
+// that did not belong to a task
+func (r *transcriptRecorder) Discard() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.text == nil {
+		return
+	}
+	r.closeFiles()
+	os.Remove(r.current)
+	if r.raw {
+		os.Remove(strings.TrimSuffix(r.current, ".log") + ".raw")
+	}
+	r.current = ""
+}
+
+// closeFiles closes the open transcript files
+func (r *transcriptRecorder) closeFiles() {
+	r.lines.flush()
+	r.text.Close()
+	r.text = nil
+	if r.rawFile != nil {
+		r.rawFile.Close()
+		r.rawFile = nil
+	}
+}
+
+// isTranscriptOf reports whether fileName is a "<name>-<pid>-....log" transcript of the command
+func isTranscriptOf(fileName, name string) bool {
+	rest := strings.TrimPrefix(fileName, name+"-")
+	if rest == fileName || !strings.HasSuffix(rest, ".log") {
+		return false
+	}
+	return rest[0] >= '0' && rest[0] <= '9'
+}
+
+// Path returns the transcript being written, or the last completed one
+func (r *transcriptRecorder) Path() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.current != "" {
+		return r.current
+	}
+	return r.last
+}
+
+// LastPath returns the most recently completed transcript
+func (r *transcriptRecorder) LastPath() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.last
+}
+
+// rotate removes the oldest transcripts of this command beyond the keep limit
+func (r *transcriptRecorder) rotate() {
+	entries, err := os.ReadDir(r.dir)
+	if err != nil {
+		return
+	}
+	type transcript struct {
+		base    string
+		modTime time.Time
+	}
+	var found []transcript
+	for _, entry := range entries {
+		name := entry.Name()
+		if !isTranscriptOf(name, r.name) {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		found = append(found, transcript{base: strings.TrimSuffix(name, ".log"), modTime: info.ModTime()})
+	}
+	if len(found) <= r.keep {
+		return
+	}
+	sort.Slice(found, func(i, j int) bool {
+		if found[i].modTime.Equal(found[j].modTime) {
+			return found[i].base < found[j].base
+		}
+		return found[i].modTime.Before(found[j].modTime)
+	})
+	for _, t := range found[:len(found)-r.keep] {
+		os.Remove(filepath.Join(r.dir, t.base+".log"))
+		os.Remove(filepath.Join(r.dir, t.base+".raw"))
+	}
+}
@@ -0,0 +1,123 @@
+package kiromon
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestAnsiStripper(t *testing.T) {
+	tests := []struct {
+		name   string
+		chunks []string
+		want   string
+	}{
+		{"plain", []string{"hello\r\nworld\n"}, "hello\nworld\n"},
+		{"colors", []string{"\x1b[1;32mok\x1b[0m\n"}, "ok\n"},
+		{"split csi", []string{"a\x1b", "[3", "1mb\x1b[0", "m\n"}, "ab\n"},
+		{"osc title", []string{"\x1b]0;title\x07x", "\x1b]8;;http://e\x1b", "\\link\n"}, "xlink\n"},
+		{"charset", []string{"\x1b(Bz\x1b=\n"}, "z\n"},
+		{"controls", []string{"a\bb\x07\tc\n"}, "ab\tc\n"},
+		{"utf8", []string{"完", "了\n"}, "完了\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			s := &ansiStripper{w: &buf}
+			for _, c := range tt.chunks {
+				s.Write([]byte(c))
+			}
+			if got := buf.String(); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTranscriptRecorder(t *testing.T) {
+	dir := t.TempDir()
+	r, err := newTranscriptRecorder(&TranscriptConfig{Dir: dir, Raw: true, Keep: 2}, "kiro-cli", 42)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Nothing is written before the first output
+	r.EndTask()
+	if r.Path() != "" {
+		t.Fatalf("Path() = %q before any output", r.Path())
+	}
+
+	var paths []string
+	for _, out := range []string{"one", "two", "three"} {
+		r.Write([]byte("\x1b[32m" + out + "\x1b[0m\r\n"))
+		current := r.Path()
+		r.EndTask()
+		if r.LastPath() != current {
+			t.Errorf("LastPath() = %q, want %q", r.LastPath(), current)
+		}
+		paths = append(paths, current)
+	}
+
+	// Only the newest two transcripts are kept, with their raw output
+	if _, err := os.Stat(paths[0]); !os.IsNotExist(err) {
+		t.Errorf("oldest transcript was not rotated out: %v", err)
+	}
+	data, err := os.ReadFile(paths[2])
+	if err != nil || string(data) != "three\n" {
+		t.Errorf("transcript = %q, %v", data, err)
+	}
+	raw, err := os.ReadFile(strings.TrimSuffix(paths[2], ".log") + ".raw")
+	if err != nil || !strings.Contains(string(raw), "\x1b[32m") {
+		t.Errorf("raw transcript = %q, %v", raw, err)
+	}
+	if !strings.HasPrefix(filepath.Base(paths[2]), "kiro-cli-42-") {
+		t.Errorf("unexpected file name %s", paths[2])
+	}
+
+	// Output that never became a task is discarded
+	r.Write([]byte("> "))
+	pending := r.Path()
+	r.Discard()
+	if _, err := os.Stat(pending); !os.IsNotExist(err) {
+		t.Errorf("discarded transcript still exists: %v", err)
+	}
+	if r.Path() != paths[2] {
+		t.Errorf("Path() after Discard = %q, want %q", r.Path(), paths[2])
+	}
+}
+
+func TestTranscriptCarriageReturn(t *testing.T) {
+	r, err := newTranscriptRecorder(&TranscriptConfig{Dir: t.TempDir()}, "kiro-cli", 42)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Spinner redraws keep only the final content of the line, also when
+	// split across writes; the unterminated prompt is kept at the end
+	r.Write([]byte("⠋ thinking\r⠙ thin"))
+	r.Write([]byte("king\r\x1b[2K"))
+	r.Write([]byte("done\r\nnext line\r\n> "))
+	path := r.Path()
+	r.EndTask()
+	if data, err := os.ReadFile(path); err != nil || string(data) != "done\nnext line\n> " {
+		t.Errorf("transcript = %q, %v", data, err)
+	}
+}
+
+func TestIsTranscriptOf(t *testing.T) {
+	tests := []struct {
+		file string
+		want bool
+	}{
+		{"kiro-cli-42-20240101-120000-001.log", true},
+		{"kiro-cli-42-20240101-120000-001.raw", false},
+		{"kiro-cli-extra-42-20240101-120000-001.log", false},
+		{"kiro-42-20240101-120000-001.log", false},
+	}
+	for _, tt := range tests {
+		if got := isTranscriptOf(tt.file, "kiro-cli"); got != tt.want {
+			t.Errorf("isTranscriptOf(%q) = %v, want %v", tt.file, got, tt.want)
+		}
+	}
+}
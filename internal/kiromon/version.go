@@ -0,0 +1,18 @@
+package kiromon
+
+import "runtime/debug"
+
+// Version is set at build time with -ldflags "-X github.com/ukaji3/kiromon/internal/kiromon.Version=..."
+var Version = ""
+
+// kiromonVersion returns the build version, falling back to the module
+// version recorded by "go install"
+func kiromonVersion() string {
+	if Version != "" {
+		return Version
+	}
+	if info, ok := debug.ReadBuildInfo(); ok && info.Main.Version != "" {
+		return info.Main.Version
+	}
+	return "dev"
+}
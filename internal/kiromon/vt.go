@@ -0,0 +1,690 @@
+package kiromon
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// Default screen size used when stdin is not a terminal
+const (
+	DefaultRows = 24
+	DefaultCols = 80
+)
+
+// Parser states of the escape sequence state machine
+const (
+	vtGround = iota
+	vtEscape
+	vtEscapeSkip // ESC ( B and friends: skip one more byte
+	vtCSI
+	vtOSC
+	vtString // DCS, SOS, PM, APC: skipped until ST or BEL
+	vtStringEsc
+)
+
+// vtScreen is a minimal VT100/xterm screen model fed with raw PTY output.
+// It tracks what is actually visible, so TUIs that redraw with cursor
+// movement, line clearing and the alternate screen can be inspected.
+type vtScreen struct {
+	mu sync.Mutex
+
+	rows, cols int
+	grid       [][]vtCell // visible screen
+	mainGrid   [][]vtCell // saved main screen while the alternate screen is active
+	alt        bool
+
+	row, col    int
+	savedRow    int
+	savedCol    int
+	wrapPending bool
+	top, bottom int // scroll region, inclusive
+	state       int
+	params      []int
+	paramSet    bool
+	private     byte
+	utf8Buf     []byte            // partial multibyte sequence split across writes
+	onScroll    func(line string) // receives lines scrolled off the main screen
+}
+
+// vtCell is one screen cell. A wide character occupies its own cell and a
+// following continuation cell; combining marks are attached to the base cell.
+type vtCell struct {
+	ch   rune   // 0 means blank
+	comb []rune // combining marks following ch
+	cont bool   // right half of a wide character
+}
+
+// newVTScreen creates a blank screen of the given size
+func newVTScreen(rows, cols int, onScroll func(line string)) *vtScreen {
+	if rows <= 0 {
+		rows = DefaultRows
+	}
+	if cols <= 0 {
+		cols = DefaultCols
+	}
+	v := &vtScreen{rows: rows, cols: cols, onScroll: onScroll}
+	v.grid = newGrid(rows, cols)
+	v.bottom = rows - 1
+	return v
+}
+
+// newGrid allocates a blank rows x cols grid
+func newGrid(rows, cols int) [][]vtCell {
+	grid := make([][]vtCell, rows)
+	for i := range grid {
+		grid[i] = make([]vtCell, cols)
+	}
+	return grid
+}
+
+// Write feeds raw PTY output into the screen model
+func (v *vtScreen) Write(p []byte) (int, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	for _, b := range p {
+		v.feed(b)
+	}
+	return len(p), nil
+}
+
+// Resize changes the screen size, keeping the cursor row visible
+func (v *vtScreen) Resize(rows, cols int) {
+	if rows <= 0 || cols <= 0 {
+		return
+	}
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	// Drop rows from the top so the cursor stays on screen
+	drop := 0
+	if v.row >= rows {
+		drop = v.row - rows + 1
+	}
+	if !v.alt {
+		for i := 0; i < drop; i++ {
+			v.emitScroll(v.grid[i])
+		}
+	}
+	v.grid = resizeGrid(v.grid, rows, cols, drop)
+	if v.mainGrid != nil {
+		v.mainGrid = resizeGrid(v.mainGrid, rows, cols, 0)
+	}
+
+	v.rows, v.cols = rows, cols
+	v.top, v.bottom = 0, rows-1
+	v.row = clamp(v.row-drop, 0, rows-1)
+	v.col = clamp(v.col, 0, cols-1)
+	v.savedRow = clamp(v.savedRow, 0, rows-1)
+	v.savedCol = clamp(v.savedCol, 0, cols-1)
+	v.wrapPending = false
+}
+
+// resizeGrid copies grid into a new size, skipping the first drop rows
+func resizeGrid(grid [][]vtCell, rows, cols, drop int) [][]vtCell {
+	resized := newGrid(rows, cols)
+	for i := 0; i < rows && i+drop < len(grid); i++ {
+		copy(resized[i], grid[i+drop])
+	}
+	return resized
+}
+
+// Lines returns the visible rows with trailing blanks trimmed
+func (v *vtScreen) Lines() []string {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	lines := make([]string, len(v.grid))
+	for i, r := range v.grid {
+		lines[i] = rowText(r)
+	}
+	return lines
+}
+
+// Snapshot returns the visible rows together with the cursor row
+func (v *vtScreen) Snapshot() ([]string, int) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	lines := make([]string, len(v.grid))
+	for i, r := range v.grid {
+		lines[i] = rowText(r)
+	}
+	return lines, v.row
+}
+
+// Size returns the screen dimensions
+func (v *vtScreen) Size() (rows, cols int) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return v.rows, v.cols
+}
+
+// Redraw returns output that repaints the visible text and the cursor
+// position on a cleared terminal. Colors and attributes are not tracked.
+func (v *vtScreen) Redraw() []byte {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	var b strings.Builder
+	b.WriteString("\x1b[H\x1b[2J")
+	for i, r := range v.grid {
+		if i > 0 {
+			b.WriteString("\r\n")
+		}
+		b.WriteString(rowText(r))
+	}
+	fmt.Fprintf(&b, "\x1b[%d;%dH", v.row+1, v.col+1)
+	return []byte(b.String())
+}
+
+// rowText converts a grid row to text, treating blank cells as spaces
+func rowText(r []vtCell) string {
+	var b strings.Builder
+	for _, c := range r {
+		switch {
+		case c.cont:
+			// Already written as part of the wide character
+		case c.ch == 0:
+			b.WriteByte(' ')
+		default:
+			b.WriteRune(c.ch)
+			for _, m := range c.comb {
+				b.WriteRune(m)
+			}
+		}
+	}
+	return strings.TrimRight(b.String(), " ")
+}
+
+// emitScroll reports a line that left the top of the main screen
+func (v *vtScreen) emitScroll(r []vtCell) {
+	if v.onScroll != nil {
+		if line := rowText(r); strings.TrimSpace(line) != "" {
+			v.onScroll(line)
+		}
+	}
+}
+
+// feed processes one byte of output
+func (v *vtScreen) feed(b byte) {
+	switch v.state {
+	case vtEscape:
+		v.escape(b)
+		return
+	case vtEscapeSkip:
+		v.state = vtGround
+		return
+	case vtCSI:
+		v.csiByte(b)
+		return
+	case vtOSC:
+		// OSC ends with BEL or ST (ESC \)
+		if b == 0x07 {
+			v.state = vtGround
+		} else if b == 0x1b {
+			v.state = vtStringEsc
+		}
+		return
+	case vtString:
+		if b == 0x07 {
+			v.state = vtGround
+		} else if b == 0x1b {
+			v.state = vtStringEsc
+		}
+		return
+	case vtStringEsc:
+		// ESC \ terminates the string; any other byte starts a new sequence
+		v.state = vtGround
+		if b != '\\' {
+			v.escape(b)
+		}
+		return
+	}
+
+	if b >= 0x80 {
+		v.utf8Byte(b)
+		return
+	}
+	// A partial multibyte sequence interrupted by ASCII is invalid
+	v.utf8Buf = v.utf8Buf[:0]
+
+	switch {
+	case b == 0x1b:
+		v.state = vtEscape
+	case b == '\r':
+		v.col = 0
+		v.wrapPending = false
+	case b == '\n' || b == 0x0b || b == 0x0c:
+		v.lineFeed()
+	case b == '\b':
+		if v.col > 0 {
+			v.col--
+		}
+		v.wrapPending = false
+	case b == '\t':
+		v.col = min((v.col/8+1)*8, v.cols-1)
+		v.wrapPending = false
+	case b >= 0x20 && b < 0x7f:
+		v.put(rune(b))
+	}
+}
+
+// utf8Byte collects a multibyte UTF-8 sequence, which may be split across
+// writes, and prints the rune once complete
+func (v *vtScreen) utf8Byte(b byte) {
+	if utf8.RuneStart(b) {
+		v.utf8Buf = v.utf8Buf[:0]
+	} else if len(v.utf8Buf) == 0 {
+		return // stray continuation byte
+	}
+	v.utf8Buf = append(v.utf8Buf, b)
+	if !utf8.FullRune(v.utf8Buf) {
+		return
+	}
+	r, _ := utf8.DecodeRune(v.utf8Buf)
+	v.utf8Buf = v.utf8Buf[:0]
+	if r != utf8.RuneError && isPrintableRune(r) {
+		v.put(r)
+	}
+}
+
+// put writes a printable character at the cursor, wrapping at the right margin
+func (v *vtScreen) put(r rune) {
+	width := runeWidth(r)
+	if width == 0 {
+		v.combine(r)
+		return
+	}
+
+	// A wide character that does not fit wraps to the next line
+	if width == 2 && v.col == v.cols-1 && !v.wrapPending {
+		v.clearCell(v.row, v.col)
+		v.wrapPending = true
+	}
+	if v.wrapPending {
+		v.col = 0
+		v.lineFeed()
+		v.wrapPending = false
+	}
+	if width > v.cols {
+		return
+	}
+
+	v.clearCell(v.row, v.col)
+	v.grid[v.row][v.col] = vtCell{ch: r}
+	if width == 2 {
+		v.clearCell(v.row, v.col+1)
+		v.grid[v.row][v.col+1] = vtCell{cont: true}
+	}
+
+	if v.col+width >= v.cols {
+		v.col = v.cols - 1
+		v.wrapPending = true
+	} else {
+		v.col += width
+	}
+}
+
+// combine attaches a zero-width rune to the character before the cursor
+func (v *vtScreen) combine(r rune) {
+	col := v.col - 1
+	if v.wrapPending {
+		col = v.col
+	}
+	if col < 0 {
+		return
+	}
+	if v.grid[v.row][col].cont && col > 0 {
+		col--
+	}
+	cell := &v.grid[v.row][col]
+	if cell.ch != 0 {
+		cell.comb = append(cell.comb, r)
+	}
+}
+
+// clearCell blanks a cell, including the other half of a wide character
+func (v *vtScreen) clearCell(row, col int) {
+	line := v.grid[row]
+	if line[col].cont && col > 0 {
+		line[col-1] = vtCell{}
+	}
+	if col+1 < len(line) && line[col+1].cont {
+		line[col+1] = vtCell{}
+	}
+	line[col] = vtCell{}
+}
+
+// lineFeed moves the cursor down, scrolling at the bottom of the scroll region
+func (v *vtScreen) lineFeed() {
+	v.wrapPending = false
+	if v.row == v.bottom {
+		v.scrollUp(1)
+	} else if v.row < v.rows-1 {
+		v.row++
+	}
+}
+
+// reverseIndex moves the cursor up, scrolling down at the top of the scroll region
+func (v *vtScreen) reverseIndex() {
+	v.wrapPending = false
+	if v.row == v.top {
+		v.scrollDown(1)
+	} else if v.row > 0 {
+		v.row--
+	}
+}
+
+// scrollUp scrolls the scroll region up by n lines
+func (v *vtScreen) scrollUp(n int) {
+	n = min(n, v.bottom-v.top+1)
+	for i := 0; i < n; i++ {
+		if v.top == 0 && !v.alt {
+			v.emitScroll(v.grid[v.top])
+		}
+		copy(v.grid[v.top:v.bottom], v.grid[v.top+1:v.bottom+1])
+		v.grid[v.bottom] = make([]vtCell, v.cols)
+	}
+}
+
+// scrollDown scrolls the scroll region down by n lines
+func (v *vtScreen) scrollDown(n int) {
+	n = min(n, v.bottom-v.top+1)
+	for i := 0; i < n; i++ {
+		copy(v.grid[v.top+1:v.bottom+1], v.grid[v.top:v.bottom])
+		v.grid[v.top] = make([]vtCell, v.cols)
+	}
+}
+
+// escape handles the byte following ESC
+func (v *vtScreen) escape(b byte) {
+	v.state = vtGround
+	switch b {
+	case '[':
+		v.state = vtCSI
+		v.params = v.params[:0]
+		v.paramSet = false
+		v.private = 0
+	case ']':
+		v.state = vtOSC
+	case 'P', 'X', '^', '_':
+		v.state = vtString
+	case '(', ')', '*', '+', '#', '%':
+		v.state = vtEscapeSkip
+	case '7':
+		v.saveCursor()
+	case '8':
+		v.restoreCursor()
+	case 'D':
+		v.lineFeed()
+	case 'E':
+		v.col = 0
+		v.lineFeed()
+	case 'M':
+		v.reverseIndex()
+	case 'c':
+		v.reset()
+	}
+}
+
+// csiByte accumulates a control sequence and executes it on the final byte
+func (v *vtScreen) csiByte(b byte) {
+	switch {
+	case b >= '0' && b <= '9':
+		if !v.paramSet {
+			v.params = append(v.params, 0)
+			v.paramSet = true
+		}
+		last := len(v.params) - 1
+		if v.params[last] < 10000 {
+			v.params[last] = v.params[last]*10 + int(b-'0')
+		}
+	case b == ';' || b == ':':
+		if !v.paramSet {
+			v.params = append(v.params, 0)
+		}
+		v.paramSet = false
+	case b == '?' || b == '>' || b == '<' || b == '=':
+		v.private = b
+	case b >= 0x20 && b <= 0x2f:
+		// Intermediate bytes are not needed for the supported sequences
+	case b >= 0x40 && b <= 0x7e:
+		v.state = vtGround
+		v.csi(b)
+	case b == 0x1b:
+		v.state = vtEscape
+	case b < 0x20:
+		// C0 controls are executed even inside a sequence
+		v.state = vtGround
+		v.feed(b)
+		v.state = vtCSI
+	default:
+		v.state = vtGround
+	}
+}
+
+// param returns the i-th CSI parameter, or def if missing or zero
+func (v *vtScreen) param(i, def int) int {
+	if i < len(v.params) && v.params[i] != 0 {
+		return v.params[i]
+	}
+	return def
+}
+
+// csi executes a complete control sequence
+func (v *vtScreen) csi(final byte) {
+	if v.private == '?' {
+		if final == 'h' || final == 'l' {
+			for _, mode := range v.params {
+				v.setPrivateMode(mode, final == 'h')
+			}
+		}
+		return
+	}
+	if v.private != 0 {
+		return
+	}
+
+	v.wrapPending = false
+	switch final {
+	case 'A':
+		v.row = max(v.row-v.param(0, 1), 0)
+	case 'B', 'e':
+		v.row = min(v.row+v.param(0, 1), v.rows-1)
+	case 'C', 'a':
+		v.col = min(v.col+v.param(0, 1), v.cols-1)
+	case 'D':
+		v.col = max(v.col-v.param(0, 1), 0)
+	case 'E':
+		v.row = min(v.row+v.param(0, 1), v.rows-1)
+		v.col = 0
+	case 'F':
+		v.row = max(v.row-v.param(0, 1), 0)
+		v.col = 0
+	case 'G', '`':
+		v.col = clamp(v.param(0, 1)-1, 0, v.cols-1)
+	case 'd':
+		v.row = clamp(v.param(0, 1)-1, 0, v.rows-1)
+	case 'H', 'f':
+		v.row = clamp(v.param(0, 1)-1, 0, v.rows-1)
+		v.col = clamp(v.param(1, 1)-1, 0, v.cols-1)
+	case 'J':
+		v.eraseDisplay(v.param(0, 0))
+	case 'K':
+		v.eraseLine(v.param(0, 0))
+	case 'L':
+		v.insertLines(v.param(0, 1))
+	case 'M':
+		v.deleteLines(v.param(0, 1))
+	case '@':
+		v.insertChars(v.param(0, 1))
+	case 'P':
+		v.deleteChars(v.param(0, 1))
+	case 'X':
+		n := min(v.param(0, 1), v.cols-v.col)
+		clearCells(v.grid[v.row][v.col : v.col+n])
+	case 'S':
+		v.scrollUp(v.param(0, 1))
+	case 'T':
+		v.scrollDown(v.param(0, 1))
+	case 'r':
+		top := clamp(v.param(0, 1)-1, 0, v.rows-1)
+		bottom := clamp(v.param(1, v.rows)-1, 0, v.rows-1)
+		if top < bottom {
+			v.top, v.bottom = top, bottom
+			v.row, v.col = 0, 0
+		}
+	case 's':
+		v.saveCursor()
+	case 'u':
+		v.restoreCursor()
+	}
+}
+
+// setPrivateMode handles DEC private modes relevant to screen contents
+func (v *vtScreen) setPrivateMode(mode int, on bool) {
+	switch mode {
+	case 1049:
+		if on {
+			v.saveCursor()
+			v.enterAltScreen()
+		} else {
+			v.leaveAltScreen()
+			v.restoreCursor()
+		}
+	case 47, 1047:
+		if on {
+			v.enterAltScreen()
+		} else {
+			v.leaveAltScreen()
+		}
+	}
+}
+
+// enterAltScreen switches to a blank alternate screen
+func (v *vtScreen) enterAltScreen() {
+	if v.alt {
+		return
+	}
+	v.mainGrid = v.grid
+	v.grid = newGrid(v.rows, v.cols)
+	v.alt = true
+}
+
+// leaveAltScreen restores the main screen
+func (v *vtScreen) leaveAltScreen() {
+	if !v.alt {
+		return
+	}
+	v.grid = v.mainGrid
+	v.mainGrid = nil
+	v.alt = false
+}
+
+func (v *vtScreen) saveCursor() {
+	v.savedRow, v.savedCol = v.row, v.col
+}
+
+func (v *vtScreen) restoreCursor() {
+	v.row, v.col = v.savedRow, v.savedCol
+	v.wrapPending = false
+}
+
+// reset performs a full terminal reset (RIS)
+func (v *vtScreen) reset() {
+	v.grid = newGrid(v.rows, v.cols)
+	v.mainGrid = nil
+	v.alt = false
+	v.row, v.col = 0, 0
+	v.savedRow, v.savedCol = 0, 0
+	v.top, v.bottom = 0, v.rows-1
+	v.wrapPending = false
+}
+
+// eraseDisplay implements ED (0: below, 1: above, 2/3: all)
+func (v *vtScreen) eraseDisplay(mode int) {
+	switch mode {
+	case 0:
+		clearCells(v.grid[v.row][v.col:])
+		for i := v.row + 1; i < v.rows; i++ {
+			clearCells(v.grid[i])
+		}
+	case 1:
+		for i := 0; i < v.row; i++ {
+			clearCells(v.grid[i])
+		}
+		clearCells(v.grid[v.row][:v.col+1])
+	case 2, 3:
+		for i := range v.grid {
+			clearCells(v.grid[i])
+		}
+	}
+}
+
+// eraseLine implements EL (0: right, 1: left, 2: whole line)
+func (v *vtScreen) eraseLine(mode int) {
+	line := v.grid[v.row]
+	switch mode {
+	case 0:
+		clearCells(line[v.col:])
+	case 1:
+		clearCells(line[:v.col+1])
+	case 2:
+		clearCells(line)
+	}
+}
+
+// insertLines inserts blank lines at the cursor within the scroll region
+func (v *vtScreen) insertLines(n int) {
+	if v.row < v.top || v.row > v.bottom {
+		return
+	}
+	top := v.top
+	v.top = v.row
+	v.scrollDown(n)
+	v.top = top
+	v.col = 0
+}
+
+// deleteLines deletes lines at the cursor within the scroll region
+func (v *vtScreen) deleteLines(n int) {
+	if v.row < v.top || v.row > v.bottom {
+		return
+	}
+	top := v.top
+	v.top = v.row
+	n = min(n, v.bottom-v.top+1)
+	for i := 0; i < n; i++ {
+		copy(v.grid[v.top:v.bottom], v.grid[v.top+1:v.bottom+1])
+		v.grid[v.bottom] = make([]vtCell, v.cols)
+	}
+	v.top = top
+	v.col = 0
+}
+
+// insertChars shifts the rest of the line right, inserting blanks at the cursor
+func (v *vtScreen) insertChars(n int) {
+	line := v.grid[v.row]
+	n = min(n, v.cols-v.col)
+	copy(line[v.col+n:], line[v.col:])
+	clearCells(line[v.col : v.col+n])
+}
+
+// deleteChars shifts the rest of the line left over the cursor
+func (v *vtScreen) deleteChars(n int) {
+	line := v.grid[v.row]
+	n = min(n, v.cols-v.col)
+	copy(line[v.col:], line[v.col+n:])
+	clearCells(line[v.cols-n:])
+}
+
+// clearCells blanks a slice of cells
+func clearCells(cells []vtCell) {
+	for i := range cells {
+		cells[i] = vtCell{}
+	}
+}
+
+// clamp limits n to [lo, hi]
+func clamp(n, lo, hi int) int {
+	return max(lo, min(n, hi))
+}
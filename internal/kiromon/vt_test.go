@@ -0,0 +1,227 @@
+package kiromon
+
+import (
+	"strings"
+	"testing"
+)
+
+// screenText returns the non-blank visible rows joined by newlines
+func screenText(v *vtScreen) string {
+	lines, _ := v.Snapshot()
+	var out []string
+	for _, l := range lines {
+		if l != "" {
+			out = append(out, l)
+		}
+	}
+	return strings.Join(out, "\n")
+}
+
+func TestVTScreen(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{"plain lines", "hello\r\nworld\r\n", "hello\nworld"},
+		{"colors ignored", "\x1b[1;32mgreen\x1b[0m text", "green text"},
+		{"carriage return overwrite", "Thinking...\rDone       ", "Done"},
+		{"cursor position", "hello\x1b[1;1HJ", "Jello"},
+		{"erase line", "abc\r\x1b[Kxy", "xy"},
+		{"erase display", "one\r\ntwo\x1b[2J\x1b[Hthree", "three"},
+		{"cursor up and overwrite", "a\r\nb\r\n\x1b[2Ax", "x\nb"},
+		{"backspace", "abc\b\bX", "aXc"},
+		{"osc title skipped", "\x1b]0;title\x07prompt", "prompt"},
+		{"osc with st skipped", "\x1b]0;title\x1b\\prompt", "prompt"},
+		{"bracketed paste mode", "\x1b[?2004h> ", ">"},
+		{"insert and delete chars", "abcd\x1b[1G\x1b[2P", "cd"},
+		{"charset designation", "\x1b(Bok", "ok"},
+		{"wrap at margin", strings.Repeat("x", 85), strings.Repeat("x", 80) + "\nxxxxx"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := newVTScreen(DefaultRows, DefaultCols, nil)
+			v.Write([]byte(tt.input))
+			if got := screenText(v); got != tt.expected {
+				t.Errorf("screen = %q, want %q", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestVTScreenSplitSequence(t *testing.T) {
+	v := newVTScreen(DefaultRows, DefaultCols, nil)
+	v.Write([]byte("old\x1b["))
+	v.Write([]byte("2K\rnew"))
+	if got := screenText(v); got != "new" {
+		t.Errorf("screen = %q, want %q", got, "new")
+	}
+}
+
+func TestVTScreenScrollback(t *testing.T) {
+	var scrolled []string
+	v := newVTScreen(3, 20, func(line string) { scrolled = append(scrolled, line) })
+	v.Write([]byte("1\r\n2\r\n3\r\n4\r\n5"))
+
+	if got := screenText(v); got != "3\n4\n5" {
+		t.Errorf("screen = %q, want %q", got, "3\n4\n5")
+	}
+	if strings.Join(scrolled, ",") != "1,2" {
+		t.Errorf("scrolled = %v, want [1 2]", scrolled)
+	}
+}
+
+func TestVTScreenAltScreen(t *testing.T) {
+	var scrolled []string
+	v := newVTScreen(3, 20, func(line string) { scrolled = append(scrolled, line) })
+	v.Write([]byte("main"))
+	v.Write([]byte("\x1b[?1049h\x1b[Halt1\r\nalt2\r\nalt3\r\nalt4"))
+
+	if got := screenText(v); got != "alt2\nalt3\nalt4" {
+		t.Errorf("alt screen = %q", got)
+	}
+	if len(scrolled) != 0 {
+		t.Errorf("alternate screen should not feed scrollback, got %v", scrolled)
+	}
+
+	v.Write([]byte("\x1b[?1049l"))
+	if got := screenText(v); got != "main" {
+		t.Errorf("main screen = %q, want %q", got, "main")
+	}
+}
+
+func TestVTScreenInputBox(t *testing.T) {
+	// A TUI drawing its input box at the bottom rows with absolute positioning
+	v := newVTScreen(10, 40, nil)
+	v.Write([]byte("\x1b[?1049h\x1b[1;1Hanswer text"))
+	v.Write([]byte("\x1b[9;1H\x1b[2K│ ask a question or describe a task"))
+	v.Write([]byte("\x1b[10;1H\x1b[2K> \x1b[10;3H"))
+
+	lines, row := v.Snapshot()
+	if row != 9 {
+		t.Errorf("cursor row = %d, want 9", row)
+	}
+	if lines[8] != "│ ask a question or describe a task" {
+		t.Errorf("row 9 = %q", lines[8])
+	}
+
+	// Redraw replaces the box with a spinner
+	v.Write([]byte("\x1b[9;1H\x1b[J⠋ Thinking..."))
+	lines, _ = v.Snapshot()
+	if lines[9] != "" || !strings.Contains(lines[8], "Thinking...") {
+		t.Errorf("after redraw rows = %q, %q", lines[8], lines[9])
+	}
+}
+
+func TestVTScreenScrollRegion(t *testing.T) {
+	var scrolled []string
+	v := newVTScreen(5, 20, func(line string) { scrolled = append(scrolled, line) })
+	// Status line pinned at the bottom, scrolling region above it
+	v.Write([]byte("\x1b[5;1Hstatus\x1b[1;4r\x1b[1;1H"))
+	v.Write([]byte("a\r\nb\r\nc\r\nd\r\ne"))
+
+	lines, _ := v.Snapshot()
+	if strings.Join(lines, ",") != "b,c,d,e,status" {
+		t.Errorf("rows = %q", lines)
+	}
+	if strings.Join(scrolled, ",") != "a" {
+		t.Errorf("scrolled = %v, want [a]", scrolled)
+	}
+}
+
+func TestVTScreenResize(t *testing.T) {
+	var scrolled []string
+	v := newVTScreen(4, 20, func(line string) { scrolled = append(scrolled, line) })
+	v.Write([]byte("1\r\n2\r\n3\r\n4"))
+	v.Resize(2, 10)
+
+	if got := screenText(v); got != "3\n4" {
+		t.Errorf("screen = %q, want %q", got, "3\n4")
+	}
+	if strings.Join(scrolled, ",") != "1,2" {
+		t.Errorf("scrolled = %v, want [1 2]", scrolled)
+	}
+	if _, row := v.Snapshot(); row != 1 {
+		t.Errorf("cursor row = %d, want 1", row)
+	}
+}
+
+func TestVTScreenUnicode(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{"japanese prompt", "\x1b[1m日本語>\x1b[0m ", "日本語>"},
+		{"emoji", "✅ 完了 🎉", "✅ 完了 🎉"},
+		{"box drawing", "╭─ kiro ─╮", "╭─ kiro ─╮"},
+		{"combining marks", "e\u0301te\u0301", "e\u0301te\u0301"},
+		{"zwj sequence", "👨\u200d💻 dev", "👨\u200d💻 dev"},
+		{"wide cursor movement", "日本\x1b[2D語", "日語"},
+		{"overwrite half of wide char", "日本\rx", "x 本"},
+		{"erase after wide char", "日本語\x1b[3G\x1b[K", "日"},
+		{"invalid bytes dropped", "a\xffb\xc3(c", "ab(c"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := newVTScreen(DefaultRows, DefaultCols, nil)
+			v.Write([]byte(tt.input))
+			if got := screenText(v); got != tt.expected {
+				t.Errorf("screen = %q, want %q", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestVTScreenSplitMultibyte(t *testing.T) {
+	v := newVTScreen(DefaultRows, DefaultCols, nil)
+	data := []byte("タスク完了🎉")
+	// Feed one byte per write, as if every ptmx.Read split a rune
+	for i := range data {
+		v.Write(data[i : i+1])
+	}
+	if got := screenText(v); got != "タスク完了🎉" {
+		t.Errorf("screen = %q, want %q", got, "タスク完了🎉")
+	}
+}
+
+func TestVTScreenWideWrap(t *testing.T) {
+	v := newVTScreen(4, 5, nil)
+	v.Write([]byte("ab日本語"))
+	// 5 columns: "ab日" uses 4, "本" does not fit in the last column
+	if got := screenText(v); got != "ab日\n本語" {
+		t.Errorf("screen = %q, want %q", got, "ab日\n本語")
+	}
+	if _, row := v.Snapshot(); row != 1 {
+		t.Errorf("cursor row = %d, want 1", row)
+	}
+}
+
+func TestRuneWidth(t *testing.T) {
+	tests := []struct {
+		r        rune
+		expected int
+	}{
+		{'a', 1},
+		{'➜', 1},
+		{'│', 1},
+		{'⠋', 1},
+		{'あ', 2},
+		{'漢', 2},
+		{'한', 2},
+		{'Ａ', 2},
+		{'⏳', 2},
+		{'🎉', 2},
+		{'\u0301', 0},
+		{'\u200d', 0},
+		{'\ufe0f', 0},
+	}
+
+	for _, tt := range tests {
+		if got := runeWidth(tt.r); got != tt.expected {
+			t.Errorf("runeWidth(%q) = %d, want %d", tt.r, got, tt.expected)
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package kiromon
+
+import (
+	"bytes"
+	"os"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// dirWatcher reports changes to status files in a directory using inotify
+type dirWatcher struct {
+	file   *os.File
+	Events chan watchEvent
+}
+
+// newDirWatcher starts watching dir for created, rewritten and removed files
+func newDirWatcher(dir string) (*dirWatcher, error) {
+	fd, err := unix.InotifyInit1(unix.IN_CLOEXEC | unix.IN_NONBLOCK)
+	if err != nil {
+		return nil, err
+	}
+	mask := uint32(unix.IN_CREATE | unix.IN_CLOSE_WRITE | unix.IN_MOVED_TO | unix.IN_DELETE | unix.IN_MOVED_FROM)
+	if _, err := unix.InotifyAddWatch(fd, dir, mask); err != nil {
+		unix.Close(fd)
+		return nil, err
+	}
+
+	// A non-blocking descriptor is handled by the runtime poller, so Close
+	// interrupts a pending Read
+	w := &dirWatcher{
+		file:   os.NewFile(uintptr(fd), "inotify"),
+		Events: make(chan watchEvent, 64),
+	}
+	go w.readLoop()
+	return w, nil
+}
+
+// readLoop decodes inotify events until the watcher is closed
+func (w *dirWatcher) readLoop() {
+	defer close(w.Events)
+	buf := make([]byte, 64*(unix.SizeofInotifyEvent+unix.NAME_MAX+1))
+	for {
+		n, err := w.file.Read(buf)
+		if err != nil {
+			return
+		}
+		for offset := 0; offset+unix.SizeofInotifyEvent <= n; {
+			raw := (*unix.InotifyEvent)(unsafe.Pointer(&buf[offset]))
+			nameStart := offset + unix.SizeofInotifyEvent
+			nameEnd := nameStart + int(raw.Len)
+			if nameEnd > n {
+				break
+			}
+			name := string(bytes.TrimRight(buf[nameStart:nameEnd], "\x00"))
+			offset = nameEnd
+
+			switch {
+			case raw.Mask&unix.IN_Q_OVERFLOW != 0:
+				// Events were lost: ask for a full rescan
+				w.Events <- watchEvent{}
+			case raw.Mask&unix.IN_IGNORED != 0:
+				// The directory itself went away
+				return
+			default:
+				w.Events <- watchEvent{
+					Name:    name,
+					Removed: raw.Mask&(unix.IN_DELETE|unix.IN_MOVED_FROM) != 0,
+				}
+			}
+		}
+	}
+}
+
+// Close stops watching
+func (w *dirWatcher) Close() error {
+	return w.file.Close()
+}
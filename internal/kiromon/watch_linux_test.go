@@ -0,0 +1,58 @@
+package kiromon
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// nextWatchEvent waits for the next event about a .json file
+func nextWatchEvent(t *testing.T, w *dirWatcher) watchEvent {
+	t.Helper()
+	timeout := time.After(2 * time.Second)
+	for {
+		select {
+		case ev := <-w.Events:
+			if filepath.Ext(ev.Name) == ".json" {
+				return ev
+			}
+		case <-timeout:
+			t.Fatal("timed out waiting for watch event")
+			return watchEvent{}
+		}
+	}
+}
+
+func TestDirWatcher(t *testing.T) {
+	dir := t.TempDir()
+	w, err := newDirWatcher(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Atomic writes show up under the final name
+	path := filepath.Join(dir, "kiro-cli-42.json")
+	if err := atomicWriteFile(path, []byte(`{"state":"running"}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if ev := nextWatchEvent(t, w); ev.Name != "kiro-cli-42.json" || ev.Removed {
+		t.Errorf("write event = %+v", ev)
+	}
+
+	os.Remove(path)
+	if ev := nextWatchEvent(t, w); ev.Name != "kiro-cli-42.json" || !ev.Removed {
+		t.Errorf("remove event = %+v", ev)
+	}
+
+	// Close ends the event stream
+	w.Close()
+	select {
+	case _, ok := <-w.Events:
+		for ok {
+			_, ok = <-w.Events
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Events not closed after Close")
+	}
+}
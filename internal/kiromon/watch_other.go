@@ -0,0 +1,20 @@
+//go:build !linux
+
+package kiromon
+
+import "errors"
+
+// dirWatcher is unavailable on this platform; the daemon only polls
+type dirWatcher struct {
+	Events chan watchEvent
+}
+
+// newDirWatcher always fails outside Linux
+func newDirWatcher(dir string) (*dirWatcher, error) {
+	return nil, errors.New("directory watching is not supported on this platform")
+}
+
+// Close does nothing
+func (w *dirWatcher) Close() error {
+	return nil
+}
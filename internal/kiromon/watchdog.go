@@ -0,0 +1,158 @@
+package kiromon
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Why the watchdog raised an alert, as written to the status file
+const (
+	StuckMaxTask = "max_task" // the task has been running longer than max_task
+	StuckSilent  = "silent"   // the task has printed nothing for max_silence
+)
+
+// WatchdogConfig raises stuck alerts for tasks that run too long or go silent
+type WatchdogConfig struct {
+	MaxTask    time.Duration `yaml:"max_task"`    // alert when a task runs longer; 0 disables
+	MaxSilence time.Duration `yaml:"max_silence"` // alert when a running task prints nothing for this long; 0 disables
+	Repeat     time.Duration `yaml:"repeat"`      // interval between repeated alerts (default: the threshold that fired)
+	Interrupt  bool          `yaml:"interrupt"`   // send SIGINT to the command on the first alert of a task
+	Message    string        `yaml:"message"`     // message template (default: a description of the alert)
+}
+
+// enabled reports whether c watches anything
+func (c *WatchdogConfig) enabled() bool {
+	return c != nil && (c.MaxTask > 0 || c.MaxSilence > 0)
+}
+
+// withDefaults fills the settings not given on the command line from the preset
+func (c WatchdogConfig) withDefaults(preset *WatchdogConfig) WatchdogConfig {
+	if preset == nil {
+		return c
+	}
+	if c.MaxTask == 0 {
+		c.MaxTask = preset.MaxTask
+	}
+	if c.MaxSilence == 0 {
+		c.MaxSilence = preset.MaxSilence
+	}
+	if c.Repeat == 0 {
+		c.Repeat = preset.Repeat
+	}
+	if !c.Interrupt {
+		c.Interrupt = preset.Interrupt
+	}
+	if c.Message == "" {
+		c.Message = preset.Message
+	}
+	return c
+}
+
+// stuckAlert is one alert raised by the watchdog
+type stuckAlert struct {
+	Reason    string        // StuckMaxTask or StuckSilent
+	Running   time.Duration // how long the task has been running
+	Silent    time.Duration // how long since the last output
+	Count     int           // 1 for the first alert of the task
+	Interrupt bool          // SIGINT should be sent to the command now
+}
+
+// String describes the alert for logs and default messages
+func (a *stuckAlert) String() string {
+	if a.Reason == StuckSilent {
+		return fmt.Sprintf("出力が%s止まっています（実行中 %s）", formatDuration(a.Silent), formatDuration(a.Running))
+	}
+	return fmt.Sprintf("タスクが%s実行中です", formatDuration(a.Running))
+}
+
+// taskWatchdog tracks the running task and decides when to alert
+type taskWatchdog struct {
+	mu          sync.Mutex
+	config      WatchdogConfig
+	taskStart   time.Time // zero while not running
+	lastOutput  time.Time
+	lastAlert   time.Time
+	alerts      int
+	reason      string // reason of the last alert of the running task
+	interrupted bool
+}
+
+// newTaskWatchdog creates a watchdog, or returns nil when c watches nothing.
+// The methods of a nil watchdog do nothing.
+func newTaskWatchdog(c *WatchdogConfig) *taskWatchdog {
+	if !c.enabled() {
+		return nil
+	}
+	return &taskWatchdog{config: *c}
+}
+
+// Output records that the command printed something
+func (w *taskWatchdog) Output(at time.Time) {
+	if w == nil {
+		return
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.lastOutput = at
+}
+
+// Check is called on every status tick and returns an alert when the
+// running task is over a threshold and no alert was raised within the
+// repeat interval. Any other state ends the task.
+func (w *taskWatchdog) Check(state string, now time.Time) *stuckAlert {
+	if w == nil {
+		return nil
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if state != StateRunning {
+		w.taskStart, w.lastAlert, w.alerts, w.reason, w.interrupted = time.Time{}, time.Time{}, 0, "", false
+		return nil
+	}
+	if w.taskStart.IsZero() {
+		w.taskStart = now
+	}
+	silentSince := w.lastOutput
+	if silentSince.Before(w.taskStart) {
+		silentSince = w.taskStart
+	}
+	alert := &stuckAlert{Running: now.Sub(w.taskStart), Silent: now.Sub(silentSince)}
+
+	var threshold time.Duration
+	switch {
+	case w.config.MaxSilence > 0 && alert.Silent >= w.config.MaxSilence:
+		alert.Reason, threshold = StuckSilent, w.config.MaxSilence
+	case w.config.MaxTask > 0 && alert.Running >= w.config.MaxTask:
+		alert.Reason, threshold = StuckMaxTask, w.config.MaxTask
+	default:
+		return nil
+	}
+	repeat := w.config.Repeat
+	if repeat <= 0 {
+		repeat = threshold
+	}
+	if w.alerts > 0 && now.Sub(w.lastAlert) < repeat {
+		return nil
+	}
+
+	w.alerts++
+	w.lastAlert = now
+	w.reason = alert.Reason
+	alert.Count = w.alerts
+	if w.config.Interrupt && !w.interrupted {
+		alert.Interrupt = true
+		w.interrupted = true
+	}
+	return alert
+}
+
+// Stuck returns the reason of the last alert while the task is still running
+func (w *taskWatchdog) Stuck() string {
+	if w == nil {
+		return ""
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.reason
+}
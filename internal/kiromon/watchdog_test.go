@@ -0,0 +1,76 @@
+package kiromon
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTaskWatchdog(t *testing.T) {
+	w := newTaskWatchdog(&WatchdogConfig{MaxTask: 10 * time.Minute, Repeat: 5 * time.Minute, Interrupt: true})
+	start := time.Now()
+
+	w.Check(StateRunning, start)
+	w.Output(start.Add(9 * time.Minute))
+	if a := w.Check(StateRunning, start.Add(9*time.Minute)); a != nil {
+		t.Errorf("alert before max_task: %+v", a)
+	}
+	a := w.Check(StateRunning, start.Add(10*time.Minute))
+	if a == nil || a.Reason != StuckMaxTask || a.Count != 1 || !a.Interrupt || w.Stuck() != StuckMaxTask {
+		t.Fatalf("first alert = %+v", a)
+	}
+	// Repeats wait for the interval, and SIGINT is only sent once per task
+	if a := w.Check(StateRunning, start.Add(12*time.Minute)); a != nil {
+		t.Errorf("alert within the repeat interval: %+v", a)
+	}
+	if a := w.Check(StateRunning, start.Add(15*time.Minute)); a == nil || a.Count != 2 || a.Interrupt {
+		t.Errorf("repeated alert = %+v", a)
+	}
+
+	// Waiting ends the task
+	w.Check(StateWaiting, start.Add(16*time.Minute))
+	if w.Stuck() != "" {
+		t.Errorf("Stuck() after the task = %q", w.Stuck())
+	}
+	if a := w.Check(StateRunning, start.Add(17*time.Minute)); a != nil {
+		t.Errorf("alert at the start of a task: %+v", a)
+	}
+
+	if newTaskWatchdog(&WatchdogConfig{Interrupt: true}) != nil {
+		t.Error("watchdog without thresholds enabled")
+	}
+	var none *taskWatchdog
+	if none.Check(StateRunning, start) != nil || none.Stuck() != "" {
+		t.Error("nil watchdog raised an alert")
+	}
+}
+
+func TestTaskWatchdogSilence(t *testing.T) {
+	w := newTaskWatchdog(&WatchdogConfig{MaxSilence: 2 * time.Minute})
+	start := time.Now()
+
+	w.Check(StateRunning, start)
+	w.Output(start.Add(time.Minute))
+	if a := w.Check(StateRunning, start.Add(2*time.Minute)); a != nil {
+		t.Errorf("alert with recent output: %+v", a)
+	}
+	a := w.Check(StateRunning, start.Add(3*time.Minute))
+	if a == nil || a.Reason != StuckSilent || a.Silent != 2*time.Minute || a.Running != 3*time.Minute {
+		t.Fatalf("silence alert = %+v", a)
+	}
+	// Without repeat, the threshold is the interval
+	if a := w.Check(StateRunning, start.Add(4*time.Minute)); a != nil {
+		t.Errorf("alert within the repeat interval: %+v", a)
+	}
+	if a := w.Check(StateRunning, start.Add(5*time.Minute)); a == nil || a.Count != 2 {
+		t.Errorf("repeated alert = %+v", a)
+	}
+}
+
+func TestWatchdogWithDefaults(t *testing.T) {
+	preset := &WatchdogConfig{MaxTask: time.Hour, MaxSilence: 5 * time.Minute, Message: "stuck"}
+	got := WatchdogConfig{MaxTask: 15 * time.Minute, Interrupt: true}.withDefaults(preset)
+	want := WatchdogConfig{MaxTask: 15 * time.Minute, MaxSilence: 5 * time.Minute, Interrupt: true, Message: "stuck"}
+	if got != want {
+		t.Errorf("withDefaults() = %+v, want %+v", got, want)
+	}
+}
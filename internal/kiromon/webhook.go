@@ -0,0 +1,190 @@
+package kiromon
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Webhook payload formats
+const (
+	WebhookJSON  = "json"  // generic JSON document describing the event
+	WebhookSlack = "slack" // Slack-compatible {"text": ...}
+	WebhookNtfy  = "ntfy"  // ntfy-style plain text body with a Title header
+)
+
+// Default webhook settings
+const (
+	DefaultWebhookTimeout = 10 * time.Second
+	DefaultWebhookRetries = 2
+)
+
+// webhookBackoff is the delay before the first retry; it doubles on each attempt
+var webhookBackoff = 1 * time.Second
+
+// WebhookConfig configures the built-in HTTP POST notifier
+type WebhookConfig struct {
+	URL         string            `yaml:"url"`
+	Format      string            `yaml:"format"`       // json (default), slack or ntfy
+	Body        string            `yaml:"body"`         // body template, overrides format
+	ContentType string            `yaml:"content_type"` // for body templates (default: application/json)
+	Headers     map[string]string `yaml:"headers"`
+	Timeout     time.Duration     `yaml:"timeout"`
+	Retries     *int              `yaml:"retries"` // retries after the first attempt
+}
+
+// webhookPayload is the document sent by the json format
+type webhookPayload struct {
+	Event           string    `json:"event,omitempty"`
+	State           string    `json:"state"`
+	PID             int       `json:"pid"`
+	Command         string    `json:"command"`
+	Message         string    `json:"message"`
+	LastLine        string    `json:"last_line"`
+	Time            time.Time `json:"time"`
+	TaskStart       time.Time `json:"task_start,omitempty"`
+	DurationSeconds float64   `json:"duration_seconds"`
+	ExitCode        *int      `json:"exit_code,omitempty"`
+	Signal          string    `json:"signal,omitempty"`
+	Transcript      string    `json:"transcript,omitempty"`
+	PrevState       string    `json:"prev_state,omitempty"`
+	ErrorLine       string    `json:"error_line,omitempty"`
+}
+
+// validate checks the webhook settings
+func (w *WebhookConfig) validate() error {
+	if w.URL == "" {
+		return fmt.Errorf("webhook url is required")
+	}
+	if !strings.HasPrefix(w.URL, "http://") && !strings.HasPrefix(w.URL, "https://") {
+		return fmt.Errorf("webhook url must be http or https: %s", w.URL)
+	}
+	switch w.Format {
+	case "", WebhookJSON, WebhookSlack, WebhookNtfy:
+	default:
+		return fmt.Errorf("unknown webhook format %q (want %s, %s or %s)", w.Format, WebhookJSON, WebhookSlack, WebhookNtfy)
+	}
+	return nil
+}
+
+// buildRequestBody renders the body and content type for an event
+func (w *WebhookConfig) buildRequestBody(ev NotifyEvent) ([]byte, string, error) {
+	if w.Body != "" {
+		contentType := w.ContentType
+		if contentType == "" {
+			contentType = "application/json"
+		}
+		// Escape values so they can be placed inside JSON strings
+		if strings.Contains(contentType, "json") {
+			ev = ev.jsonEscaped()
+		}
+		return []byte(ev.expand(w.Body)), contentType, nil
+	}
+
+	switch w.Format {
+	case WebhookSlack:
+		data, err := json.Marshal(map[string]string{"text": ev.Message})
+		return data, "application/json", err
+	case WebhookNtfy:
+		return []byte(ev.Message), "text/plain; charset=utf-8", nil
+	default:
+		data, err := json.Marshal(webhookPayload{
+			Event:           ev.Event,
+			State:           ev.State,
+			PID:             ev.PID,
+			Command:         ev.Command,
+			Message:         ev.Message,
+			LastLine:        ev.LastLine,
+			Time:            ev.Time,
+			TaskStart:       ev.TaskStart,
+			DurationSeconds: ev.Duration().Seconds(),
+			ExitCode:        ev.ExitCode,
+			Signal:          ev.Signal,
+			Transcript:      ev.Transcript,
+			PrevState:       ev.PrevState,
+			ErrorLine:       ev.ErrorLine,
+		})
+		return data, "application/json", err
+	}
+}
+
+// jsonEscaped returns a copy of the event with every string field that
+// expand substitutes escaped for JSON
+func (e NotifyEvent) jsonEscaped() NotifyEvent {
+	escape := func(s string) string {
+		data, _ := json.Marshal(s)
+		return string(data[1 : len(data)-1])
+	}
+	for _, s := range []*string{&e.Message, &e.Event, &e.State, &e.PrevState, &e.Command, &e.LastLine, &e.Signal, &e.Transcript, &e.ErrorLine} {
+		*s = escape(*s)
+	}
+	return e
+}
+
+// sendWebhook POSTs an event, retrying on network errors, 429 and 5xx responses
+func sendWebhook(w *WebhookConfig, ev NotifyEvent) error {
+	if err := w.validate(); err != nil {
+		return err
+	}
+	body, contentType, err := w.buildRequestBody(ev)
+	if err != nil {
+		return err
+	}
+
+	timeout := w.Timeout
+	if timeout <= 0 {
+		timeout = DefaultWebhookTimeout
+	}
+	retries := DefaultWebhookRetries
+	if w.Retries != nil {
+		retries = *w.Retries
+	}
+	client := &http.Client{Timeout: timeout}
+
+	backoff := webhookBackoff
+	for attempt := 0; ; attempt++ {
+		retryable, err := postWebhook(client, w, ev, body, contentType)
+		if err == nil {
+			return nil
+		}
+		if !retryable || attempt >= retries {
+			return fmt.Errorf("webhook %s: %w", w.URL, err)
+		}
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+// postWebhook makes a single attempt and reports whether a failure is worth retrying
+func postWebhook(client *http.Client, w *WebhookConfig, ev NotifyEvent, body []byte, contentType string) (bool, error) {
+	req, err := http.NewRequest(http.MethodPost, w.URL, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("User-Agent", "kiromon")
+	if w.Format == WebhookNtfy && w.Body == "" {
+		req.Header.Set("Title", fmt.Sprintf("kiromon: %s %s", ev.Command, ev.State))
+		req.Header.Set("Tags", ev.State)
+	}
+	for k, v := range w.Headers {
+		req.Header.Set(k, ev.expand(v))
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return false, nil
+	}
+	retryable := resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+	return retryable, fmt.Errorf("unexpected status %s", resp.Status)
+}
@@ -0,0 +1,216 @@
+package kiromon
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// testEvent returns a fixed event for webhook tests
+func testEvent() NotifyEvent {
+	now := time.Date(2024, 1, 1, 14, 30, 0, 0, time.UTC)
+	return NotifyEvent{
+		State:     StateWaiting,
+		PID:       4242,
+		Command:   "kiro-cli chat",
+		Message:   `完了 "quoted"`,
+		LastLine:  "> ",
+		TaskStart: now.Add(-time.Minute),
+		Time:      now,
+	}
+}
+
+// captureServer records the last request body and headers
+func captureServer(t *testing.T, status int) (*httptest.Server, *http.Request, *[]byte) {
+	t.Helper()
+	var lastReq http.Request
+	var lastBody []byte
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lastReq = *r
+		lastBody, _ = io.ReadAll(r.Body)
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &lastReq, &lastBody
+}
+
+func TestSendWebhookFormats(t *testing.T) {
+	t.Run("json", func(t *testing.T) {
+		srv, req, body := captureServer(t, http.StatusOK)
+		if err := sendWebhook(&WebhookConfig{URL: srv.URL}, testEvent()); err != nil {
+			t.Fatalf("sendWebhook() error = %v", err)
+		}
+		var payload webhookPayload
+		if err := json.Unmarshal(*body, &payload); err != nil {
+			t.Fatalf("invalid JSON body %q: %v", *body, err)
+		}
+		if payload.State != StateWaiting || payload.PID != 4242 || payload.DurationSeconds != 60 {
+			t.Errorf("payload = %+v", payload)
+		}
+		if ct := req.Header.Get("Content-Type"); ct != "application/json" {
+			t.Errorf("Content-Type = %q", ct)
+		}
+	})
+
+	t.Run("slack", func(t *testing.T) {
+		srv, _, body := captureServer(t, http.StatusOK)
+		if err := sendWebhook(&WebhookConfig{URL: srv.URL, Format: WebhookSlack}, testEvent()); err != nil {
+			t.Fatalf("sendWebhook() error = %v", err)
+		}
+		var payload map[string]string
+		json.Unmarshal(*body, &payload)
+		if payload["text"] != `完了 "quoted"` {
+			t.Errorf("text = %q", payload["text"])
+		}
+	})
+
+	t.Run("ntfy", func(t *testing.T) {
+		srv, req, body := captureServer(t, http.StatusOK)
+		if err := sendWebhook(&WebhookConfig{URL: srv.URL, Format: WebhookNtfy}, testEvent()); err != nil {
+			t.Fatalf("sendWebhook() error = %v", err)
+		}
+		if string(*body) != `完了 "quoted"` {
+			t.Errorf("body = %q", *body)
+		}
+		if title := req.Header.Get("Title"); title != "kiromon: kiro-cli chat waiting" {
+			t.Errorf("Title = %q", title)
+		}
+	})
+
+	t.Run("body template", func(t *testing.T) {
+		srv, req, body := captureServer(t, http.StatusOK)
+		w := &WebhookConfig{
+			URL:     srv.URL,
+			Body:    `{"msg":"{message}","who":"{pid}"}`,
+			Headers: map[string]string{"X-State": "{state}"},
+		}
+		if err := sendWebhook(w, testEvent()); err != nil {
+			t.Fatalf("sendWebhook() error = %v", err)
+		}
+		var payload map[string]string
+		if err := json.Unmarshal(*body, &payload); err != nil {
+			t.Fatalf("template produced invalid JSON %q: %v", *body, err)
+		}
+		if payload["msg"] != `完了 "quoted"` || payload["who"] != "4242" {
+			t.Errorf("payload = %v", payload)
+		}
+		if got := req.Header.Get("X-State"); got != StateWaiting {
+			t.Errorf("X-State = %q", got)
+		}
+	})
+
+	t.Run("body template escapes every field", func(t *testing.T) {
+		srv, _, body := captureServer(t, http.StatusOK)
+		ev := testEvent()
+		ev.Transcript = `C:\logs\"task".log`
+		ev.Signal = `"SIGINT"`
+		ev.State = `custom "state"`
+		ev.PrevState = `back\slash`
+		w := &WebhookConfig{URL: srv.URL, Body: `{"t":"{transcript}","s":"{signal}","st":"{state}","p":"{prev_state}"}`}
+		if err := sendWebhook(w, ev); err != nil {
+			t.Fatalf("sendWebhook() error = %v", err)
+		}
+		var payload map[string]string
+		if err := json.Unmarshal(*body, &payload); err != nil {
+			t.Fatalf("template produced invalid JSON %q: %v", *body, err)
+		}
+		if payload["t"] != ev.Transcript || payload["s"] != ev.Signal || payload["st"] != ev.State || payload["p"] != ev.PrevState {
+			t.Errorf("payload = %v", payload)
+		}
+	})
+}
+
+func TestSendWebhookRetries(t *testing.T) {
+	webhookBackoff = time.Millisecond
+	defer func() { webhookBackoff = time.Second }()
+
+	t.Run("retries server errors", func(t *testing.T) {
+		var calls int32
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if atomic.AddInt32(&calls, 1) < 3 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+		}))
+		defer srv.Close()
+
+		if err := sendWebhook(&WebhookConfig{URL: srv.URL}, testEvent()); err != nil {
+			t.Fatalf("sendWebhook() error = %v", err)
+		}
+		if calls != 3 {
+			t.Errorf("calls = %d, want 3", calls)
+		}
+	})
+
+	t.Run("gives up after retries", func(t *testing.T) {
+		var calls int32
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&calls, 1)
+			w.WriteHeader(http.StatusInternalServerError)
+		}))
+		defer srv.Close()
+
+		retries := 1
+		if err := sendWebhook(&WebhookConfig{URL: srv.URL, Retries: &retries}, testEvent()); err == nil {
+			t.Error("expected error after retries are exhausted")
+		}
+		if calls != 2 {
+			t.Errorf("calls = %d, want 2", calls)
+		}
+	})
+
+	t.Run("client errors are not retried", func(t *testing.T) {
+		var calls int32
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&calls, 1)
+			w.WriteHeader(http.StatusBadRequest)
+		}))
+		defer srv.Close()
+
+		if err := sendWebhook(&WebhookConfig{URL: srv.URL}, testEvent()); err == nil {
+			t.Error("expected error for 400 response")
+		}
+		if calls != 1 {
+			t.Errorf("calls = %d, want 1", calls)
+		}
+	})
+
+	t.Run("timeout", func(t *testing.T) {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			time.Sleep(200 * time.Millisecond)
+		}))
+		defer srv.Close()
+
+		retries := 0
+		w := &WebhookConfig{URL: srv.URL, Timeout: 20 * time.Millisecond, Retries: &retries}
+		if err := sendWebhook(w, testEvent()); err == nil {
+			t.Error("expected timeout error")
+		}
+	})
+}
+
+func TestWebhookValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  WebhookConfig
+		wantErr bool
+	}{
+		{"valid", WebhookConfig{URL: "https://example.com/hook"}, false},
+		{"missing url", WebhookConfig{}, true},
+		{"bad scheme", WebhookConfig{URL: "ftp://example.com"}, true},
+		{"bad format", WebhookConfig{URL: "http://example.com", Format: "xml"}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.config.validate(); (err != nil) != tt.wantErr {
+				t.Errorf("validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -14,12 +14,19 @@ import (
 	"time"
 
 	"github.com/creack/pty"
+	"golang.org/x/sys/unix"
 	"golang.org/x/term"
 )
 
+// outputDrainTimeout bounds the wait for the command's final output after it exits
+const outputDrainTimeout = 500 * time.Millisecond
+
 // exitCode stores the exit code to return after cleanup
 var exitCode int
 
+// exitSignal names the signal that killed the command, if any
+var exitSignal string
+
 // Wrapper state variables
 var (
 	statusFile       string
@@ -27,32 +34,105 @@ var (
 	bufferMu         sync.RWMutex
 	lastActivity     time.Time
 	activityMu       sync.RWMutex
-	currentLine      string
-	currentLineMu    sync.RWMutex
+	terminal         *vtScreen
 	lastStdinInput   time.Time
 	stdinMu          sync.RWMutex
-	lastPromptSeen   time.Time
-	promptSeenMu     sync.RWMutex
 	processStartTime time.Time
+	promptRules      = defaultPromptRules()
+	eventStream      *eventServer
+	publishedState   string
+	publishedShown   string
+	publishedStuck   string
+	publishMu        sync.Mutex
+	statusInfo       wrapperInfo
+	statusMu         sync.Mutex
+	statusState      string
+	stateChangedAt   time.Time
+	taskCount        int
+	taskStartTime    time.Time
+	taskHistory      *taskTracker
+	transcript       *transcriptRecorder
+	recording        *asciicastRecorder
+	attachServer     *ptyServer
+	taskQueue        *promptQueue
+	responder        *autoResponder
+	classifier       *stateClassifier
+	statusSubstate   string
+	statusStateIcon  string
+	errorWatch       *errorScanner
+	statusTaskError  string
+	watchdog         *taskWatchdog
 )
 
+// wrapperInfo holds status fields that do not change while the wrapper runs
+type wrapperInfo struct {
+	Cwd      string
+	Hostname string
+	TTY      string
+	Version  string
+}
+
+// currentWrapperInfo collects where and by which build the wrapper is running
+func currentWrapperInfo() wrapperInfo {
+	info := wrapperInfo{Version: kiromonVersion()}
+	info.Cwd, _ = os.Getwd()
+	info.Hostname, _ = os.Hostname()
+	if term.IsTerminal(int(os.Stdin.Fd())) {
+		// Only Linux exposes the terminal name this way; elsewhere it stays empty
+		if tty, err := os.Readlink("/proc/self/fd/0"); err == nil {
+			info.TTY = tty
+		}
+	}
+	return info
+}
+
 // runWrapper runs a command with PTY and monitors its state
 func runWrapper(args []string, standalone *StandaloneConfig) {
 	// Determine process name from command
 	name := filepath.Base(args[0])
 
+	// Apply detection rules from the preset, if any
+	preset := getPreset(name)
+	promptRules = defaultPromptRules()
+	if preset != nil {
+		rules, err := preset.promptRules()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: preset %s: %v (using defaults)\n", name, err)
+		} else {
+			promptRules = rules
+		}
+	}
+
+	// Select the state detector for this command
+	var detectorName string
+	var idleThreshold time.Duration
+	if preset != nil {
+		detectorName = preset.Detector
+		idleThreshold = preset.IdleThreshold
+	}
+	detector, err := newDetector(detectorName, promptRules, idleThreshold)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: preset %s: %v (using %s)\n", name, err, DetectorHeuristic)
+		detector, _ = newDetector(DetectorHeuristic, promptRules, idleThreshold)
+	}
+
 	// Apply preset from config if standalone is nil (bare wrapper mode)
 	if standalone == nil {
-		if preset := getPreset(name); preset != nil {
-			if preset.Command != "" || preset.StartMsg != "" || preset.EndMsg != "" {
+		if preset != nil {
+			if len(preset.Command) > 0 || preset.Webhook != nil || len(preset.Notifiers) > 0 || preset.StartMsg != "" || preset.EndMsg != "" || preset.ExitMsg != "" || preset.ErrMsg != "" || preset.Watchdog != nil || preset.Reminder != nil {
 				standalone = &StandaloneConfig{
 					Command:  preset.Command,
 					StartMsg: preset.StartMsg,
 					EndMsg:   preset.EndMsg,
+					ExitMsg:  preset.ExitMsg,
+					ErrMsg:   preset.ErrMsg,
+					Watchdog: preset.Watchdog,
+					Reminder: preset.Reminder,
+					Webhook:  preset.Webhook,
 				}
 				// Apply default_command if preset has no command
-				if standalone.Command == "" {
-					if config := loadConfig(); config != nil && config.DefaultCommand != "" {
+				if len(standalone.Command) == 0 {
+					if config := loadConfig(); config != nil && len(config.DefaultCommand) > 0 {
 						standalone.Command = config.DefaultCommand
 					}
 				}
@@ -64,6 +144,49 @@ func runWrapper(args []string, standalone *StandaloneConfig) {
 		}
 	}
 
+	// Build notification sinks from the command, webhook and preset notifiers
+	var notifyLog logFunc
+	if standalone != nil {
+		notifyLog = func(format string, args ...interface{}) {
+			logToFile(standalone, format, args...)
+		}
+		var notifiers []SinkConfig
+		if preset != nil {
+			notifiers = preset.Notifiers
+		}
+		events := failedSinkEvents(exitSinkEvents(standalone.ExitMsg), standalone.ErrMsg)
+		if standalone.Watchdog.enabled() {
+			events = addSinkEvent(events, EventStuck)
+		}
+		if standalone.Reminder.enabled() {
+			events = addSinkEvent(events, EventRemind)
+		}
+		sinks, err := buildSinks(standalone.Command, standalone.Webhook, events, notifiers, notifyLog)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		standalone.Sinks = sinks
+	}
+
+	// Open the session recording before starting so a bad path fails early
+	recording = nil
+	if recordOptions.Path != "" {
+		cols, rows := DefaultCols, DefaultRows
+		if term.IsTerminal(int(os.Stdin.Fd())) {
+			if c, r, err := term.GetSize(int(os.Stdin.Fd())); err == nil && c > 0 && r > 0 {
+				cols, rows = c, r
+			}
+		}
+		rec, err := newAsciicastRecorder(recordOptions.Path, cols, rows, strings.Join(args, " "), recordOptions.Input)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error opening recording: %v\n", err)
+			os.Exit(1)
+		}
+		recording = rec
+		defer recording.Close()
+	}
+
 	// Create command
 	cmd := exec.Command(args[0], args[1:]...)
 
@@ -78,11 +201,23 @@ func runWrapper(args []string, standalone *StandaloneConfig) {
 	// Set status file with PID for unique identification
 	statusFile = getStatusFileWithPID(name, cmd.Process.Pid)
 
+	// Stream state changes to daemons over a socket next to the status file
+	if server, err := newEventServer(getSocketPath(statusFile)); err == nil {
+		eventStream = server
+	} else {
+		fmt.Fprintf(os.Stderr, "Warning: event socket unavailable: %v\n", err)
+	}
+
+	// Virtual terminal mirroring what the child has drawn on screen;
+	// lines scrolled off its top are kept in the screen buffer
+	terminal = newVTScreen(DefaultRows, DefaultCols, addLine)
+
 	// Handle window size
 	if term.IsTerminal(int(os.Stdin.Fd())) {
 		// Set initial size
 		if cols, rows, err := term.GetSize(int(os.Stdin.Fd())); err == nil {
 			pty.Setsize(ptmx, &pty.Winsize{Rows: uint16(rows), Cols: uint16(cols)})
+			terminal.Resize(rows, cols)
 		}
 
 		// Handle resize
@@ -92,6 +227,10 @@ func runWrapper(args []string, standalone *StandaloneConfig) {
 			for range ch {
 				if cols, rows, err := term.GetSize(int(os.Stdin.Fd())); err == nil {
 					pty.Setsize(ptmx, &pty.Winsize{Rows: uint16(rows), Cols: uint16(cols)})
+					terminal.Resize(rows, cols)
+					if recording != nil {
+						recording.Resize(cols, rows)
+					}
 				}
 			}
 		}()
@@ -105,10 +244,113 @@ func runWrapper(args []string, standalone *StandaloneConfig) {
 		}
 	}
 
+	// Prompts typed by the wrapper whenever the command starts waiting
+	var queueConfig *QueueConfig
+	if preset != nil {
+		queueConfig = preset.Queue
+	}
+	queue, err := newPromptQueue(queueConfig)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: preset %s: %v\n", name, err)
+		queue, _ = newPromptQueue(nil)
+	}
+
+	// Named states declared on top of running and waiting
+	var stateConfigs []StateConfig
+	if preset != nil {
+		stateConfigs = preset.States
+	}
+	states, err := newStateClassifier(stateConfigs)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: preset %s: %v (declared states disabled)\n", name, err)
+		states, _ = newStateClassifier(nil)
+	}
+
+	// Output lines that mark a task as failed
+	var errorPatterns []string
+	if preset != nil {
+		errorPatterns = preset.ErrorPatterns
+	}
+	failures, err := newErrorScanner(errorPatterns)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: preset %s: %v (using default error patterns)\n", name, err)
+		failures, _ = newErrorScanner(nil)
+	}
+
+	// Alerts for tasks that run too long or stop printing
+	var watchdogConfig *WatchdogConfig
+	if standalone != nil {
+		watchdogConfig = standalone.Watchdog
+	} else if preset != nil {
+		watchdogConfig = preset.Watchdog
+	}
+	stuck := newTaskWatchdog(watchdogConfig)
+
+	// Reminders while the command keeps waiting for input
+	var remind *waitReminder
+	if standalone != nil {
+		remind = newWaitReminder(standalone.Reminder)
+	}
+
+	// Answers to recurring confirmation prompts
+	var autoRules []AutoRespondRule
+	var approvalPattern string
+	if preset != nil {
+		autoRules, approvalPattern = preset.AutoRespond, preset.ApprovalPattern
+	}
+	answers, err := newAutoResponder(autoRules, approvalPattern)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: preset %s: %v (auto-respond disabled)\n", name, err)
+		answers, _ = newAutoResponder(nil, "")
+	}
+
+	// Automatic responses and watchdog alerts are always logged, to syslog
+	// when there is no notification log
+	actionLog := notifyLog
+	if actionLog == nil && (len(answers.rules) > 0 || stuck != nil) {
+		if sw, err := syslog.New(syslog.LOG_INFO|syslog.LOG_USER, "kiromon"); err == nil {
+			defer sw.Close()
+			actionLog = func(format string, args ...interface{}) {
+				sw.Info(fmt.Sprintf(format, args...))
+			}
+		}
+	}
+
 	// Initialize status
 	lastActivity = time.Now()
 	processStartTime = time.Now()
-	updateStatus(StateRunning, strings.Join(args, " "), cmd.Process.Pid, "", false)
+	statusInfo = currentWrapperInfo()
+	statusMu.Lock()
+	statusState, stateChangedAt, taskCount, taskStartTime = "", processStartTime, 0, processStartTime
+	taskHistory = nil
+	transcript = nil
+	taskQueue = queue
+	responder = answers
+	classifier = states
+	statusSubstate, statusStateIcon = "", ""
+	errorWatch = failures
+	statusTaskError = ""
+	watchdog = stuck
+	if preset != nil && preset.Transcript != nil && preset.Transcript.Enabled {
+		if rec, err := newTranscriptRecorder(preset.Transcript, name, cmd.Process.Pid); err == nil {
+			transcript = rec
+		} else {
+			fmt.Fprintf(os.Stderr, "Warning: transcript disabled: %v\n", err)
+		}
+	}
+	if historyEnabled() {
+		taskHistory = &taskTracker{
+			path:       getHistoryPath(),
+			command:    strings.Join(args, " "),
+			pid:        cmd.Process.Pid,
+			cwd:        statusInfo.Cwd,
+			hostname:   statusInfo.Hostname,
+			transcript: transcript,
+			logf:       notifyLog,
+		}
+	}
+	statusMu.Unlock()
+	updateStatus(StateRunning, strings.Join(args, " "), cmd.Process.Pid, "", false, "started")
 
 	// Handle signals
 	sigCh := make(chan os.Signal, 1)
@@ -119,7 +361,54 @@ func runWrapper(args []string, standalone *StandaloneConfig) {
 		}
 	}()
 
-	// Copy stdin to pty (with activity tracking)
+	// sendInput writes keystrokes to the pty (with activity tracking)
+	sendInput := func(p []byte) error {
+		activityMu.Lock()
+		lastActivity = time.Now()
+		activityMu.Unlock()
+		stdinMu.Lock()
+		lastStdinInput = time.Now()
+		stdinMu.Unlock()
+		detector.Input(time.Now())
+		if recording != nil {
+			recording.Input(p)
+		}
+		_, err := ptmx.Write(p)
+		return err
+	}
+
+	// Share the terminal with kiromon attach, send and queue
+	attachServer = nil
+	if server, err := newPTYServer(getAttachSocketPath(statusFile), terminal, sendInput, currentState, taskQueue); err == nil {
+		attachServer = server
+	} else {
+		fmt.Fprintf(os.Stderr, "Warning: attach socket unavailable: %v\n", err)
+	}
+
+	// typeInput types pieces a pause apart without holding up the status
+	// ticker. Through the attach server the pieces are not interleaved with
+	// those of kiromon send.
+	var typeMu sync.Mutex
+	typeInput := func(pieces []string) {
+		go func() {
+			if attachServer != nil {
+				attachServer.send(attachRequest{Input: pieces})
+				return
+			}
+			typeMu.Lock()
+			defer typeMu.Unlock()
+			for i, piece := range pieces {
+				if i > 0 {
+					time.Sleep(sendPieceDelay)
+				}
+				if sendInput([]byte(piece)) != nil {
+					return
+				}
+			}
+		}()
+	}
+
+	// Copy stdin to pty
 	go func() {
 		buf := make([]byte, 1024)
 		for {
@@ -128,25 +417,18 @@ func runWrapper(args []string, standalone *StandaloneConfig) {
 				return
 			}
 			if n > 0 {
-				activityMu.Lock()
-				lastActivity = time.Now()
-				activityMu.Unlock()
-				stdinMu.Lock()
-				lastStdinInput = time.Now()
-				stdinMu.Unlock()
-				if _, err := ptmx.Write(buf[:n]); err != nil {
+				if err := sendInput(buf[:n]); err != nil {
 					return // PTY closed
 				}
 			}
 		}
 	}()
 
-	// Copy pty to stdout (with buffering and activity tracking)
+	// Copy pty to stdout (with screen tracking and activity tracking)
+	outputDone := make(chan struct{})
 	go func() {
+		defer close(outputDone)
 		buf := make([]byte, 4096)
-		lineBuf := strings.Builder{}
-		pendingCR := false
-
 		for {
 			n, err := ptmx.Read(buf)
 			if err != nil {
@@ -156,61 +438,28 @@ func runWrapper(args []string, standalone *StandaloneConfig) {
 			if _, err := os.Stdout.Write(buf[:n]); err != nil {
 				return // stdout closed
 			}
+			if recording != nil {
+				recording.Output(buf[:n])
+			}
 
 			activityMu.Lock()
 			lastActivity = time.Now()
 			activityMu.Unlock()
 
-			// Skip currentLine update if stdin input was recent (echo suppression)
-			stdinMu.RLock()
-			stdinRecent := !lastStdinInput.IsZero() && time.Since(lastStdinInput) < 500*time.Millisecond
-			stdinMu.RUnlock()
-			if stdinRecent {
-				continue
-			}
-
-			// Process for line buffer (strip ANSI for storage)
-			for i := 0; i < n; i++ {
-				b := buf[i]
-				if b == '\n' {
-					line := lineBuf.String()
-					if line != "" {
-						addLine(line)
-					}
-					lineBuf.Reset()
-					pendingCR = false
-				} else if b == '\r' {
-					// Save current line but defer reset until we see next char
-					stripped := stripAnsi(lineBuf.String())
-					if stripped != "" {
-						currentLineMu.Lock()
-						currentLine = stripped
-						currentLineMu.Unlock()
-						notePromptMarker(stripped)
-					}
-					pendingCR = true
-				} else {
-					if pendingCR {
-						// \r not followed by \n: standalone CR, reset buffer
-						lineBuf.Reset()
-						pendingCR = false
-					}
-					lineBuf.WriteByte(b)
-				}
-			}
-
-			// Always update current line after processing buffer
-			if pendingCR {
-				// CR was the last thing received; currentLine already set in CR handler
+			// The attach server writes to the virtual terminal itself so
+			// clients attaching meanwhile neither miss nor repeat output
+			if attachServer != nil {
+				attachServer.Publish(buf[:n])
 			} else {
-				stripped := stripAnsi(lineBuf.String())
-				if stripped != "" {
-					currentLineMu.Lock()
-					currentLine = stripped
-					currentLineMu.Unlock()
-					notePromptMarker(stripped)
-				}
+				terminal.Write(buf[:n])
+			}
+			if transcript != nil {
+				transcript.Write(buf[:n])
 			}
+			failures.Write(buf[:n])
+			queue.Write(buf[:n])
+			stuck.Output(time.Now())
+			detector.Output(buf[:n], time.Now())
 		}
 	}()
 
@@ -218,56 +467,135 @@ func runWrapper(args []string, standalone *StandaloneConfig) {
 	var lastState string
 	var lastNotifiedState string
 	var stateChangeTime time.Time
-	var prevLine string
-	var lineStableSince time.Time
+	var lastShown, notifiedShown string
+	var shownChangeTime time.Time
 	debounceDelay := time.Duration(DebounceDelay) * time.Second
-	idleThreshold := 1 * time.Second
 
 	go func() {
 		ticker := time.NewTicker(time.Duration(StatusInterval) * time.Millisecond)
 		defer ticker.Stop()
 
 		for range ticker.C {
-			currentLineMu.RLock()
-			line := currentLine
-			currentLineMu.RUnlock()
-
-			// Detect state by line stability: unchanged for 1s = waiting
-			now := time.Now()
-			if line != prevLine {
-				prevLine = line
-				lineStableSince = now
-			}
-			lineIdle := line != "" && now.Sub(lineStableSince) >= idleThreshold
+			screen := terminalScreen{}
+			line := screen.CurrentLine()
+			detection := detector.Tick(time.Now(), screen)
+			state := detection.State
+			lineIdle := state == StateWaiting
+			updateStatus(state, strings.Join(args, " "), cmd.Process.Pid, line, lineIdle, detection.Reason)
+			publishState(state, strings.Join(args, " "), cmd.Process.Pid, line, detection.Reason)
 
-			// Certain lines indicate active processing regardless of idle time
-			if lineIdle && isRunningLine(line) {
-				lineIdle = false
+			// Alert on tasks that run too long or stop printing
+			if alert := stuck.Check(state, time.Now()); alert != nil {
+				if actionLog != nil {
+					actionLog("PID %d: watchdog: %s (alert %d)", cmd.Process.Pid, alert, alert.Count)
+				}
+				if recording != nil {
+					recording.Marker("stuck: " + alert.Reason)
+				}
+				if alert.Interrupt {
+					if actionLog != nil {
+						actionLog("PID %d: watchdog: sending SIGINT", cmd.Process.Pid)
+					}
+					cmd.Process.Signal(os.Interrupt)
+				}
+				if standalone != nil {
+					ev := NotifyEvent{
+						Event:     EventStuck,
+						State:     state,
+						PID:       cmd.Process.Pid,
+						Command:   strings.Join(args, " "),
+						Message:   fmt.Sprintf("%s の%s", filepath.Base(args[0]), alert),
+						LastLine:  line,
+						TaskStart: time.Now().Add(-alert.Running),
+						Time:      time.Now(),
+					}
+					if watchdogConfig.Message != "" {
+						ev.Message = ev.expand(watchdogConfig.Message)
+					}
+					dispatchNotification(standalone.Sinks, ev, notifyLog)
+				}
 			}
 
-			// Genuine waiting requires the input prompt box to be currently
-			// displayed: the marker must appear within the last few screen lines.
-			// During processing the marker scrolls out, so idle output mid-task
-			// (e.g. long thinking, or a persistent bottom hint line) is correctly
-			// treated as running. Tools that never emit the marker fall back to
-			// pure idle detection.
-			if lineIdle {
-				promptSeenMu.RLock()
-				markerEverSeen := !lastPromptSeen.IsZero()
-				promptSeenMu.RUnlock()
-				if markerEverSeen && !promptInRecentLines(promptScanLines) {
-					lineIdle = false
+			// Answer confirmation prompts matched by auto-respond rules
+			visible := visibleLines()
+			if answer := answers.Respond(state, time.Now(), visible); answer != nil {
+				if actionLog != nil {
+					actionLog("PID %d: auto-respond %s", cmd.Process.Pid, answer)
 				}
+				if recording != nil {
+					recording.Marker("auto-respond: " + answer.Rule)
+				}
+				typeInput(answer.Input)
 			}
 
-			state := StateRunning
-			if lineIdle {
-				state = StateWaiting
+			// Type the next queued prompt once the command is waiting for a
+			// new task; a confirmation prompt left for the user does not count
+			stdinMu.RLock()
+			lastInput := lastStdinInput
+			stdinMu.RUnlock()
+			queueState := state
+			if state == StateWaiting && answers.WaitingFor(visible) == WaitingForApproval {
+				queueState = StateRunning
+			}
+			if prompt, pausedBy := queue.Next(queueState, time.Now(), lastInput); prompt != "" {
+				if notifyLog != nil {
+					pending, _ := queue.Status()
+					notifyLog("PID %d: queue: typing %q (%d pending)", cmd.Process.Pid, prompt, pending)
+				}
+				typeInput([]string{prompt, "\r"})
+			} else if pausedBy != "" && notifyLog != nil {
+				notifyLog("PID %d: queue paused: %s", cmd.Process.Pid, pausedBy)
 			}
-			updateStatus(state, strings.Join(args, " "), cmd.Process.Pid, line, lineIdle)
 
 			// Standalone mode: check for state changes and notify with debounce
 			if standalone != nil {
+				// Send the digest of notifications held while quiet
+				getQuietGate().Flush(time.Now(), notifyLog)
+
+				// Remind about input the command keeps waiting for
+				if r := remind.Check(state, currentStateSince(), lastInput, time.Now()); r != nil {
+					ev := NotifyEvent{
+						Event:     EventRemind,
+						State:     state,
+						PID:       cmd.Process.Pid,
+						Command:   strings.Join(args, " "),
+						Message:   fmt.Sprintf("%s が%s", filepath.Base(args[0]), r),
+						LastLine:  line,
+						TaskStart: time.Now().Add(-r.Waited),
+						Time:      time.Now(),
+					}
+					if standalone.Reminder.Message != "" {
+						ev.Message = ev.expand(standalone.Reminder.Message)
+					}
+					logToFile(standalone, "PID %d: 🔔 %s", cmd.Process.Pid, ev.Message)
+					dispatchNotification(standalone.Sinks, ev, notifyLog)
+				}
+
+				// Transitions of the displayed state, declared states included
+				shown := displayState(state, currentSubstate())
+				if lastShown == "" {
+					lastShown, notifiedShown, shownChangeTime = shown, shown, time.Now()
+				} else if shown != lastShown {
+					lastShown, shownChangeTime = shown, time.Now()
+				} else if shown != notifiedShown && time.Since(shownChangeTime) >= debounceDelay {
+					if isDeclaredState(notifiedShown) || isDeclaredState(shown) {
+						logToFile(standalone, "PID %d: %s -> %s", cmd.Process.Pid, notifiedShown, shown)
+					}
+					dispatchNotification(standalone.Sinks, NotifyEvent{
+						Event:      EventTransition,
+						State:      shown,
+						PrevState:  notifiedShown,
+						PID:        cmd.Process.Pid,
+						Command:    strings.Join(args, " "),
+						Message:    fmt.Sprintf("%s: %s → %s", filepath.Base(args[0]), notifiedShown, shown),
+						LastLine:   line,
+						TaskStart:  taskStartOf(standalone),
+						Time:       time.Now(),
+						Transcript: lastTranscript(),
+					}, notifyLog)
+					notifiedShown = shown
+				}
+
 				// Initialize lastState on first iteration
 				if lastState == "" {
 					lastState = state
@@ -289,20 +617,22 @@ func runWrapper(args []string, standalone *StandaloneConfig) {
 				} else if lastState == state && lastNotifiedState != state {
 					// State is stable, check if debounce delay has passed
 					if time.Since(stateChangeTime) >= debounceDelay {
-						var message string
+						var message, errorLine string
 						standalone.TaskStartMu.Lock()
 						taskStart := standalone.TaskStartTime
 						standalone.TaskStartMu.Unlock()
 
 						if state == StateWaiting {
-							// Check minimum duration before notifying
+							// Check minimum duration before notifying; failed tasks are always reported
+							errorLine = currentTaskError()
 							taskDuration := time.Since(taskStart)
-							if standalone.MinDuration > 0 && taskDuration < standalone.MinDuration {
+							if errorLine == "" && standalone.MinDuration > 0 && taskDuration < standalone.MinDuration {
 								logToFile(standalone, "Skipping notification: duration %v < min %v", taskDuration, standalone.MinDuration)
 								lastNotifiedState = state
 								continue
 							}
 							message = replacePlaceholders(standalone.EndMsg, taskStart)
+							message = strings.ReplaceAll(message, "{transcript}", lastTranscript())
 						} else if state == StateRunning {
 							message = replacePlaceholders(standalone.StartMsg, taskStart)
 							// Reset task start time for next cycle
@@ -315,25 +645,36 @@ func runWrapper(args []string, standalone *StandaloneConfig) {
 						if state == StateWaiting {
 							stateIcon = "⏳"
 						}
-						logToFile(standalone, "PID %d: %s %s", cmd.Process.Pid, stateIcon, state)
-
-						if message != "" {
-							logToFile(standalone, "%s", message)
-
-							if standalone.Command != "" {
-								go func(msg string, config *StandaloneConfig) {
-									notifyCmd := exec.Command(config.Command, msg)
-									output, err := notifyCmd.CombinedOutput()
-									if err != nil {
-										logToFile(config, "Command error: %v", err)
-									}
-									if len(output) > 0 {
-										logToFile(config, "Command output: %s", strings.TrimSpace(string(output)))
-									}
-								}(message, standalone)
+						logToFile(standalone, "PID %d: %s %s (%s)", cmd.Process.Pid, stateIcon, state, detection.Reason)
+
+						ev := NotifyEvent{
+							Event:      EventStart,
+							State:      state,
+							PID:        cmd.Process.Pid,
+							Command:    strings.Join(args, " "),
+							Message:    message,
+							LastLine:   line,
+							TaskStart:  taskStart,
+							Time:       time.Now(),
+							Transcript: lastTranscript(),
+							ErrorLine:  errorLine,
+						}
+						if state == StateWaiting {
+							ev.Event = EventEnd
+						}
+						if errorLine != "" {
+							logToFile(standalone, "PID %d: ❌ task failed: %s", cmd.Process.Pid, errorLine)
+							ev.Event = EventFailed
+							if standalone.ErrMsg != "" {
+								ev.Message = ev.expand(standalone.ErrMsg)
 							}
 						}
 
+						if ev.Message != "" {
+							logToFile(standalone, "%s", ev.Message)
+						}
+						dispatchNotification(standalone.Sinks, ev, notifyLog)
+
 						lastNotifiedState = state
 					}
 				}
@@ -343,14 +684,89 @@ func runWrapper(args []string, standalone *StandaloneConfig) {
 
 	// Wait for command to finish
 	err = cmd.Wait()
-	updateStatus(StateStopped, strings.Join(args, " "), cmd.Process.Pid, "", false)
 
-	// Cleanup: remove status file on exit
-	os.Remove(statusFile)
+	// Let the output copier drain what the command printed last, unless
+	// something else still holds the terminal open
+	select {
+	case <-outputDone:
+	case <-time.After(outputDrainTimeout):
+	}
+
+	// Store exit code but don't call os.Exit here (let defer run first).
+	// A command killed by a signal exits with 128+signal like in a shell.
+	if err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			exitCode = exitErr.ExitCode()
+			if ws, ok := exitErr.Sys().(syscall.WaitStatus); ok && ws.Signaled() {
+				exitSignal = unix.SignalName(ws.Signal())
+				exitCode = 128 + int(ws.Signal())
+			}
+		} else {
+			exitCode = 1
+		}
+	}
+
+	reason := "exited"
+	if exitSignal != "" {
+		reason = "killed by " + exitSignal
+	}
+	lastLine := terminalScreen{}.CurrentLine()
+	prevShown := displayState(currentState(), currentSubstate())
+	updateStatus(StateStopped, strings.Join(args, " "), cmd.Process.Pid, lastLine, false, reason)
+	publishState(StateStopped, strings.Join(args, " "), cmd.Process.Pid, lastLine, reason)
+
+	// Cleanup: keep the stopped status as a tombstone for daemons and -l
+	// (cleanupStaleFiles removes it later), and remove the sockets
+	if tombstoneRetention() <= 0 {
+		os.Remove(statusFile)
+	}
+	if eventStream != nil {
+		eventStream.Close()
+	}
+	if attachServer != nil {
+		attachServer.Close()
+	}
 
 	// Close log resources if standalone mode
 	if standalone != nil {
 		logToFile(standalone, "Process terminated")
+
+		// Deliver stopped (and error) notifications before exiting
+		standalone.TaskStartMu.Lock()
+		taskStart := standalone.TaskStartTime
+		standalone.TaskStartMu.Unlock()
+		code := exitCode
+		ev := NotifyEvent{
+			Event:      EventStopped,
+			State:      StateStopped,
+			PID:        cmd.Process.Pid,
+			Command:    strings.Join(args, " "),
+			Message:    fmt.Sprintf("%s が終了しました (exit %d)", filepath.Base(args[0]), exitCode),
+			LastLine:   lastLine,
+			TaskStart:  taskStart,
+			Time:       time.Now(),
+			ExitCode:   &code,
+			Signal:     exitSignal,
+			Transcript: lastTranscript(),
+		}
+		if standalone.ExitMsg != "" {
+			ev.Message = ev.expand(standalone.ExitMsg)
+		}
+		logToFile(standalone, "%s", ev.Message)
+		waitStopped := dispatchNotification(standalone.Sinks, ev, notifyLog)
+		if exitCode != 0 {
+			ev.Event = EventError
+			waitNotifications(dispatchNotification(standalone.Sinks, ev, notifyLog), notifyWaitTimeout)
+		}
+		if prevShown != "" {
+			ev.Event, ev.State, ev.PrevState = EventTransition, StateStopped, prevShown
+			ev.Message = fmt.Sprintf("%s: %s → %s", filepath.Base(args[0]), prevShown, StateStopped)
+			waitNotifications(dispatchNotification(standalone.Sinks, ev, notifyLog), notifyWaitTimeout)
+		}
+		waitNotifications(waitStopped, notifyWaitTimeout)
+		// Held notifications would be lost with the process, so send them now
+		waitNotifications(getQuietGate().FlushOnExit(notifyLog), notifyWaitTimeout)
+
 		if standalone.LogFile != nil {
 			standalone.LogFile.Close()
 		}
@@ -358,15 +774,61 @@ func runWrapper(args []string, standalone *StandaloneConfig) {
 			standalone.Syslog.Close()
 		}
 	}
+}
 
-	// Store exit code but don't call os.Exit here (let defer run first)
-	if err != nil {
-		if exitErr, ok := err.(*exec.ExitError); ok {
-			exitCode = exitErr.ExitCode()
-		} else {
-			exitCode = 1
-		}
+// currentState returns the state last written to the status file
+func currentState() string {
+	statusMu.Lock()
+	defer statusMu.Unlock()
+	return statusState
+}
+
+// currentSubstate returns the declared state last written to the status file
+func currentSubstate() string {
+	statusMu.Lock()
+	defer statusMu.Unlock()
+	return statusSubstate
+}
+
+// currentStateSince returns when the state last written to the status file began
+func currentStateSince() time.Time {
+	statusMu.Lock()
+	defer statusMu.Unlock()
+	return stateChangedAt
+}
+
+// currentTaskError returns the error line of the last task, or "" if it did not fail
+func currentTaskError() string {
+	statusMu.Lock()
+	defer statusMu.Unlock()
+	return statusTaskError
+}
+
+// taskStartOf returns when the current standalone task started
+func taskStartOf(standalone *StandaloneConfig) time.Time {
+	standalone.TaskStartMu.Lock()
+	defer standalone.TaskStartMu.Unlock()
+	return standalone.TaskStartTime
+}
+
+// stateMarker labels a state change in the session recording, e.g. "task 2: running (output changing)"
+func stateMarker(state string, task int, reason string) string {
+	label := state
+	if reason != "" {
+		label = fmt.Sprintf("%s (%s)", state, reason)
+	}
+	if task > 0 {
+		label = fmt.Sprintf("task %d: %s", task, label)
+	}
+	return label
+}
+
+// lastTranscript returns the transcript of the last finished task, or ""
+func lastTranscript() string {
+	if transcript == nil {
+		return ""
 	}
+	return transcript.LastPath()
 }
 
 // addLine adds a line to the screen buffer
@@ -377,8 +839,6 @@ func addLine(line string) {
 		return
 	}
 
-	notePromptMarker(line)
-
 	bufferMu.Lock()
 	defer bufferMu.Unlock()
 
@@ -388,42 +848,138 @@ func addLine(line string) {
 	}
 }
 
-// notePromptMarker records the time when the input-waiting prompt marker is seen
-func notePromptMarker(line string) {
-	if isPromptLine(line) {
-		promptSeenMu.Lock()
-		lastPromptSeen = time.Now()
-		promptSeenMu.Unlock()
+// terminalScreen exposes the wrapper's virtual terminal as a Screen
+type terminalScreen struct{}
+
+// CurrentLine returns the text on the cursor row, or the nearest non-blank row above it
+func (terminalScreen) CurrentLine() string {
+	lines, row := terminal.Snapshot()
+	for i := row; i >= 0; i-- {
+		if line := strings.TrimSpace(lines[i]); line != "" {
+			return line
+		}
 	}
+	return ""
 }
 
-// promptScanLines is how many trailing screen-buffer lines are scanned for the
-// input prompt marker when deciding the waiting state.
-const promptScanLines = 3
+// RecentLines returns the last n non-blank rows currently visible
+func (terminalScreen) RecentLines(n int) []string {
+	lines := visibleLines()
+	if len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+	return lines
+}
 
-// promptInRecentLines reports whether the input prompt marker appears within the
-// last n lines of the screen buffer (i.e., the input box is currently displayed).
-func promptInRecentLines(n int) bool {
-	bufferMu.RLock()
-	defer bufferMu.RUnlock()
-	start := len(screenBuffer) - n
-	if start < 0 {
-		start = 0
+// visibleLines returns the non-blank rows of the virtual terminal, top to bottom
+func visibleLines() []string {
+	rows, _ := terminal.Snapshot()
+	var lines []string
+	for _, row := range rows {
+		if line := strings.TrimSpace(row); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
+
+// publishState sends a state event to socket subscribers when the
+// displayed state, declared states included, or the watchdog alert changes
+func publishState(state, command string, pid int, lastLine, reason string) {
+	publishMu.Lock()
+	defer publishMu.Unlock()
+	statusMu.Lock()
+	substate, icon := statusSubstate, statusStateIcon
+	var stuck string
+	if state == StateRunning {
+		stuck = watchdog.Stuck()
+	}
+	statusMu.Unlock()
+	shown := displayState(state, substate)
+	if eventStream == nil || shown == publishedShown && stuck == publishedStuck {
+		return
+	}
+	ev := StateEvent{
+		State:     state,
+		PrevState: publishedState,
+		Substate:  substate,
+		StateIcon: icon,
+		PID:       pid,
+		Command:   command,
+		LastLine:  lastLine,
+		Reason:    reason,
+		Time:      time.Now(),
+		Stuck:     stuck,
 	}
-	for _, l := range screenBuffer[start:] {
-		if isPromptLine(l) {
-			return true
+	if state == StateStopped {
+		code := exitCode
+		ev.ExitCode = &code
+		ev.Signal = exitSignal
+	}
+	if errorLine := currentTaskError(); errorLine != "" {
+		ev.TaskFailed, ev.ErrorLine = true, errorLine
+	}
+	if transcript != nil {
+		if state == StateRunning {
+			ev.Transcript = transcript.Path()
+		} else {
+			ev.Transcript = transcript.LastPath()
 		}
 	}
-	return false
+	eventStream.Publish(ev)
+	publishedState, publishedShown, publishedStuck = state, shown, stuck
 }
 
-// updateStatus writes the current status to the status file
-func updateStatus(state, command string, pid int, lastLine string, idleDetected bool) {
+// updateStatus writes the current status to the status file.
+// Once the stopped state has been written, later updates are ignored.
+func updateStatus(state, command string, pid int, lastLine string, idleDetected bool, reason string) {
+	statusMu.Lock()
+	defer statusMu.Unlock()
+	if statusState == StateStopped {
+		return
+	}
+	now := time.Now()
+	if state != statusState {
+		if statusState != "" {
+			stateChangedAt = now
+		}
+		if state == StateRunning && statusState == StateWaiting {
+			taskCount++
+			taskStartTime = now
+		}
+		if transcript != nil {
+			// A transcript covers one task; output shown while waiting
+			// belongs to the next one, unless the command exits first
+			switch {
+			case statusState == StateRunning && state != StateRunning:
+				transcript.EndTask()
+			case state == StateStopped:
+				transcript.Discard()
+			}
+		}
+		if errorWatch != nil {
+			// Like transcripts, output shown while waiting belongs to the next task
+			switch {
+			case statusState == StateRunning && state != StateRunning:
+				statusTaskError = errorWatch.EndTask()
+			case state == StateRunning:
+				statusTaskError = ""
+			}
+		}
+		if recording != nil {
+			recording.Marker(stateMarker(state, taskCount, reason))
+		}
+		statusState = state
+	}
+
+	// Scrolled-off history followed by what is visible on screen
 	bufferMu.RLock()
 	lines := make([]string, len(screenBuffer))
 	copy(lines, screenBuffer)
 	bufferMu.RUnlock()
+	if terminal != nil {
+		lines = append(lines, visibleLines()...)
+	}
 
 	activityMu.RLock()
 	idle := time.Since(lastActivity).Seconds()
@@ -434,16 +990,75 @@ func updateStatus(state, command string, pid int, lastLine string, idleDetected
 		lines = lines[len(lines)-20:]
 	}
 
+	var code *int
+	if state == StateStopped {
+		c := exitCode
+		code = &c
+	}
+	if taskHistory != nil {
+		if state == StateStopped {
+			taskHistory.Finish(now, lines, code, exitSignal)
+		} else {
+			taskHistory.Observe(state, now, lastLine, lines)
+		}
+	}
+
 	status := Status{
-		State:         state,
-		Command:       command,
-		PID:           pid,
-		StartTime:     processStartTime,
-		UpdatedAt:     time.Now(),
-		LastLines:     lines,
-		LastLine:      lastLine,
-		IdleDetected:  idleDetected,
-		IdleSeconds:   idle,
+		SchemaVersion:  StatusSchemaVersion,
+		State:          state,
+		Command:        command,
+		PID:            pid,
+		StartTime:      processStartTime,
+		UpdatedAt:      now,
+		LastLines:      lines,
+		LastLine:       lastLine,
+		IdleDetected:   idleDetected,
+		IdleSeconds:    idle,
+		Cwd:            statusInfo.Cwd,
+		Hostname:       statusInfo.Hostname,
+		TTY:            statusInfo.TTY,
+		KiromonVersion: statusInfo.Version,
+		TaskCount:      taskCount,
+		TaskStartTime:  taskStartTime,
+		StateChangedAt: stateChangedAt,
+		Reason:         reason,
+	}
+	if taskQueue != nil {
+		status.QueueLength, status.QueuePaused = taskQueue.Status()
+	}
+	if classifier != nil && terminal != nil {
+		status.Substate, status.StateIcon = classifier.Classify(state, visibleLines())
+	}
+	statusSubstate, statusStateIcon = status.Substate, status.StateIcon
+	if responder != nil {
+		if state == StateWaiting && terminal != nil {
+			status.WaitingFor = responder.WaitingFor(visibleLines())
+		}
+		status.AutoResponses = responder.Total()
+	}
+	if statusTaskError != "" {
+		status.TaskFailed, status.ErrorLine = true, statusTaskError
+	}
+	if state == StateRunning {
+		status.Stuck = watchdog.Stuck()
+	}
+	stdinMu.RLock()
+	if !lastStdinInput.IsZero() {
+		input := lastStdinInput
+		status.LastInputAt = &input
+	}
+	stdinMu.RUnlock()
+	if transcript != nil {
+		if state == StateRunning {
+			status.Transcript = transcript.Path()
+		} else {
+			status.Transcript = transcript.LastPath()
+		}
+	}
+	if state == StateStopped {
+		status.ExitCode = code
+		status.Signal = exitSignal
+		status.EndTime = &now
 	}
 
 	data, _ := json.MarshalIndent(status, "", "  ")
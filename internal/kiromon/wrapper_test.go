@@ -1,7 +1,9 @@
 package kiromon
 
 import (
+	"path/filepath"
 	"testing"
+	"time"
 )
 
 func TestAddLine(t *testing.T) {
@@ -56,3 +58,74 @@ func TestAddLineMaxLines(t *testing.T) {
 		t.Errorf("buffer length = %d, want %d (MaxLines)", len(screenBuffer), MaxLines)
 	}
 }
+
+func TestTerminalScreen(t *testing.T) {
+	terminal = newVTScreen(6, 40, addLine)
+	defer func() { terminal = nil }()
+
+	terminal.Write([]byte("出力1\r\n出力2\r\n\r\n日本語> "))
+
+	screen := terminalScreen{}
+	if got := screen.CurrentLine(); got != "日本語>" {
+		t.Errorf("CurrentLine() = %q, want %q", got, "日本語>")
+	}
+	recent := screen.RecentLines(2)
+	if len(recent) != 2 || recent[0] != "出力2" || recent[1] != "日本語>" {
+		t.Errorf("RecentLines(2) = %q", recent)
+	}
+
+	// Cursor on a blank row falls back to the nearest line above
+	terminal.Write([]byte("\r\n"))
+	if got := screen.CurrentLine(); got != "日本語>" {
+		t.Errorf("CurrentLine() on blank row = %q, want %q", got, "日本語>")
+	}
+}
+
+func TestUpdateStatusTracksTasks(t *testing.T) {
+	statusFile = filepath.Join(t.TempDir(), "test-1.json")
+	terminal = nil
+	processStartTime = time.Now()
+	statusState, stateChangedAt, taskCount, taskStartTime = "", processStartTime, 0, processStartTime
+	defer func() { statusState = "" }()
+
+	read := func() *Status {
+		t.Helper()
+		status, err := readStatusWithLock(statusFile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return status
+	}
+
+	updateStatus(StateRunning, "cmd", 1, "", false, "started")
+	if s := read(); s.SchemaVersion != StatusSchemaVersion || s.TaskCount != 0 || s.Reason != "started" {
+		t.Errorf("initial status = %+v", s)
+	}
+
+	updateStatus(StateWaiting, "cmd", 1, "> ", true, "prompt on screen")
+	waiting := read()
+	if waiting.TaskCount != 0 || waiting.StateChangedAt.Before(processStartTime) {
+		t.Errorf("waiting status = %+v", waiting)
+	}
+
+	// waiting -> running starts a task
+	updateStatus(StateRunning, "cmd", 1, "", false, "output changing")
+	running := read()
+	if running.TaskCount != 1 || running.TaskStartTime.Before(waiting.StateChangedAt) {
+		t.Errorf("running status = %+v", running)
+	}
+	updateStatus(StateRunning, "cmd", 1, "", false, "output changing")
+	if s := read(); s.TaskCount != 1 || !s.StateChangedAt.Equal(running.StateChangedAt) {
+		t.Errorf("unchanged state altered tracking: %+v", s)
+	}
+
+	// The stopped state records the exit code and is final
+	exitCode = 3
+	defer func() { exitCode = 0 }()
+	updateStatus(StateStopped, "cmd", 1, "", false, "exited")
+	updateStatus(StateRunning, "cmd", 1, "", false, "late tick")
+	stopped := read()
+	if stopped.State != StateStopped || stopped.ExitCode == nil || *stopped.ExitCode != 3 {
+		t.Errorf("stopped status = %+v", stopped)
+	}
+}